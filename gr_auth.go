@@ -0,0 +1,174 @@
+package gr
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+)
+
+/*
+Sets the header "Authorization" to the given value, which must include the
+scheme, for example "Bearer <token>". If the value is empty, deletes the header
+instead. Mutates and returns the receiver.
+*/
+func (self *Req) Auth(val string) *Req {
+	if val == `` {
+		return self.HeadDel(`Authorization`)
+	}
+	return self.HeadSet(`Authorization`, val)
+}
+
+/*
+Sets the header "Authorization" for HTTP Basic authentication, as defined by
+RFC 7617, with the given user and password. Unlike
+`(*http.Request).SetBasicAuth`, this is chainable. Mutates and returns the
+receiver.
+*/
+func (self *Req) AuthBasic(user, pass string) *Req {
+	return self.Auth(`Basic ` + base64.StdEncoding.EncodeToString(stringBytes(user+`:`+pass)))
+}
+
+/*
+Sets the header "Authorization" to "Bearer <token>", as defined by RFC 6750.
+If the token is empty, deletes the header instead. Mutates and returns the
+receiver.
+*/
+func (self *Req) AuthBearer(token string) *Req {
+	if token == `` {
+		return self.Auth(``)
+	}
+	return self.Auth(`Bearer ` + token)
+}
+
+/*
+Sets an API key in the given header, such as "X-Api-Key". Shortcut for
+`(*gr.Req).HeadSet`. Mutates and returns the receiver.
+*/
+func (self *Req) AuthKeyHead(key, val string) *Req {
+	return self.HeadSet(key, val)
+}
+
+/*
+Sets an API key in the given query parameter, such as "api_key", replacing any
+previous values of that parameter. Allocates `.URL` if necessary. Mutates and
+returns the receiver.
+
+Caution: query parameters are more likely to be logged than headers. Prefer
+`(*gr.Req).AuthKeyHead` when the server supports it.
+*/
+func (self *Req) AuthKeyQuery(key, val string) *Req {
+	return reqQuerySet(self, key, val)
+}
+
+/*
+Short for "credentials". Source of credentials for outgoing requests, called
+by `gr.MidCred` before each request, which allows to rotate credentials such as
+access tokens without rebuilding requests or clients. `.Cred` must add
+credentials to the given request, which is a clone owned by the caller.
+Implementations must be safe for concurrent use.
+
+Built-in implementations are `gr.CredFunc`, `gr.CredBasic`, `gr.CredBearer` and
+`gr.CredKey`.
+*/
+type Cred interface{ Cred(*Req) error }
+
+/*
+Function type implementing `gr.Cred`, similar to `http.HandlerFunc`. Allows to
+use an arbitrary function as a credential source, for example one which loads
+the current token:
+
+	cli.Auth(gr.CredFunc(func(req *gr.Req) error {
+		token, err := loadToken(req.Context())
+		if err != nil {
+			return err
+		}
+		req.AuthBearer(token)
+		return nil
+	}))
+*/
+type CredFunc func(*Req) error
+
+// Implement `gr.Cred` by calling the receiver.
+func (self CredFunc) Cred(req *Req) error {
+	if self == nil {
+		return nil
+	}
+	return self(req)
+}
+
+// Implementation of `gr.Cred` using `(*gr.Req).AuthBasic`.
+type CredBasic struct {
+	User string
+	Pass string
+}
+
+// Implement `gr.Cred`.
+func (self CredBasic) Cred(req *Req) error {
+	req.AuthBasic(self.User, self.Pass)
+	return nil
+}
+
+// Implementation of `gr.Cred` using `(*gr.Req).AuthBearer`.
+type CredBearer string
+
+// Implement `gr.Cred`.
+func (self CredBearer) Cred(req *Req) error {
+	req.AuthBearer(string(self))
+	return nil
+}
+
+/*
+Implementation of `gr.Cred` for API keys. If `.Query` is true, uses
+`(*gr.Req).AuthKeyQuery`, otherwise `(*gr.Req).AuthKeyHead`.
+*/
+type CredKey struct {
+	Key   string
+	Val   string
+	Query bool
+}
+
+// Implement `gr.Cred`.
+func (self CredKey) Cred(req *Req) error {
+	if self.Query {
+		req.AuthKeyQuery(self.Key, self.Val)
+	} else {
+		req.AuthKeyHead(self.Key, self.Val)
+	}
+	return nil
+}
+
+/*
+Middleware that calls the given credential source before each request, on a
+clone of the request. If the source returns an error, the request is not
+performed, and the error is returned from the round trip. If the source is nil,
+this is a nop. Also see `(*gr.Cli).Auth`.
+
+Caution: the source is called for every request, including requests to other
+hosts after redirects. Sources which must not leak credentials to other hosts
+should check `.URL.Host` of the given request.
+*/
+func MidCred(src Cred) Mid {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if src == nil {
+			return next
+		}
+
+		return Trans(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			err := src.Cred((*Req)(req))
+			if err != nil {
+				if req.Body != nil {
+					_ = req.Body.Close()
+				}
+				return nil, fmt.Errorf(`[gr] failed to obtain credentials: %w`, err)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+/*
+Installs the given credential source via `gr.MidCred`. Shortcut for
+`self.Use(gr.MidCred(src))`. Mutates and returns the receiver.
+*/
+func (self *Cli) Auth(src Cred) *Cli { return self.Use(MidCred(src)) }
@@ -0,0 +1,742 @@
+package gr
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Response header added by `gr.Cache`, with one of the values below.
+	CacheHead = `X-Cache`
+
+	// Served from the cache without contacting the server.
+	CacheHit = `hit`
+
+	// Fetched from the server, or not cacheable.
+	CacheMiss = `miss`
+
+	// Served from the cache after the server confirmed it via 304.
+	CacheRevalidated = `revalidated`
+)
+
+/*
+Caching transport implementing RFC 9111 for a private cache, such as the cache
+of one client. Caches responses to requests whose method satisfies
+`gr.IsReadOnly`, storing them in `.Store`, or in memory if `.Store` is nil.
+Each response to such a request gets the header `gr.CacheHead` with one of the
+values `gr.CacheHit`, `gr.CacheMiss` or `gr.CacheRevalidated`.
+
+Respects the response headers "Cache-Control", "Expires", "Age", "Date" and
+"Vary". If a response has no explicit freshness, but has "Last-Modified",
+its freshness is 10% of its age at the time of storing, as suggested by the
+RFC. Stale responses are revalidated via conditional requests with
+"If-None-Match" and "If-Modified-Since", using the stored "ETag" and
+"Last-Modified". On 304, the stored response is updated with the new headers
+and served.
+
+Respects the request directives "no-store", "no-cache", "max-age",
+"min-fresh", "max-stale" and "only-if-cached", as well as "Pragma: no-cache".
+Requests which already have conditional or "Range" headers bypass the cache.
+Successful responses to requests with other methods, such as POST, invalidate
+stored responses for the same URL.
+
+Only one response is stored per method and URL. When "Vary" is present, the
+stored response is used only for requests with the same values of the listed
+headers, and is otherwise replaced.
+
+Response bodies are fully buffered before storing. Usable as
+`http.Client.Transport` or `gr.Cli.Transport`. To wrap another transport, use
+`(*gr.Cache).Mid` as a `gr.Mid`. Safe for concurrent use.
+*/
+type Cache struct {
+	Store CacheStore
+	mem   CacheMem
+}
+
+// Implement `http.RoundTripper`, fetching via `http.DefaultTransport`.
+func (self *Cache) RoundTrip(req *http.Request) (*http.Response, error) {
+	return self.roundTrip(http.DefaultTransport, req)
+}
+
+/*
+Implements `gr.Mid`. Returns a transport which fetches uncached responses via
+the given transport, or `http.DefaultTransport` if nil. Usage:
+
+	cli := new(gr.Cli).Use(cache.Mid)
+*/
+func (self *Cache) Mid(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return Trans(func(req *http.Request) (*http.Response, error) {
+		return self.roundTrip(next, req)
+	})
+}
+
+func (self *Cache) store() CacheStore {
+	if self.Store != nil {
+		return self.Store
+	}
+	return &self.mem
+}
+
+func (self *Cache) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	if !IsReadOnly(req.Method) {
+		res, err := next.RoundTrip(req)
+		if err == nil && (IsOk(res.StatusCode) || IsRedir(res.StatusCode)) {
+			err = self.invalidate(req.URL)
+			if err != nil {
+				_ = res.Body.Close()
+				return nil, err
+			}
+		}
+		return res, err
+	}
+
+	reqCc := parseCacheControl(req.Header)
+	if reqCc.has(`no-store`) || isCacheBypass(req.Header) {
+		return cacheMark(next.RoundTrip(req))
+	}
+
+	key := cacheKey(req.Method, req.URL)
+	entry, err := self.load(key, req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if entry != nil && !entry.matches(req) {
+		entry = nil
+	}
+
+	if entry != nil && !isNoCache(req.Header, reqCc) && entry.isFresh(reqCc, now) {
+		return entry.response(req, CacheHit, now), nil
+	}
+
+	if reqCc.has(`only-if-cached`) {
+		return cacheGatewayTimeout(req), nil
+	}
+
+	if entry != nil && entry.hasValidators() {
+		return self.revalidate(next, req, key, entry)
+	}
+	return self.fetch(next, req, key)
+}
+
+func (self *Cache) fetch(next http.RoundTripper, req *http.Request, key string) (*http.Response, error) {
+	reqTime := time.Now()
+	res, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return self.save(req, key, res, reqTime)
+}
+
+func (self *Cache) revalidate(
+	next http.RoundTripper, req *http.Request, key string, entry *cacheEntry,
+) (*http.Response, error) {
+	cond := req.Clone(req.Context())
+	etag := entry.res.Header.Get(`Etag`)
+	if etag != `` {
+		cond.Header.Set(`If-None-Match`, etag)
+	}
+	mod := entry.res.Header.Get(`Last-Modified`)
+	if mod != `` {
+		cond.Header.Set(`If-Modified-Since`, mod)
+	}
+
+	reqTime := time.Now()
+	res, err := next.RoundTrip(cond)
+	if err != nil {
+		return nil, err
+	}
+	res.Request = req
+
+	if res.StatusCode != http.StatusNotModified {
+		return self.save(req, key, res, reqTime)
+	}
+	_, _ = readAllClose(res.Body)
+
+	for key, vals := range res.Header {
+		if key != `Content-Length` {
+			entry.res.Header[key] = vals
+		}
+	}
+	entry.reqTime = reqTime
+	entry.resTime = time.Now()
+
+	err = self.put(key, entry)
+	if err != nil {
+		return nil, err
+	}
+	return entry.response(req, CacheRevalidated, entry.resTime), nil
+}
+
+// Stores the response if allowed, buffering its body.
+func (self *Cache) save(req *http.Request, key string, res *http.Response, reqTime time.Time) (*http.Response, error) {
+	res.Header = Head(res.Header).Init().Header()
+	res.Header.Set(CacheHead, CacheMiss)
+
+	if !isCacheStorable(req, res) {
+		err := self.store().Delete(key)
+		if err != nil {
+			_ = res.Body.Close()
+			return nil, errCache(err)
+		}
+		return res, nil
+	}
+
+	body, err := readAllClose(res.Body)
+	if err != nil {
+		return nil, errCache(err)
+	}
+	res.Body = NewBytesReadCloser(body)
+
+	entry := &cacheEntry{
+		method:  req.Method,
+		reqTime: reqTime,
+		resTime: time.Now(),
+		vary:    cacheVary(req.Header, res.Header),
+		res:     res,
+		body:    body,
+	}
+
+	err = self.put(key, entry)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (self *Cache) load(key string, req *http.Request) (*cacheEntry, error) {
+	chunk, err := self.store().Load(key)
+	if err != nil {
+		return nil, errCache(err)
+	}
+	if chunk == nil {
+		return nil, nil
+	}
+
+	// Corrupted entries are treated as missing, and eventually replaced.
+	entry, _ := decodeCacheEntry(chunk, req)
+	return entry, nil
+}
+
+func (self *Cache) put(key string, entry *cacheEntry) error {
+	chunk, err := entry.encode()
+	if err == nil {
+		err = self.store().Store(key, chunk)
+	}
+	if err != nil {
+		return errCache(err)
+	}
+	return nil
+}
+
+func (self *Cache) invalidate(val *url.URL) error {
+	for _, method := range [...]string{http.MethodGet, http.MethodHead, http.MethodOptions} {
+		err := self.store().Delete(cacheKey(method, val))
+		if err != nil {
+			return errCache(err)
+		}
+	}
+	return nil
+}
+
+/*
+Storage used by `gr.Cache`. Keys are arbitrary strings, consisting of a method
+and a URL. `.Load` must return nil and no error for missing keys. `.Delete`
+must not fail for missing keys. Implementations must be safe for concurrent
+use. Built-in implementations are `gr.CacheMem` and `gr.CacheDir`.
+*/
+type CacheStore interface {
+	Load(key string) ([]byte, error)
+	Store(key string, val []byte) error
+	Delete(key string) error
+}
+
+/*
+In-memory implementation of `gr.CacheStore`. The zero value is ready to use.
+Used by `gr.Cache` when `gr.Cache.Store` is nil. Never evicts entries.
+*/
+type CacheMem struct {
+	lock sync.RWMutex
+	vals map[string][]byte
+}
+
+// Implement `gr.CacheStore`.
+func (self *CacheMem) Load(key string) ([]byte, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.vals[key], nil
+}
+
+// Implement `gr.CacheStore`.
+func (self *CacheMem) Store(key string, val []byte) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.vals == nil {
+		self.vals = map[string][]byte{}
+	}
+	self.vals[key] = val
+	return nil
+}
+
+// Implement `gr.CacheStore`.
+func (self *CacheMem) Delete(key string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	delete(self.vals, key)
+	return nil
+}
+
+// Returns the count of stored entries.
+func (self *CacheMem) Len() int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return len(self.vals)
+}
+
+/*
+Implementation of `gr.CacheStore` that stores each entry as a file in the given
+directory, named by the SHA-256 hash of the key. Creates the directory when
+storing, if necessary. Files are written atomically by renaming temporary
+files. Entries use the plain HTTP format written by `(*http.Response).Write`,
+preceded by metadata.
+*/
+type CacheDir string
+
+// Implement `gr.CacheStore`.
+func (self CacheDir) Load(key string) ([]byte, error) {
+	out, err := os.ReadFile(self.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return out, err
+}
+
+// Implement `gr.CacheStore`.
+func (self CacheDir) Store(key string, val []byte) error {
+	err := os.MkdirAll(string(self), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(string(self), `.tmp-*`)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(val)
+	if err == nil {
+		err = file.Close()
+	} else {
+		_ = file.Close()
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), self.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+	return err
+}
+
+// Implement `gr.CacheStore`.
+func (self CacheDir) Delete(key string) error {
+	err := os.Remove(self.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (self CacheDir) path(key string) string {
+	sum := sha256.Sum256(stringBytes(key))
+	return filepath.Join(string(self), hex.EncodeToString(sum[:]))
+}
+
+type cacheEntry struct {
+	method  string
+	reqTime time.Time
+	resTime time.Time
+	vary    http.Header
+	res     *http.Response
+	body    []byte
+}
+
+/*
+Format: a line with request and response times in Unix nanoseconds, a header
+block with the request headers listed in "Vary", and the response.
+*/
+func (self *cacheEntry) encode() (_ []byte, err error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d %d\r\n", self.reqTime.UnixNano(), self.resTime.UnixNano())
+
+	err = self.vary.Write(&buf)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+
+	res := *self.res
+	res.Header = res.Header.Clone()
+	res.Header.Del(CacheHead)
+	res.TransferEncoding = nil
+	res.Request = &http.Request{Method: self.method}
+	res.ProtoMajor, res.ProtoMinor = 1, 1
+	if self.method != http.MethodHead {
+		res.ContentLength = int64(len(self.body))
+	}
+	res.Body = NewBytesReadCloser(self.body)
+
+	err = res.Write(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeCacheEntry(chunk []byte, req *http.Request) (*cacheEntry, error) {
+	read := bufio.NewReader(bytes.NewReader(chunk))
+
+	line, err := read.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	var reqTime, resTime int64
+	_, err = fmt.Sscanf(line, "%d %d\r\n", &reqTime, &resTime)
+	if err != nil {
+		return nil, err
+	}
+
+	vary, err := textproto.NewReader(read).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.ReadResponse(read, req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := readAllClose(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cacheEntry{
+		method:  req.Method,
+		reqTime: time.Unix(0, reqTime),
+		resTime: time.Unix(0, resTime),
+		vary:    http.Header(vary),
+		res:     res,
+		body:    body,
+	}, nil
+}
+
+// True if the request has the same values of the headers listed in "Vary".
+func (self *cacheEntry) matches(req *http.Request) bool {
+	for _, key := range headList(self.res.Header, `Vary`) {
+		if key == `*` || cacheHeadValue(req.Header, key) != cacheHeadValue(self.vary, key) {
+			return false
+		}
+	}
+	return true
+}
+
+func (self *cacheEntry) hasValidators() bool {
+	return self.res.Header.Get(`Etag`) != `` || self.res.Header.Get(`Last-Modified`) != ``
+}
+
+func (self *cacheEntry) isFresh(reqCc cacheControl, now time.Time) bool {
+	resCc := parseCacheControl(self.res.Header)
+	life := self.lifetime(resCc)
+	age := self.age(now)
+
+	maxAge, ok := reqCc.seconds(`max-age`)
+	if ok && age > maxAge {
+		return false
+	}
+
+	minFresh, _ := reqCc.seconds(`min-fresh`)
+	if life-age > minFresh {
+		return true
+	}
+
+	if resCc.has(`must-revalidate`) || resCc.has(`no-cache`) || !reqCc.has(`max-stale`) {
+		return false
+	}
+
+	maxStale, ok := reqCc.seconds(`max-stale`)
+	return !ok || age-life <= maxStale
+}
+
+// Freshness lifetime as defined by RFC 9111, section 4.2.1.
+func (self *cacheEntry) lifetime(resCc cacheControl) time.Duration {
+	if resCc.has(`no-cache`) {
+		return 0
+	}
+
+	maxAge, ok := resCc.seconds(`max-age`)
+	if ok {
+		return maxAge
+	}
+
+	head := self.res.Header
+	date := self.date()
+
+	if head.Get(`Expires`) != `` {
+		expires, err := http.ParseTime(head.Get(`Expires`))
+		if err != nil {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+
+	mod, err := http.ParseTime(head.Get(`Last-Modified`))
+	if err == nil && date.After(mod) {
+		return date.Sub(mod) / 10
+	}
+	return 0
+}
+
+// Current age as defined by RFC 9111, section 4.2.3.
+func (self *cacheEntry) age(now time.Time) time.Duration {
+	apparent := self.resTime.Sub(self.date())
+	if apparent < 0 {
+		apparent = 0
+	}
+
+	ageVal, _ := strconv.ParseInt(self.res.Header.Get(`Age`), 10, 64)
+	corrected := time.Duration(ageVal)*time.Second + self.resTime.Sub(self.reqTime)
+	if corrected < apparent {
+		corrected = apparent
+	}
+	return corrected + now.Sub(self.resTime)
+}
+
+func (self *cacheEntry) date() time.Time {
+	out, err := http.ParseTime(self.res.Header.Get(`Date`))
+	if err != nil {
+		return self.resTime
+	}
+	return out
+}
+
+func (self *cacheEntry) response(req *http.Request, status string, now time.Time) *http.Response {
+	out := *self.res
+	out.Header = out.Header.Clone()
+	out.Header.Set(`Age`, strconv.FormatInt(int64(self.age(now)/time.Second), 10))
+	out.Header.Set(CacheHead, status)
+	out.Body = NewBytesReadCloser(self.body)
+	out.Request = req
+	return &out
+}
+
+/*
+Status codes which are "heuristically cacheable" as defined by RFC 9110,
+section 15.1, except 206, because partial responses are not cached.
+*/
+func isCacheableStatus(code int) bool {
+	switch code {
+	case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+		return true
+	default:
+		return false
+	}
+}
+
+// Implements RFC 9111, section 3, for a private cache.
+func isCacheStorable(req *http.Request, res *http.Response) bool {
+	resCc := parseCacheControl(res.Header)
+	if resCc.has(`no-store`) || IsInfo(res.StatusCode) || res.StatusCode == http.StatusPartialContent {
+		return false
+	}
+
+	for _, key := range headList(res.Header, `Vary`) {
+		if key == `*` {
+			return false
+		}
+	}
+
+	_, ok := resCc.seconds(`max-age`)
+	return ok ||
+		res.Header.Get(`Expires`) != `` ||
+		(isCacheableStatus(res.StatusCode) &&
+			(res.Header.Get(`Etag`) != `` || res.Header.Get(`Last-Modified`) != ``))
+}
+
+// Requests with their own conditions or ranges are passed through as-is.
+func isCacheBypass(head http.Header) bool {
+	for _, key := range [...]string{
+		`If-None-Match`, `If-Modified-Since`, `If-Match`, `If-Unmodified-Since`, `If-Range`, `Range`,
+	} {
+		if Head(head).Has(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNoCache(head http.Header, reqCc cacheControl) bool {
+	if reqCc.has(`no-cache`) {
+		return true
+	}
+	return len(reqCc) == 0 && strings.Contains(strings.ToLower(Head(head).Get(`Pragma`)), `no-cache`)
+}
+
+func cacheKey(method string, val *url.URL) string {
+	if method == `` {
+		method = http.MethodGet
+	}
+	tar := *val
+	tar.Fragment, tar.RawFragment = ``, ``
+	return method + ` ` + tar.String()
+}
+
+func cacheVary(reqHead, resHead http.Header) http.Header {
+	out := http.Header{}
+	for _, key := range headList(resHead, `Vary`) {
+		val := cacheHeadValue(reqHead, key)
+		if val != `` {
+			out.Set(key, val)
+		}
+	}
+	return out
+}
+
+func cacheHeadValue(head http.Header, key string) string {
+	return strings.Join(Head(head).Values(key), `, `)
+}
+
+func cacheMark(res *http.Response, err error) (*http.Response, error) {
+	if err == nil {
+		res.Header = Head(res.Header).Init().Header()
+		res.Header.Set(CacheHead, CacheMiss)
+	}
+	return res, err
+}
+
+// Response to "only-if-cached" requests without a usable stored response.
+func cacheGatewayTimeout(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     `504 Gateway Timeout`,
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      `HTTP/1.1`,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{CacheHead: {CacheMiss}},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// Comma-separated header values, trimmed and canonicalized as header keys.
+func headList(head http.Header, key string) (out []string) {
+	for _, val := range Head(head).Values(key) {
+		for _, val := range strings.Split(val, `,`) {
+			val = strings.TrimSpace(val)
+			if val != `` {
+				out = append(out, canonKey(val))
+			}
+		}
+	}
+	return
+}
+
+// Directives of "Cache-Control", with lowercase keys and unquoted values.
+type cacheControl map[string]string
+
+func parseCacheControl(head http.Header) cacheControl {
+	out := cacheControl{}
+	for _, val := range Head(head).Values(`Cache-Control`) {
+		for _, part := range splitCacheControl(val) {
+			key, val, _ := cut(part, `=`)
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key == `` {
+				continue
+			}
+
+			_, ok := out[key]
+			if !ok {
+				out[key] = unquote(strings.TrimSpace(val))
+			}
+		}
+	}
+	return out
+}
+
+func (self cacheControl) has(key string) bool {
+	_, ok := self[key]
+	return ok
+}
+
+// Invalid values are treated as absent, except "max-stale" without a value.
+func (self cacheControl) seconds(key string) (time.Duration, bool) {
+	val, err := strconv.ParseInt(self[key], 10, 64)
+	if err != nil || val < 0 {
+		return 0, false
+	}
+	return time.Duration(val) * time.Second, true
+}
+
+// Splits on commas outside of quoted strings.
+func splitCacheControl(src string) (out []string) {
+	var quoted bool
+	start := 0
+
+	for ind := 0; ind < len(src); ind++ {
+		switch src[ind] {
+		case '\\':
+			if quoted {
+				ind++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				out = append(out, src[start:ind])
+				start = ind + 1
+			}
+		}
+	}
+	return append(out, src[start:])
+}
+
+func unquote(src string) string {
+	if len(src) >= 2 && src[0] == '"' && src[len(src)-1] == '"' {
+		val, err := strconv.Unquote(src)
+		if err == nil {
+			return val
+		}
+		return src[1 : len(src)-1]
+	}
+	return src
+}
+
+func cut(src, sep string) (string, string, bool) {
+	ind := strings.Index(src, sep)
+	if ind < 0 {
+		return src, ``, false
+	}
+	return src[:ind], src[ind+len(sep):], true
+}
+
+func errCache(err error) error {
+	return fmt.Errorf(`[gr] cache failure: %w`, err)
+}
@@ -0,0 +1,429 @@
+package gr
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Mode of `gr.Cassette`. See the constants for the available modes.
+type CassetteMode byte
+
+const (
+	// Replay if the cassette file exists, otherwise record.
+	CassetteAuto CassetteMode = iota
+
+	// Always perform real requests, overwriting the cassette file.
+	CassetteRecord
+
+	// Never perform real requests; fail when no recorded exchange matches.
+	CassetteReplay
+)
+
+// Replacement for header values redacted by `gr.Cassette`.
+const Redacted = `[redacted]`
+
+/*
+Record/replay transport for deterministic tests, sometimes called a
+"cassette". When recording, performs real requests and appends each
+request/response pair to the file at `.Path`. When replaying, responds with
+previously recorded responses, without performing real requests. See
+`gr.CassetteMode` for the modes.
+
+The file format is plain HTTP, as written by `(*gr.Req).Write` and
+`(*gr.Res).Write`, and can be read and edited by hand. Request and response
+bodies are fully buffered.
+
+Recorded requests are matched by method, host, path, query, and, if `.Body` is
+true, body. Queries are normalized by sorting keys, so the order of query
+parameters doesn't matter. URL schemes are ignored because the format doesn't
+preserve them. Each recorded exchange is replayed once, in the recorded order;
+after all matching exchanges are used up, the last one is repeated.
+
+Before saving, the values of the headers listed in `.Redact` are replaced with
+`gr.Redacted`, in both requests and responses. Responses returned to the caller
+are not redacted.
+
+Usable as `http.Client.Transport` or `gr.Cli.Transport`. To wrap another
+transport for recording, use `(*gr.Cassette).Mid` as a `gr.Mid`. Safe for
+concurrent use.
+*/
+type Cassette struct {
+	Path   string
+	Mode   CassetteMode
+	Redact []string
+	Body   bool
+
+	lock    sync.Mutex
+	init    bool
+	replay  bool
+	entries []cassetteEntry
+}
+
+type cassetteEntry struct {
+	key  cassetteKey
+	body []byte
+	res  []byte
+	used bool
+}
+
+type cassetteKey struct {
+	method string
+	host   string
+	path   string
+	query  string
+}
+
+// Implement `http.RoundTripper`, recording via `http.DefaultTransport`.
+func (self *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	return self.roundTrip(http.DefaultTransport, req)
+}
+
+/*
+Implements `gr.Mid`. Returns a transport which records by performing requests
+via the given transport, or `http.DefaultTransport` if nil. Usage:
+
+	cli := new(gr.Cli).Use(cassette.Mid)
+*/
+func (self *Cassette) Mid(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return Trans(func(req *http.Request) (*http.Response, error) {
+		return self.roundTrip(next, req)
+	})
+}
+
+// True if the cassette is replaying rather than recording.
+func (self *Cassette) IsReplay() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	_ = self.load()
+	return self.replay
+}
+
+func (self *Cassette) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	body, err := readReqBody(req)
+	if err != nil {
+		return nil, errCassette(err)
+	}
+
+	key := cassetteKeyOf(req.Method, req.Host, req.URL)
+
+	self.lock.Lock()
+	err = self.load()
+	replay := self.replay
+	var chunk []byte
+	if err == nil && replay {
+		chunk = self.find(key, body)
+	}
+	self.lock.Unlock()
+
+	if err != nil {
+		return nil, errCassette(err)
+	}
+
+	if replay {
+		if chunk == nil {
+			return nil, errCassette(fmt.Errorf(
+				`no recorded exchange matches %v %v%v`, key.method, key.host, req.URL.RequestURI(),
+			))
+		}
+		return readCassetteRes(chunk, req)
+	}
+
+	return self.record(next, req, body)
+}
+
+func (self *Cassette) record(next http.RoundTripper, req *http.Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	setReqBody(out, body)
+
+	res, err := next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := readAllClose(res.Body)
+	if err != nil {
+		return nil, errCassette(err)
+	}
+	var buf bytes.Buffer
+	err = self.write(&buf, req, body, res, resBody)
+	if err != nil {
+		return nil, errCassette(err)
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	err = appendFile(self.Path, buf.Bytes())
+	if err != nil {
+		return nil, errCassette(err)
+	}
+
+	res.Body = NewBytesReadCloser(resBody)
+	return res, nil
+}
+
+func (self *Cassette) write(
+	out io.Writer, req *http.Request, body []byte, res *http.Response, resBody []byte,
+) (err error) {
+	defer rec(&err)
+
+	reqCopy := req.Clone(req.Context())
+	reqCopy.Header = self.redact(reqCopy.Header)
+	setReqBody(reqCopy, body)
+	(*Req)(reqCopy).Write(out)
+
+	resCopy := *res
+	resCopy.Header = self.redact(res.Header.Clone())
+	resCopy.TransferEncoding = nil
+	resCopy.Request = nil
+	if resCopy.ProtoMajor == 0 {
+		resCopy.ProtoMajor, resCopy.ProtoMinor = 1, 1
+	}
+
+	if isResBodyless(req.Method, res.StatusCode) {
+		/**
+		For such responses, "Content-Length" describes the representation rather
+		than the body, and must be preserved. Writing the response as if to a HEAD
+		request keeps the length and omits the body.
+		*/
+		resCopy.Request = &http.Request{Method: http.MethodHead}
+		resCopy.Body = nil
+		resCopy.ContentLength = 0
+		size, err := strconv.ParseInt(res.Header.Get(`Content-Length`), 10, 64)
+		if err == nil && size > 0 {
+			resCopy.ContentLength = size
+		}
+	} else {
+		resCopy.ContentLength = int64(len(resBody))
+		resCopy.Body = NewBytesReadCloser(resBody)
+	}
+	(*Res)(&resCopy).Write(out)
+	return
+}
+
+func (self *Cassette) redact(head http.Header) http.Header {
+	for _, key := range self.Redact {
+		if Head(head).Has(key) {
+			head = Head(head).Set(key, Redacted).Header()
+		}
+	}
+	return head
+}
+
+// Must be called under lock.
+func (self *Cassette) load() error {
+	if self.init {
+		return nil
+	}
+	self.init = true
+
+	if self.Path == `` {
+		return fmt.Errorf(`missing file path`)
+	}
+
+	if self.Mode == CassetteRecord {
+		return truncate(self.Path)
+	}
+
+	chunk, err := os.ReadFile(self.Path)
+	if err != nil {
+		if self.Mode == CassetteAuto && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	self.replay = true
+	self.entries, err = parseCassette(chunk)
+	return err
+}
+
+// Must be called under lock.
+func (self *Cassette) find(key cassetteKey, body []byte) []byte {
+	var last *cassetteEntry
+
+	for ind := range self.entries {
+		entry := &self.entries[ind]
+		if entry.key != key || (self.Body && !bytes.Equal(entry.body, body)) {
+			continue
+		}
+		if !entry.used {
+			entry.used = true
+			return entry.res
+		}
+		last = entry
+	}
+
+	if last != nil {
+		return last.res
+	}
+	return nil
+}
+
+func parseCassette(chunk []byte) (out []cassetteEntry, _ error) {
+	src := bytes.NewReader(chunk)
+	read := bufio.NewReader(src)
+	pos := func() int { return len(chunk) - src.Len() - read.Buffered() }
+
+	for {
+		if skipNewlines(read) == io.EOF {
+			return out, nil
+		}
+
+		req, err := http.ReadRequest(read)
+		if err != nil {
+			return out, fmt.Errorf(`failed to read recorded request: %w`, err)
+		}
+
+		body, err := readAllClose(req.Body)
+		if err != nil {
+			return out, fmt.Errorf(`failed to read recorded request body: %w`, err)
+		}
+
+		_ = skipNewlines(read)
+
+		start := pos()
+		res, err := http.ReadResponse(read, req)
+		if err != nil {
+			return out, fmt.Errorf(`failed to read recorded response: %w`, err)
+		}
+
+		_, err = readAllClose(res.Body)
+		if err != nil {
+			return out, fmt.Errorf(`failed to read recorded response body: %w`, err)
+		}
+		end := pos()
+
+		out = append(out, cassetteEntry{
+			key:  cassetteKeyOf(req.Method, req.Host, req.URL),
+			body: body,
+			res:  chunk[start:end],
+		})
+	}
+}
+
+func readCassetteRes(chunk []byte, req *http.Request) (*http.Response, error) {
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(chunk)), req)
+	if err != nil {
+		return nil, errCassette(err)
+	}
+
+	body, err := readAllClose(res.Body)
+	if err != nil {
+		return nil, errCassette(err)
+	}
+
+	res.Body = NewBytesReadCloser(body)
+	return res, nil
+}
+
+func cassetteKeyOf(method, host string, val *url.URL) cassetteKey {
+	if method == `` {
+		method = http.MethodGet
+	}
+	if host == `` {
+		host = val.Host
+	}
+
+	// Matches `http.Request.Write`, which writes an empty path as "/".
+	path := val.EscapedPath()
+	if path == `` {
+		path = `/`
+	}
+
+	query, _ := url.ParseQuery(val.RawQuery)
+
+	return cassetteKey{
+		method: method,
+		host:   host,
+		path:   path,
+		query:  query.Encode(),
+	}
+}
+
+/*
+True if the response has no body regardless of its headers: responses to HEAD,
+and 1xx, 204 and 304 responses.
+*/
+func isResBodyless(method string, status int) bool {
+	return method == http.MethodHead ||
+		(status >= 100 && status < 200) ||
+		status == http.StatusNoContent ||
+		status == http.StatusNotModified
+}
+
+func errCassette(err error) error {
+	return fmt.Errorf(`[gr] cassette failure: %w`, err)
+}
+
+/*
+Reads the request body, if any, closing it as required by the
+`http.RoundTripper` contract. Doesn't modify the request.
+*/
+func readReqBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	return readAllClose(req.Body)
+}
+
+// Sets the given chunk as the body of a request owned by the caller.
+func setReqBody(req *http.Request, body []byte) {
+	(*Req)(req).Bytes(body)
+	if len(body) == 0 {
+		req.Body = http.NoBody
+	}
+}
+
+func readAllClose(body io.ReadCloser) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func skipNewlines(read *bufio.Reader) error {
+	for {
+		char, err := read.ReadByte()
+		if err != nil {
+			return err
+		}
+		if char != '\r' && char != '\n' {
+			return read.UnreadByte()
+		}
+	}
+}
+
+func appendFile(path string, chunk []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(chunk)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func truncate(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,160 @@
+package gr
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+Sets the header "If-None-Match" to the given entity tags, comma-separated.
+Tags without quotes are quoted, while quoted and weak tags such as `W/"one"`
+are used as-is. The special value "*" matches any representation. Empty tags
+are ignored. If no tags remain, deletes the header. Typically used with a
+saved `(*gr.Res).Etag` for GET requests; see `(*gr.Res).NotModified`. Mutates
+and returns the receiver.
+*/
+func (self *Req) IfNoneMatch(vals ...string) *Req {
+	return self.headEtags(`If-None-Match`, vals)
+}
+
+/*
+Sets the header "If-Match" to the given entity tags, following the same rules
+as `(*gr.Req).IfNoneMatch`. Typically used with a saved `(*gr.Res).Etag` for
+PUT, PATCH and DELETE requests, for optimistic concurrency; see
+`(*gr.Res).PreconditionFailed`. Mutates and returns the receiver.
+*/
+func (self *Req) IfMatch(vals ...string) *Req {
+	return self.headEtags(`If-Match`, vals)
+}
+
+/*
+Sets the header "If-Modified-Since" to the given time in the HTTP date format,
+as UTC with a precision of one second. If the time is zero, deletes the header.
+Typically used with a saved `(*gr.Res).LastModified`. Mutates and returns the
+receiver.
+*/
+func (self *Req) IfModifiedSince(val time.Time) *Req {
+	return self.headTime(`If-Modified-Since`, val)
+}
+
+/*
+Sets the header "If-Unmodified-Since" to the given time, following the same
+rules as `(*gr.Req).IfModifiedSince`. Mutates and returns the receiver.
+*/
+func (self *Req) IfUnmodifiedSince(val time.Time) *Req {
+	return self.headTime(`If-Unmodified-Since`, val)
+}
+
+func (self *Req) headEtags(key string, vals []string) *Req {
+	var buf []byte
+	for _, val := range vals {
+		val = quoteEtag(strings.TrimSpace(val))
+		if val == `` {
+			continue
+		}
+		if len(buf) > 0 {
+			buf = append(buf, `, `...)
+		}
+		buf = append(buf, val...)
+	}
+
+	if len(buf) == 0 {
+		return self.HeadDel(key)
+	}
+	return self.HeadSet(key, string(buf))
+}
+
+func (self *Req) headTime(key string, val time.Time) *Req {
+	if val.IsZero() {
+		return self.HeadDel(key)
+	}
+	return self.HeadSet(key, val.UTC().Format(http.TimeFormat))
+}
+
+// True if response status code is 304 Not Modified.
+func (self *Res) IsNotModified() bool { return self.StatusCode == http.StatusNotModified }
+
+// True if response status code is 412 Precondition Failed.
+func (self *Res) IsPreconditionFailed() bool {
+	return self.StatusCode == http.StatusPreconditionFailed
+}
+
+/*
+For responses to conditional requests such as those using
+`(*gr.Req).IfNoneMatch`. If the response is 304 Not Modified, closes the body
+and returns true, meaning the previously saved representation is still valid.
+If the response is "ok", returns false without closing the body. Otherwise
+panics like `(*gr.Res).Ok`. Usage:
+
+	res := gr.To(url).IfNoneMatch(etag).Res()
+	if !res.NotModified() {
+		res.Json(&val)
+		etag = res.Etag()
+	}
+*/
+func (self *Res) NotModified() bool {
+	if self.IsNotModified() {
+		self.Done()
+		return true
+	}
+	self.Ok()
+	return false
+}
+
+// Non-panicking version of `(*gr.Res).NotModified`.
+func (self *Res) NotModifiedCatch() (_ bool, err error) {
+	defer rec(&err)
+	return self.NotModified(), nil
+}
+
+/*
+For responses to conditional requests such as those using `(*gr.Req).IfMatch`.
+If the response is 412 Precondition Failed, closes the body and returns true,
+meaning the resource was modified by someone else, and the caller should fetch
+it again before retrying. If the response is "ok", returns false without
+closing the body. Otherwise panics like `(*gr.Res).Ok`. Usage:
+
+	res := gr.To(url).Put().IfMatch(etag).Json(val).Res()
+	if res.PreconditionFailed() {
+		// Refetch, merge, retry.
+	}
+	defer res.Done()
+*/
+func (self *Res) PreconditionFailed() bool {
+	if self.IsPreconditionFailed() {
+		self.Done()
+		return true
+	}
+	self.Ok()
+	return false
+}
+
+// Non-panicking version of `(*gr.Res).PreconditionFailed`.
+func (self *Res) PreconditionFailedCatch() (_ bool, err error) {
+	defer rec(&err)
+	return self.PreconditionFailed(), nil
+}
+
+/*
+Returns the response header "ETag" as-is, including quotes and the weak prefix
+"W/", if any. Suitable for `(*gr.Req).IfNoneMatch` and `(*gr.Req).IfMatch`.
+*/
+func (self *Res) Etag() string { return Head(self.Header).Get(`Etag`) }
+
+/*
+Parses the response header "Last-Modified" via `http.ParseTime`. Returns a zero
+time if the header is missing or invalid. Suitable for
+`(*gr.Req).IfModifiedSince` and `(*gr.Req).IfUnmodifiedSince`.
+*/
+func (self *Res) LastModified() time.Time {
+	out, _ := http.ParseTime(Head(self.Header).Get(`Last-Modified`))
+	return out
+}
+
+func quoteEtag(val string) string {
+	if val == `` || val == `*` || strings.HasPrefix(val, `"`) || strings.HasPrefix(val, `W/"`) {
+		return val
+	}
+	return `"` + val + `"`
+}
@@ -0,0 +1,544 @@
+package gr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+Returns a shell command line for curl that performs the same request, covering
+the method, URL, headers, and body. Arguments are quoted for POSIX shells. Uses
+`(*gr.Req).CloneBody`, which leaves the request usable. The body is passed via
+"--data-binary", which sends it as-is; bodies which contain NUL bytes can't be
+represented on a command line and are mangled by shells. Because curl sends
+POST when given a body, the method is included for every request with a body,
+including GET. Headers are sorted by key for deterministic output. Example
+output:
+
+	curl -X POST 'https://example.com/path?one=two' -H 'Content-Type: application/json' --data-binary '{"three":4}'
+*/
+func (self *Req) Curl() string {
+	var chunk []byte
+	body := self.CloneBody()
+	if body != nil {
+		var err error
+		chunk, err = readAllClose(body)
+		if err != nil {
+			panic(errReqBodyClone(err))
+		}
+	}
+
+	var buf strings.Builder
+	buf.WriteString(`curl`)
+
+	// With a body, curl defaults to POST, so GET must be explicit.
+	meth := self.Method
+	if meth == `` {
+		meth = http.MethodGet
+	}
+	if meth != http.MethodGet || len(chunk) > 0 {
+		buf.WriteString(` -X `)
+		buf.WriteString(shellQuote(meth))
+	}
+
+	if self.URL != nil {
+		buf.WriteString(` `)
+		buf.WriteString(shellQuote(self.URL.String()))
+	}
+
+	keys := make([]string, 0, len(self.Header))
+	for key := range self.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, val := range self.Header[key] {
+			buf.WriteString(` -H `)
+			if val == `` {
+				buf.WriteString(shellQuote(key + `;`))
+			} else {
+				buf.WriteString(shellQuote(key + `: ` + val))
+			}
+		}
+	}
+
+	if len(chunk) > 0 {
+		buf.WriteString(` --data-binary `)
+		buf.WriteString(shellQuote(bytesString(chunk)))
+	}
+
+	return buf.String()
+}
+
+/*
+Parses a curl command line into a new request, splitting arguments like a POSIX
+shell. The leading "curl" is optional. Supports the following options:
+
+	-X, --request          -> method
+	-H, --header           -> header; "Key:" deletes, "Key;" sets empty
+	-d, --data, --data-ascii, --data-binary, --data-raw
+	                       -> body, "&"-joined, form-encoded by default
+	--data-urlencode       -> like "--data", but URL-encodes the content
+	--json                 -> JSON body, with "Content-Type" and "Accept"
+	-F, --form             -> multipart field, or file via "@path"
+	-u, --user             -> basic authorization
+	-I, --head             -> "HEAD" method
+	--url                  -> URL, which may also be positional
+
+Data options default the method to "POST". Like curl, "--data" and
+"--data-urlencode" read "@path" arguments from files; "-F" supports
+"name=@path" with optional ";type=" and ";filename=", and "name=<path" for text
+fields read from files. Some common options that don't affect the request, such
+as "-s", "-L", "-k", "-v" and "--compressed", are ignored. Panics on unknown
+options and invalid input.
+*/
+func ParseCurl(src string) *Req {
+	args, err := shellSplit(src)
+	if err != nil {
+		panic(errCurl(err))
+	}
+
+	var curl curlParse
+	err = curl.parse(args)
+	if err != nil {
+		panic(errCurl(err))
+	}
+	return curl.req()
+}
+
+// Non-panicking version of `gr.ParseCurl`.
+func ParseCurlCatch(src string) (_ *Req, err error) {
+	defer rec(&err)
+	return ParseCurl(src), nil
+}
+
+func errCurl(err error) error {
+	return fmt.Errorf(`[gr] failed to parse curl command: %w`, err)
+}
+
+type curlParse struct {
+	method  string
+	url     string
+	head    Head
+	data    []string
+	json    bool
+	multi   *Multi
+	user    string
+	hasUser bool
+}
+
+// Options which are accepted and ignored because they don't affect requests.
+var curlIgnored = map[string]bool{
+	`-s`: true, `--silent`: true, `-S`: true, `--show-error`: true,
+	`-L`: true, `--location`: true, `-k`: true, `--insecure`: true,
+	`-v`: true, `--verbose`: true, `-i`: true, `--include`: true,
+	`--compressed`: true, `-f`: true, `--fail`: true, `-sS`: true,
+	`-sL`: true, `-sSL`: true,
+}
+
+func (self *curlParse) parse(args []string) error {
+	if len(args) > 0 && args[0] == `curl` {
+		args = args[1:]
+	}
+
+	for len(args) > 0 {
+		arg := args[0]
+		args = args[1:]
+
+		if arg == `` || arg[0] != '-' {
+			if self.url != `` {
+				return fmt.Errorf(`unexpected argument %q`, arg)
+			}
+			self.url = arg
+			continue
+		}
+
+		if curlIgnored[arg] {
+			continue
+		}
+
+		key, val, inline := curlSplitOpt(arg)
+
+		if key == `-I` || key == `--head` {
+			self.method = http.MethodHead
+			continue
+		}
+
+		if !inline {
+			if len(args) == 0 {
+				return fmt.Errorf(`missing value for option %q`, key)
+			}
+			val = args[0]
+			args = args[1:]
+		}
+
+		err := self.opt(key, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	if self.url == `` {
+		return fmt.Errorf(`missing URL`)
+	}
+	if self.multi != nil && self.data != nil {
+		return fmt.Errorf(`can't combine form and data options`)
+	}
+	return nil
+}
+
+func (self *curlParse) opt(key, val string) error {
+	switch key {
+	case `-X`, `--request`:
+		self.method = val
+
+	case `--url`:
+		self.url = val
+
+	case `-H`, `--header`:
+		return self.header(val)
+
+	case `-d`, `--data`, `--data-ascii`:
+		chunk, err := curlReadArg(val, true)
+		if err != nil {
+			return err
+		}
+		self.data = append(self.data, chunk)
+
+	case `--data-binary`:
+		chunk, err := curlReadArg(val, false)
+		if err != nil {
+			return err
+		}
+		self.data = append(self.data, chunk)
+
+	case `--data-raw`:
+		self.data = append(self.data, val)
+
+	case `--data-urlencode`:
+		chunk, err := curlUrlEncode(val)
+		if err != nil {
+			return err
+		}
+		self.data = append(self.data, chunk)
+
+	case `--json`:
+		chunk, err := curlReadArg(val, false)
+		if err != nil {
+			return err
+		}
+		self.json = true
+		self.data = append(self.data, chunk)
+
+	case `-F`, `--form`:
+		return self.form(val)
+
+	case `-u`, `--user`:
+		self.user = val
+		self.hasUser = true
+
+	default:
+		return fmt.Errorf(`unsupported option %q`, key)
+	}
+	return nil
+}
+
+func (self *curlParse) header(src string) error {
+	ind := strings.IndexAny(src, `:;`)
+	if ind <= 0 {
+		return fmt.Errorf(`invalid header %q`, src)
+	}
+
+	key := strings.TrimSpace(src[:ind])
+	val := strings.TrimSpace(src[ind+1:])
+
+	if src[ind] == ';' {
+		if val != `` {
+			return fmt.Errorf(`invalid header %q`, src)
+		}
+		self.head = self.head.Add(key, ``)
+		return nil
+	}
+
+	// An empty slice makes `gr.Head.Patch` delete the header.
+	if val == `` {
+		self.head = self.head.Init()
+		self.head[canonKey(key)] = []string{}
+		return nil
+	}
+	self.head = self.head.Add(key, val)
+	return nil
+}
+
+func (self *curlParse) form(src string) error {
+	ind := strings.IndexByte(src, '=')
+	if ind <= 0 {
+		return fmt.Errorf(`invalid form field %q`, src)
+	}
+	key, val := src[:ind], src[ind+1:]
+
+	if self.multi == nil {
+		self.multi = new(Multi)
+	}
+
+	if strings.HasPrefix(val, `<`) {
+		chunk, err := os.ReadFile(val[1:])
+		if err != nil {
+			return err
+		}
+		self.multi.Field(key, string(chunk))
+		return nil
+	}
+
+	if !strings.HasPrefix(val, `@`) {
+		self.multi.Field(key, val)
+		return nil
+	}
+
+	opts := strings.Split(val[1:], `;`)
+	path := opts[0]
+	opts = opts[1:]
+
+	if len(opts) == 0 {
+		_, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		self.multi.File(key, path)
+		return nil
+	}
+
+	name, typ := ``, ``
+	for _, opt := range opts {
+		switch {
+		case strings.HasPrefix(opt, `type=`):
+			typ = strings.TrimPrefix(opt, `type=`)
+		case strings.HasPrefix(opt, `filename=`):
+			name = strings.TrimPrefix(opt, `filename=`)
+		default:
+			return fmt.Errorf(`unsupported form option %q`, opt)
+		}
+	}
+
+	chunk, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if name == `` {
+		name = filepath.Base(path)
+	}
+	head := Head(multiFileHead(key, name))
+	if typ != `` {
+		head = head.Set(Type, typ)
+	}
+
+	self.multi.Part(head, bytes.NewReader(chunk))
+	return nil
+}
+
+func (self *curlParse) req() *Req {
+	req := new(Req).To(curlUrl(self.url))
+	req.Method = http.MethodGet
+
+	if self.multi != nil {
+		req.Method = http.MethodPost
+		req = req.Multi(self.multi)
+	} else if self.data != nil {
+		req.Method = http.MethodPost
+		if self.json {
+			req = req.String(strings.Join(self.data, ``))
+			req = req.TypeJson().HeadSet(`Accept`, TypeJson)
+		} else {
+			req = req.String(strings.Join(self.data, `&`))
+			req = req.TypeForm()
+		}
+	}
+
+	if self.hasUser {
+		req = req.HeadSet(
+			`Authorization`,
+			`Basic `+base64.StdEncoding.EncodeToString(stringBytes(self.user)),
+		)
+	}
+
+	req = req.HeadPatch(self.head)
+
+	if self.method != `` {
+		req.Method = self.method
+	}
+	return req
+}
+
+// Like curl, assumes "http" when the URL has no scheme.
+func curlUrl(src string) string {
+	if !strings.Contains(src, `://`) {
+		return `http://` + src
+	}
+	return src
+}
+
+/*
+Splits "--key=val" into key and value. Short options may have their value
+attached, like "-XPOST". Long options without "=" and short options without
+attached values return false.
+*/
+func curlSplitOpt(src string) (string, string, bool) {
+	if strings.HasPrefix(src, `--`) {
+		ind := strings.IndexByte(src, '=')
+		if ind > 0 {
+			return src[:ind], src[ind+1:], true
+		}
+		return src, ``, false
+	}
+	if len(src) > 2 {
+		return src[:2], src[2:], true
+	}
+	return src, ``, false
+}
+
+/*
+Reads "@path" arguments from files. For "--data", curl strips carriage returns
+and newlines from file content.
+*/
+func curlReadArg(src string, strip bool) (string, error) {
+	if !strings.HasPrefix(src, `@`) {
+		return src, nil
+	}
+
+	chunk, err := os.ReadFile(src[1:])
+	if err != nil {
+		return ``, err
+	}
+
+	out := string(chunk)
+	if strip {
+		out = strings.NewReplacer("\r", ``, "\n", ``).Replace(out)
+	}
+	return out, nil
+}
+
+/*
+Implements the argument forms of "--data-urlencode": "content", "=content",
+"name=content", "@path", and "name@path".
+*/
+func curlUrlEncode(src string) (string, error) {
+	eqInd := strings.IndexByte(src, '=')
+	atInd := strings.IndexByte(src, '@')
+
+	if eqInd >= 0 && (atInd < 0 || eqInd < atInd) {
+		name, val := src[:eqInd], url.QueryEscape(src[eqInd+1:])
+		if name == `` {
+			return val, nil
+		}
+		return name + `=` + val, nil
+	}
+
+	if atInd >= 0 {
+		chunk, err := os.ReadFile(src[atInd+1:])
+		if err != nil {
+			return ``, err
+		}
+		name, val := src[:atInd], url.QueryEscape(string(chunk))
+		if name == `` {
+			return val, nil
+		}
+		return name + `=` + val, nil
+	}
+
+	return url.QueryEscape(src), nil
+}
+
+/*
+Quotes the input for POSIX shells. Inputs which consist only of safe characters
+are returned as-is.
+*/
+func shellQuote(src string) string {
+	if src != `` && strings.Trim(src, shellSafe) == `` {
+		return src
+	}
+	return `'` + strings.ReplaceAll(src, `'`, `'\''`) + `'`
+}
+
+const shellSafe = `abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-`
+
+/*
+Splits a command line into arguments, following the quoting rules of POSIX
+shells: single quotes, double quotes with backslash escapes, backslash escapes
+outside of quotes, and line continuations. Doesn't perform expansions.
+*/
+func shellSplit(src string) ([]string, error) {
+	var out []string
+	var buf strings.Builder
+	var has bool
+
+	for ind := 0; ind < len(src); ind++ {
+		char := src[ind]
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			if has {
+				out = append(out, buf.String())
+				buf.Reset()
+				has = false
+			}
+
+		case char == '\\':
+			ind++
+			if ind >= len(src) {
+				return nil, fmt.Errorf(`unexpected trailing backslash`)
+			}
+			if src[ind] == '\n' {
+				continue
+			}
+			if src[ind] == '\r' && ind+1 < len(src) && src[ind+1] == '\n' {
+				ind++
+				continue
+			}
+			buf.WriteByte(src[ind])
+			has = true
+
+		case char == '\'':
+			end := strings.IndexByte(src[ind+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf(`unterminated single quote`)
+			}
+			buf.WriteString(src[ind+1 : ind+1+end])
+			ind += end + 1
+			has = true
+
+		case char == '"':
+			ind++
+			for ; ind < len(src) && src[ind] != '"'; ind++ {
+				if src[ind] == '\\' && ind+1 < len(src) && strings.IndexByte("$`\"\\\n", src[ind+1]) >= 0 {
+					ind++
+					if src[ind] == '\n' {
+						continue
+					}
+				}
+				buf.WriteByte(src[ind])
+			}
+			if ind >= len(src) {
+				return nil, fmt.Errorf(`unterminated double quote`)
+			}
+			has = true
+
+		default:
+			buf.WriteByte(char)
+			has = true
+		}
+	}
+
+	if has {
+		out = append(out, buf.String())
+	}
+	return out, nil
+}
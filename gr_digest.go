@@ -0,0 +1,369 @@
+package gr
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+/*
+Transport implementing HTTP Digest authentication, as defined by RFC 7616, with
+the credentials `.User` and `.Pass`. When the server responds with 401
+Unauthorized and "WWW-Authenticate: Digest ...", the transport answers the
+challenge and repeats the request once, obtaining a fresh copy of the body
+from `.GetBody`, which is set by `(*gr.Req).String`, `(*gr.Req).Bytes` and
+related methods. Requests whose body can't be replayed are not repeated, and
+the 401 response is returned as-is.
+
+Supports the algorithms "MD5", "SHA-256" and "SHA-512-256", their "-sess"
+variants, the quality of protection "auth" and "auth-int", and "userhash".
+When the server offers several challenges, uses the first supported one. When
+the challenge offers both "auth" and "auth-int", uses "auth".
+
+The last challenge of each host is remembered, and subsequent requests to that
+host are authorized preemptively, incrementing the nonce count, which avoids a
+round trip. When the server rejects a remembered nonce, for example because it
+became stale, the transport answers the new challenge.
+
+Usable as `http.Client.Transport` or `gr.Cli.Transport`. To wrap another
+transport, use `(*gr.Digest).Mid` as a `gr.Mid`. Safe for concurrent use. Must
+not be copied after first use.
+*/
+type Digest struct {
+	User string
+	Pass string
+
+	lock  sync.Mutex
+	chals map[string]*digestChal
+}
+
+// Implement `http.RoundTripper`, sending requests via `http.DefaultTransport`.
+func (self *Digest) RoundTrip(req *http.Request) (*http.Response, error) {
+	return self.roundTrip(http.DefaultTransport, req)
+}
+
+/*
+Implements `gr.Mid`. Returns a transport which authorizes requests and sends
+them via the given transport, or `http.DefaultTransport` if nil. Usage:
+
+	cli := new(gr.Cli).Use(digest.Mid)
+*/
+func (self *Digest) Mid(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return Trans(func(req *http.Request) (*http.Response, error) {
+		return self.roundTrip(next, req)
+	})
+}
+
+func (self *Digest) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	key := digestKey(req.URL)
+
+	out := req
+	chal := self.chal(key)
+	if chal != nil {
+		var err error
+		out, err = self.authorize(req, chal)
+		if err != nil {
+			if req.Body != nil {
+				_ = req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+
+	res, err := next.RoundTrip(out)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || !(*Req)(req).isReplayable() {
+		return res, err
+	}
+
+	chal = parseDigestChal(res.Header)
+	if chal == nil {
+		return res, nil
+	}
+	(*Res)(res).Done()
+	self.setChal(key, chal)
+
+	out, err = self.authorize(req, chal)
+	if err != nil {
+		return nil, err
+	}
+	if out.GetBody != nil {
+		out.Body, err = out.GetBody()
+		if err != nil {
+			return nil, errReqBodyClone(err)
+		}
+	}
+	return next.RoundTrip(out)
+}
+
+func (self *Digest) chal(key string) *digestChal {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.chals[key]
+}
+
+func (self *Digest) setChal(key string, val *digestChal) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.chals == nil {
+		self.chals = map[string]*digestChal{}
+	}
+	self.chals[key] = val
+}
+
+func (self *Digest) count(chal *digestChal) uint32 {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	chal.count++
+	return chal.count
+}
+
+// Returns a clone of the request with the header "Authorization".
+func (self *Digest) authorize(req *http.Request, chal *digestChal) (*http.Request, error) {
+	var bodyHash string
+	if chal.qop == `auth-int` {
+		body, err := digestBody(req)
+		if err != nil {
+			return nil, errDigest(err)
+		}
+		bodyHash = chal.hash(body)
+	}
+
+	cnonce, err := digestCnonce()
+	if err != nil {
+		return nil, errDigest(err)
+	}
+
+	out := (*Req)(req.Clone(req.Context()))
+	out.Auth(chal.answer(self.User, self.Pass, req.Method, req.URL.RequestURI(), bodyHash, cnonce, self.count(chal)))
+	return out.Req(), nil
+}
+
+// Parsed "WWW-Authenticate: Digest" challenge.
+type digestChal struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	userhash  bool
+	sess      bool
+	newHash   func() hash.Hash
+	count     uint32
+}
+
+func (self *digestChal) hash(val string) string {
+	out := self.newHash()
+	_, _ = io.WriteString(out, val)
+	return hex.EncodeToString(out.Sum(nil))
+}
+
+/*
+Returns the value of the header "Authorization" answering the challenge, as
+described in RFC 7616 section 3.4.
+*/
+func (self *digestChal) answer(user, pass, meth, uri, bodyHash, cnonce string, count uint32) string {
+	nc := fmt.Sprintf(`%08x`, count)
+
+	ha1 := self.hash(user + `:` + self.realm + `:` + pass)
+	if self.sess {
+		ha1 = self.hash(ha1 + `:` + self.nonce + `:` + cnonce)
+	}
+
+	a2 := meth + `:` + uri
+	if self.qop == `auth-int` {
+		a2 += `:` + bodyHash
+	}
+	ha2 := self.hash(a2)
+
+	var res string
+	if self.qop == `` {
+		res = self.hash(ha1 + `:` + self.nonce + `:` + ha2)
+	} else {
+		res = self.hash(ha1 + `:` + self.nonce + `:` + nc + `:` + cnonce + `:` + self.qop + `:` + ha2)
+	}
+
+	if self.userhash {
+		user = self.hash(user + `:` + self.realm)
+	}
+
+	var buf strings.Builder
+	buf.WriteString(`Digest username=`)
+	buf.WriteString(digestQuote(user))
+	buf.WriteString(`, realm=`)
+	buf.WriteString(digestQuote(self.realm))
+	buf.WriteString(`, uri=`)
+	buf.WriteString(digestQuote(uri))
+	if self.algorithm != `` {
+		buf.WriteString(`, algorithm=`)
+		buf.WriteString(self.algorithm)
+	}
+	buf.WriteString(`, nonce=`)
+	buf.WriteString(digestQuote(self.nonce))
+	if self.qop != `` {
+		buf.WriteString(`, nc=`)
+		buf.WriteString(nc)
+		buf.WriteString(`, cnonce=`)
+		buf.WriteString(digestQuote(cnonce))
+		buf.WriteString(`, qop=`)
+		buf.WriteString(self.qop)
+	}
+	buf.WriteString(`, response=`)
+	buf.WriteString(digestQuote(res))
+	if self.opaque != `` {
+		buf.WriteString(`, opaque=`)
+		buf.WriteString(digestQuote(self.opaque))
+	}
+	if self.userhash {
+		buf.WriteString(`, userhash=true`)
+	}
+	return buf.String()
+}
+
+/*
+Returns the first supported Digest challenge among all "WWW-Authenticate"
+headers, or nil if none. Each header may contain multiple challenges of
+different schemes, separated by commas.
+*/
+func parseDigestChal(head http.Header) *digestChal {
+	for _, val := range Head(head).Values(`WWW-Authenticate`) {
+		var params map[string]string
+
+		for _, part := range splitCacheControl(val) {
+			part = strings.TrimSpace(part)
+			if part == `` {
+				continue
+			}
+
+			// A new challenge begins with a scheme, optionally followed by a param.
+			scheme, rest, _ := cut(part, ` `)
+			if !strings.Contains(scheme, `=`) && !strings.HasPrefix(strings.TrimSpace(rest), `=`) {
+				out := newDigestChal(params)
+				if out != nil {
+					return out
+				}
+
+				params = nil
+				if strings.EqualFold(scheme, `Digest`) {
+					params = map[string]string{}
+				}
+				part = strings.TrimSpace(rest)
+			}
+
+			if params != nil {
+				key, val, _ := cut(part, `=`)
+				params[strings.ToLower(strings.TrimSpace(key))] = unquote(strings.TrimSpace(val))
+			}
+		}
+
+		out := newDigestChal(params)
+		if out != nil {
+			return out
+		}
+	}
+	return nil
+}
+
+func newDigestChal(params map[string]string) *digestChal {
+	if params == nil || params[`nonce`] == `` {
+		return nil
+	}
+
+	out := &digestChal{
+		realm:     params[`realm`],
+		nonce:     params[`nonce`],
+		opaque:    params[`opaque`],
+		algorithm: params[`algorithm`],
+		userhash:  strings.EqualFold(params[`userhash`], `true`),
+	}
+
+	alg := strings.ToUpper(out.algorithm)
+	if strings.HasSuffix(alg, `-SESS`) {
+		out.sess = true
+		alg = strings.TrimSuffix(alg, `-SESS`)
+	}
+
+	switch alg {
+	case ``, `MD5`:
+		out.newHash = md5.New
+	case `SHA-256`:
+		out.newHash = sha256.New
+	case `SHA-512-256`:
+		out.newHash = sha512.New512_256
+	default:
+		return nil
+	}
+
+	if params[`qop`] != `` {
+		for _, val := range strings.Split(params[`qop`], `,`) {
+			val = strings.ToLower(strings.TrimSpace(val))
+			if val == `auth` || (val == `auth-int` && out.qop == ``) {
+				out.qop = val
+			}
+		}
+		if out.qop == `` {
+			return nil
+		}
+	}
+
+	// Without "qop", there's no "cnonce" for session algorithms.
+	if out.sess && out.qop == `` {
+		return nil
+	}
+	return out
+}
+
+// Protection space used for preemptive authorization.
+func digestKey(val *url.URL) string {
+	if val == nil {
+		return ``
+	}
+	return val.Scheme + `://` + val.Host
+}
+
+func digestBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ``, nil
+	}
+	if req.GetBody == nil {
+		return ``, fmt.Errorf(`qop "auth-int" requires a body that can be replayed via "GetBody"`)
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return ``, errReqBodyClone(err)
+	}
+	defer body.Close()
+
+	out, err := io.ReadAll(body)
+	return bytesString(out), err
+}
+
+func digestCnonce() (string, error) {
+	var buf [16]byte
+	_, err := rand.Read(buf[:])
+	return hex.EncodeToString(buf[:]), err
+}
+
+var digestEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Encodes a quoted string as defined by RFC 9110.
+func digestQuote(val string) string {
+	return `"` + digestEscaper.Replace(val) + `"`
+}
+
+func errDigest(err error) error {
+	return fmt.Errorf(`[gr] failed to authorize via HTTP Digest: %w`, err)
+}
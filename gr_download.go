@@ -0,0 +1,321 @@
+package gr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+Options for `(*gr.Req).Download`.
+
+	* `.Path` is the destination file. Required.
+	* `.Sha256` is the expected SHA-256 of the entire file, hex-encoded.
+	  Optional.
+	* If `.Digest` is true, the SHA-256 of the entire file is verified against
+	  the response headers "Repr-Digest" (RFC 9530) or "Digest" (RFC 3230), or
+	  for complete responses, "Content-Digest", if any of them are present and
+	  include SHA-256. Skipped for responses decompressed by the transport,
+	  since the headers describe the compressed content.
+*/
+type Download struct {
+	Path   string
+	Sha256 string
+	Digest bool
+}
+
+/*
+Downloads the response body into the file at `opt.Path`, streaming it without
+buffering the entire body in memory. Returns the size of the file. The
+receiver is used as a template and is not modified. Panics on errors; see
+`(*gr.Req).DownloadCatch`.
+
+The body is written into the temporary file `opt.Path + ".part"`, which is
+renamed into place only after the download is complete and verified. If the
+download is interrupted, for example by a transport error or context
+cancellation, the temporary file is kept, and the next download into the same
+path resumes it by requesting the remaining bytes via "Range". To ensure that
+the resumed content matches, resuming requires a strong "ETag" or a
+"Last-Modified" from the first response, which is stored in the file
+`opt.Path + ".part.meta"` and sent via "If-Range". When the server responds
+with 206 Partial Content, "Content-Range" must start at the size of the
+temporary file. When the server responds with 200 OK, for example because the
+resource has changed, the download starts over.
+
+Unless the receiver specifies "Accept-Encoding", requests "Accept-Encoding:
+identity", which prevents transparent decompression by `http.Transport`. This
+ensures that the file, its size, the ranges used for resuming, and the digests
+in the response headers all describe the same bytes.
+
+Non-OK responses cause panics, with errors from `(*gr.Res).Ok`. If the
+verification of the file size or digest fails, deletes the temporary files.
+*/
+func (self *Req) Download(opt Download) int64 {
+	if opt.Path == `` {
+		panic(errDownload(opt.Path, errors.New(`missing file path`)))
+	}
+
+	dl := downloader{req: self, opt: opt, temp: opt.Path + `.part`}
+	dl.meta = dl.temp + `.meta`
+
+	if opt.Sha256 != `` {
+		var err error
+		dl.sha256, err = hex.DecodeString(strings.TrimSpace(opt.Sha256))
+		if err != nil {
+			panic(dl.err(fmt.Errorf(`invalid SHA-256 %q: %w`, opt.Sha256, err)))
+		}
+	}
+
+	size, ok := dl.run(true)
+	if !ok {
+		size, _ = dl.run(false)
+	}
+	return size
+}
+
+// Non-panicking version of `(*gr.Req).Download`.
+func (self *Req) DownloadCatch(opt Download) (_ int64, err error) {
+	defer rec(&err)
+	return self.Download(opt), nil
+}
+
+type downloader struct {
+	req    *Req
+	opt    Download
+	temp   string
+	meta   string
+	sha256 []byte
+}
+
+/*
+Returns false if the partial download can't be resumed and the caller should
+start over.
+*/
+func (self downloader) run(resume bool) (int64, bool) {
+	var offset int64
+	var validator string
+	if resume {
+		offset, validator = self.partial()
+	}
+
+	req := self.req.Clone()
+	if req.Header.Get(`Accept-Encoding`) == `` {
+		req.HeadSet(`Accept-Encoding`, `identity`)
+	}
+	if offset > 0 {
+		req.HeadSet(`Range`, `bytes=`+strconv.FormatInt(offset, 10)+`-`).HeadSet(`If-Range`, validator)
+	}
+
+	res := req.Res()
+	defer res.Done()
+
+	var body io.Reader = res.Body
+	total := res.ContentLength
+	full := true
+
+	switch {
+	case offset > 0 && res.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The partial file may already be complete.
+		size, err := strconv.ParseInt(strings.TrimPrefix(res.Header.Get(`Content-Range`), `bytes */`), 10, 64)
+		if err != nil || size != offset {
+			self.cleanup()
+			return 0, false
+		}
+		body, total, full = bytes.NewReader(nil), offset, false
+
+	case res.StatusCode == http.StatusPartialContent:
+		val := res.Header.Get(`Content-Range`)
+		rng, ok := parseContentRange(val)
+		if !ok || offset == 0 || rng.Start != offset {
+			panic(self.err(fmt.Errorf(`unexpected content range %q for offset %v`, val, offset)))
+		}
+		total, full = rng.Size, false
+
+	default:
+		res.Ok()
+		offset = 0
+		self.writeMeta(res)
+	}
+
+	return self.write(res, body, offset, total, full), true
+}
+
+// Returns the size of the partial file and the validator for "If-Range".
+func (self downloader) partial() (int64, string) {
+	meta, err := os.ReadFile(self.meta)
+	if err != nil {
+		return 0, ``
+	}
+
+	info, err := os.Stat(self.temp)
+	if err != nil {
+		return 0, ``
+	}
+
+	validator := strings.TrimSpace(bytesString(meta))
+	if validator == `` {
+		return 0, ``
+	}
+	return info.Size(), validator
+}
+
+// Stores a validator suitable for "If-Range", or deletes a stale one.
+func (self downloader) writeMeta(res *Res) {
+	val := res.Etag()
+	if val == `` || strings.HasPrefix(val, `W/`) {
+		val = res.Header.Get(`Last-Modified`)
+	}
+
+	var err error
+	if val == `` {
+		err = os.Remove(self.meta)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	} else {
+		err = os.WriteFile(self.meta, stringBytes(val), 0666)
+	}
+	if err != nil {
+		panic(self.err(err))
+	}
+}
+
+func (self downloader) write(res *Res, body io.Reader, offset, total int64, full bool) int64 {
+	file, err := os.OpenFile(self.temp, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		panic(self.err(err))
+	}
+	defer file.Close()
+
+	var sum hash.Hash
+	if self.sha256 != nil || self.opt.Digest {
+		sum = sha256.New()
+	}
+
+	out := io.Writer(file)
+	if sum != nil {
+		out = io.MultiWriter(file, sum)
+		_, err = io.CopyN(sum, file, offset)
+	}
+	if err == nil {
+		err = file.Truncate(offset)
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		panic(self.err(err))
+	}
+
+	size, err := io.Copy(out, body)
+	size += offset
+	if err != nil {
+		panic(self.err(err))
+	}
+
+	if total >= 0 && size != total {
+		self.cleanup()
+		panic(self.err(fmt.Errorf(`expected %v bytes, got %v`, total, size)))
+	}
+
+	err = file.Sync()
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		panic(self.err(err))
+	}
+
+	if sum != nil {
+		self.verify(res, sum.Sum(nil), full)
+	}
+
+	err = os.Rename(self.temp, self.opt.Path)
+	if err != nil {
+		panic(self.err(err))
+	}
+	_ = os.Remove(self.meta)
+	return size
+}
+
+func (self downloader) verify(res *Res, sum []byte, full bool) {
+	if self.sha256 != nil {
+		self.verifySum(`SHA-256`, self.sha256, sum)
+	}
+
+	// Digests of decompressed responses describe the compressed content.
+	if self.opt.Digest && !res.Uncompressed {
+		key, exp := resDigestSha256(res, full)
+		if exp != nil {
+			self.verifySum(key, exp, sum)
+		}
+	}
+}
+
+func (self downloader) verifySum(desc string, exp, act []byte) {
+	if !bytes.Equal(exp, act) {
+		self.cleanup()
+		panic(self.err(fmt.Errorf(`%v mismatch: expected %x, got %x`, desc, exp, act)))
+	}
+}
+
+func (self downloader) cleanup() {
+	_ = os.Remove(self.temp)
+	_ = os.Remove(self.meta)
+}
+
+func (self downloader) err(err error) error { return errDownload(self.opt.Path, err) }
+
+func errDownload(path string, err error) error {
+	return fmt.Errorf(`[gr] failed to download to %q: %w`, path, err)
+}
+
+/*
+Finds the SHA-256 of the representation in the response headers. Returns the
+header name and the decoded digest, or nil if not found.
+*/
+func resDigestSha256(res *Res, full bool) (string, []byte) {
+	keys := []string{`Repr-Digest`, `Digest`}
+	if full {
+		keys = append(keys, `Content-Digest`)
+	}
+
+	for _, key := range keys {
+		for _, val := range Head(res.Header).Values(key) {
+			out := parseDigestSha256(val)
+			if out != nil {
+				return key, out
+			}
+		}
+	}
+	return ``, nil
+}
+
+/*
+Supports both the structured format of RFC 9530, such as "sha-256=:<base64>:",
+and the legacy format of RFC 3230, such as "SHA-256=<base64>".
+*/
+func parseDigestSha256(src string) []byte {
+	for _, item := range strings.Split(src, `,`) {
+		key, val, _ := cut(item, `=`)
+		if !strings.EqualFold(strings.TrimSpace(key), `sha-256`) {
+			continue
+		}
+
+		val = strings.Trim(strings.TrimSpace(val), `:`)
+		out, err := base64.StdEncoding.DecodeString(val)
+		if err == nil && len(out) == sha256.Size {
+			return out
+		}
+	}
+	return nil
+}
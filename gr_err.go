@@ -1,27 +1,77 @@
 package gr
 
-import "strconv"
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+)
 
 /*
-Wraps another error, adding an HTTP status code and response body. Some errors
-returned by this package have codes obtained from `http.Response`.
+Wraps another error, adding an HTTP status code, response headers and body, and
+the method and URL of the request. Errors returned by `(*gr.Res).Err` and
+methods such as `(*gr.Res).Ok` have these fields obtained from `http.Response`
+and its `.Request`. Fields are optional; missing data is omitted from the error
+message and from JSON.
+
+To get an `Err` from any error, including wrapped errors and panics recovered
+by "Catch" methods, use `errors.As`:
+
+	var err gr.Err
+	if errors.As(someErr, &err) && err.IsRetryable() {
+		// ...
+	}
 */
 type Err struct {
-	Status int    `json:"status,omitempty"`
-	Body   []byte `json:"body,omitempty"`
-	Cause  error  `json:"cause,omitempty"`
-}
+	Status int         `json:"status,omitempty"`
+	Method string      `json:"method,omitempty"`
+	Url    string      `json:"url,omitempty"`
+	Type   string      `json:"type,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+	Cause  error       `json:"cause,omitempty"`
 
-// ↑ TODO: preserve other response data such as headers. Consider defining a
-// type describing a fully downloaded response.
+	// Decoded from "application/problem+json" bodies. See `gr.Problem`.
+	Problem *Problem `json:"problem,omitempty"`
+}
 
 // Implement a hidden interface in "errors".
 func (self Err) Unwrap() error { return self.Cause }
 
+/*
+Implement a hidden interface in "errors", allowing `errors.As` to find
+`.Problem` when the target is `*gr.Problem` or `**gr.Problem`.
+*/
+func (self Err) As(out interface{}) bool {
+	if self.Problem == nil {
+		return false
+	}
+
+	switch out := out.(type) {
+	case *Problem:
+		*out = *self.Problem
+		return true
+	case **Problem:
+		*out = self.Problem
+		return true
+	default:
+		return false
+	}
+}
+
 // Returns `.Status`. Implements a hidden interface supported by
 // `github.com/mitranim/rout`.
 func (self Err) HttpStatusCode() int { return self.Status }
 
+// True if `.Status` is between 400 and 499 inclusive. See `gr.IsClientErr`.
+func (self Err) IsClientErr() bool { return IsClientErr(self.Status) }
+
+// True if `.Status` is between 500 and 599 inclusive. See `gr.IsServerErr`.
+func (self Err) IsServerErr() bool { return IsServerErr(self.Status) }
+
+// True if `.Status` indicates a transient failure. See `gr.IsRetryable`.
+func (self Err) IsRetryable() bool { return IsRetryable(self.Status) }
+
 // Implement the `error` interface.
 func (self Err) Error() string {
 	return bytesString(self.AppendTo(nil))
@@ -38,6 +88,18 @@ func (self Err) AppendTo(buf []byte) []byte {
 		buf = append(buf, `)`...)
 	}
 
+	if self.Method != `` || self.Url != `` {
+		buf = append(buf, ` in`...)
+		if self.Method != `` {
+			buf = append(buf, ` `...)
+			buf = append(buf, self.Method...)
+		}
+		if self.Url != `` {
+			buf = append(buf, ` `...)
+			buf = append(buf, self.Url...)
+		}
+	}
+
 	cause := self.Cause
 	if cause != nil {
 		buf = append(buf, `: `...)
@@ -52,3 +114,50 @@ func (self Err) AppendTo(buf []byte) []byte {
 	buf = appendBodyPreview(buf, self.Body)
 	return buf
 }
+
+/*
+Implement `json.Marshaler`. `.Cause` is encoded as its message. `.Body` is
+encoded as-is if it's valid JSON, as a string if it's valid UTF-8, and in
+base64 otherwise.
+*/
+func (self Err) MarshalJSON() ([]byte, error) {
+	var cause string
+	if self.Cause != nil {
+		cause = self.Cause.Error()
+	}
+
+	return json.Marshal(errJson{
+		Status:  self.Status,
+		Method:  self.Method,
+		Url:     self.Url,
+		Type:    self.Type,
+		Header:  self.Header,
+		Body:    errJsonBody(self.Body),
+		Cause:   cause,
+		Problem: self.Problem,
+	})
+}
+
+type errJson struct {
+	Status  int         `json:"status,omitempty"`
+	Method  string      `json:"method,omitempty"`
+	Url     string      `json:"url,omitempty"`
+	Type    string      `json:"type,omitempty"`
+	Header  http.Header `json:"header,omitempty"`
+	Body    interface{} `json:"body,omitempty"`
+	Cause   string      `json:"cause,omitempty"`
+	Problem *Problem    `json:"problem,omitempty"`
+}
+
+func errJsonBody(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	if utf8.Valid(body) {
+		return bytesString(body)
+	}
+	return body
+}
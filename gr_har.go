@@ -0,0 +1,479 @@
+package gr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR format version written by `gr.Har`.
+const HarVersion = `1.2`
+
+/*
+Collector of HTTP exchanges in the HAR 1.2 format ("HTTP Archive"), which can
+be opened in browser devtools and many other tools. Usage:
+
+	har := new(gr.Har)
+	cli := new(gr.Cli).Use(har.Mid)
+
+	// ... perform requests ...
+
+	har.WriteFile(`requests.har`)
+
+Each entry includes the request and response line, headers, cookies, query
+parameters, bodies, and timings. Request and response bodies are copied in the
+manner of `gr.ForkReadCloser`: fully read, and replaced with equivalent
+in-memory readers, which means that response bodies are buffered before the
+response is returned. Bodies which aren't valid UTF-8 are stored in base64,
+marked with "encoding": "base64", which for request bodies is non-standard.
+Transport errors are recorded as entries with status 0 and the custom field
+"_error". Passwords in request URLs are redacted, as in `(*url.URL).Redacted`.
+
+Safe for concurrent use. The zero value is ready to use.
+*/
+type Har struct {
+	lock    sync.Mutex
+	entries []HarEntry
+}
+
+/*
+Implements `gr.Mid`. Returns a transport which performs requests via the given
+transport, or `http.DefaultTransport` if nil, and records each exchange.
+*/
+func (self *Har) Mid(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return Trans(func(req *http.Request) (*http.Response, error) {
+		return self.roundTrip(next, req)
+	})
+}
+
+// Adds an entry. Can be used to record exchanges performed elsewhere.
+func (self *Har) Add(val HarEntry) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.entries = append(self.entries, val)
+}
+
+// Returns a copy of the entries recorded so far.
+func (self *Har) Entries() []HarEntry {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]HarEntry(nil), self.entries...)
+}
+
+// Removes all recorded entries.
+func (self *Har) Clear() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.entries = nil
+}
+
+// Returns the HAR document with the entries recorded so far.
+func (self *Har) Doc() HarDoc {
+	entries := self.Entries()
+	if entries == nil {
+		entries = []HarEntry{}
+	}
+
+	return HarDoc{Log: HarLog{
+		Version: HarVersion,
+		Creator: HarCreator{Name: `gr`, Version: `1`},
+		Entries: entries,
+	}}
+}
+
+// Implement `json.Marshaler`, encoding the output of `(*gr.Har).Doc`.
+func (self *Har) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.Doc())
+}
+
+/*
+Writes the HAR document to the given output as indented JSON. Panics on error.
+*/
+func (self *Har) Write(out io.Writer) {
+	enc := json.NewEncoder(out)
+	enc.SetIndent(``, `  `)
+
+	err := enc.Encode(self.Doc())
+	if err != nil {
+		panic(errWrite(err))
+	}
+}
+
+// Non-panicking version of `(*gr.Har).Write`.
+func (self *Har) WriteCatch(out io.Writer) (err error) {
+	defer rec(&err)
+	self.Write(out)
+	return
+}
+
+/*
+Writes the HAR document to the file at the given path, creating or truncating
+it. Panics on error.
+*/
+func (self *Har) WriteFile(path string) {
+	file, err := os.Create(path)
+	if err != nil {
+		panic(errWrite(err))
+	}
+
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			panic(errWrite(err))
+		}
+	}()
+
+	self.Write(file)
+}
+
+// Non-panicking version of `(*gr.Har).WriteFile`.
+func (self *Har) WriteFileCatch(path string) (err error) {
+	defer rec(&err)
+	self.WriteFile(path)
+	return
+}
+
+func (self *Har) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		reqBody, err = readAllClose(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf(`[gr] failed to read request body for HAR: %w`, err)
+		}
+	}
+
+	// Trace hooks may be called from other goroutines.
+	var lock sync.Mutex
+	var wroteAt, firstAt time.Time
+	mark := func(ptr *time.Time) {
+		lock.Lock()
+		defer lock.Unlock()
+		*ptr = time.Now()
+	}
+
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteRequest:         func(httptrace.WroteRequestInfo) { mark(&wroteAt) },
+		GotFirstResponseByte: func() { mark(&firstAt) },
+	})
+
+	out := req.Clone(ctx)
+	setReqBody(out, reqBody)
+	if req.ContentLength < 0 && len(reqBody) > 0 {
+		out.ContentLength = req.ContentLength
+	}
+
+	entry := HarEntry{
+		StartedDateTime: start.Format(harTimeFormat),
+		Request:         harReq(req, reqBody),
+		Cache:           HarCache{},
+	}
+
+	res, err := next.RoundTrip(out)
+	headersDone := time.Now()
+
+	var resBody []byte
+	if err == nil && res.Body != nil {
+		resBody, err = readAllClose(res.Body)
+		if err != nil {
+			res = nil
+		} else {
+			res.Body = NewBytesReadCloser(resBody)
+		}
+	}
+	done := time.Now()
+
+	lock.Lock()
+	wrote, gotFirst := wroteAt, firstAt
+	lock.Unlock()
+
+	if wrote.IsZero() || wrote.After(headersDone) {
+		wrote = start
+	}
+	if gotFirst.IsZero() || gotFirst.Before(wrote) || gotFirst.After(headersDone) {
+		gotFirst = headersDone
+	}
+
+	entry.Time = harMs(done.Sub(start))
+	entry.Timings = HarTimings{
+		Blocked: -1,
+		Dns:     -1,
+		Connect: -1,
+		Ssl:     -1,
+		Send:    harMs(wrote.Sub(start)),
+		Wait:    harMs(gotFirst.Sub(wrote)),
+		Receive: harMs(done.Sub(gotFirst)),
+	}
+
+	if err != nil {
+		entry.Response = harErrRes()
+		entry.Error = err.Error()
+	} else {
+		entry.Response = harRes(res, resBody)
+	}
+
+	self.Add(entry)
+	return res, err
+}
+
+// Top-level HAR document. See `gr.Har`.
+type HarDoc struct {
+	Log HarLog `json:"log"`
+}
+
+// Part of the HAR format. See `gr.Har`.
+type HarLog struct {
+	Version string     `json:"version"`
+	Creator HarCreator `json:"creator"`
+	Entries []HarEntry `json:"entries"`
+}
+
+// Part of the HAR format. See `gr.Har`.
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+/*
+Part of the HAR format. See `gr.Har`. Times are in milliseconds. `.Error` is a
+custom field, set when the transport fails.
+*/
+type HarEntry struct {
+	StartedDateTime string     `json:"startedDateTime"`
+	Time            float64    `json:"time"`
+	Request         HarReq     `json:"request"`
+	Response        HarRes     `json:"response"`
+	Cache           HarCache   `json:"cache"`
+	Timings         HarTimings `json:"timings"`
+	Error           string     `json:"_error,omitempty"`
+}
+
+// Part of the HAR format. See `gr.Har`.
+type HarReq struct {
+	Method      string       `json:"method"`
+	Url         string       `json:"url"`
+	HttpVersion string       `json:"httpVersion"`
+	Cookies     []HarCookie  `json:"cookies"`
+	Headers     []HarPair    `json:"headers"`
+	QueryString []HarPair    `json:"queryString"`
+	PostData    *HarPostData `json:"postData,omitempty"`
+	HeadersSize int64        `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+// Part of the HAR format. See `gr.Har`.
+type HarRes struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HttpVersion string      `json:"httpVersion"`
+	Cookies     []HarCookie `json:"cookies"`
+	Headers     []HarPair   `json:"headers"`
+	Content     HarContent  `json:"content"`
+	RedirectUrl string      `json:"redirectURL"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+// Part of the HAR format. Used for headers and query parameters. See `gr.Har`.
+type HarPair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Part of the HAR format. See `gr.Har`.
+type HarCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HttpOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+/*
+Part of the HAR format. See `gr.Har`. For form-encoded bodies, `.Params` is also
+populated. If the body is not valid UTF-8, `.Text` is base64-encoded and
+`.Encoding` is "base64". HAR 1.2 defines "encoding" only for response content;
+here it's a non-standard extension, mirroring `gr.HarContent`.
+*/
+type HarPostData struct {
+	MimeType string    `json:"mimeType"`
+	Text     string    `json:"text"`
+	Encoding string    `json:"encoding,omitempty"`
+	Params   []HarPair `json:"params,omitempty"`
+}
+
+/*
+Part of the HAR format. See `gr.Har`. If the body is not valid UTF-8, `.Text`
+is base64-encoded and `.Encoding` is "base64".
+*/
+type HarContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Part of the HAR format. Always empty. See `gr.Har`.
+type HarCache struct{}
+
+/*
+Part of the HAR format. See `gr.Har`. Times are in milliseconds; -1 means
+"unknown". Connection-level timings are not measured.
+*/
+type HarTimings struct {
+	Blocked float64 `json:"blocked"`
+	Dns     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	Ssl     float64 `json:"ssl"`
+}
+
+const harTimeFormat = `2006-01-02T15:04:05.000Z07:00`
+
+func harReq(req *http.Request, body []byte) HarReq {
+	out := HarReq{
+		Method:      req.Method,
+		Url:         req.URL.Redacted(),
+		HttpVersion: harProto(req.Proto),
+		Cookies:     harReqCookies(req.Cookies()),
+		Headers:     harHead(req.Header),
+		QueryString: harQuery(req.URL.Query()),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+
+	if out.Method == `` {
+		out.Method = http.MethodGet
+	}
+
+	if len(body) > 0 {
+		typ := req.Header.Get(Type)
+		text, enc := harText(body)
+		out.PostData = &HarPostData{MimeType: typ, Text: text, Encoding: enc}
+
+		media, _, _ := mime.ParseMediaType(typ)
+		if media == TypeForm && enc == `` {
+			vals, _ := url.ParseQuery(text)
+			out.PostData.Params = harQuery(vals)
+		}
+	}
+	return out
+}
+
+func harRes(res *http.Response, body []byte) HarRes {
+	text, enc := harText(body)
+
+	return HarRes{
+		Status:      res.StatusCode,
+		StatusText:  http.StatusText(res.StatusCode),
+		HttpVersion: harProto(res.Proto),
+		Cookies:     harResCookies(res.Cookies()),
+		Headers:     harHead(res.Header),
+		Content: HarContent{
+			Size:     int64(len(body)),
+			MimeType: res.Header.Get(Type),
+			Text:     text,
+			Encoding: enc,
+		},
+		RedirectUrl: res.Header.Get(`Location`),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+}
+
+func harErrRes() HarRes {
+	return HarRes{
+		Cookies:     []HarCookie{},
+		Headers:     []HarPair{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+}
+
+func harProto(val string) string {
+	if val == `` {
+		return `HTTP/1.1`
+	}
+	return val
+}
+
+func harText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ``
+	}
+	return base64.StdEncoding.EncodeToString(body), `base64`
+}
+
+// Sorted by key for deterministic output. Values keep their order.
+func harHead(head http.Header) []HarPair {
+	keys := make([]string, 0, len(head))
+	for key := range head {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := []HarPair{}
+	for _, key := range keys {
+		for _, val := range head[key] {
+			out = append(out, HarPair{key, val})
+		}
+	}
+	return out
+}
+
+func harQuery(val map[string][]string) []HarPair {
+	return harHead(http.Header(val))
+}
+
+func harReqCookies(src []*http.Cookie) []HarCookie {
+	out := make([]HarCookie, 0, len(src))
+	for _, val := range src {
+		out = append(out, HarCookie{Name: val.Name, Value: val.Value})
+	}
+	return out
+}
+
+func harResCookies(src []*http.Cookie) []HarCookie {
+	out := make([]HarCookie, 0, len(src))
+	for _, val := range src {
+		cookie := HarCookie{
+			Name:     val.Name,
+			Value:    val.Value,
+			Path:     val.Path,
+			Domain:   val.Domain,
+			HttpOnly: val.HttpOnly,
+			Secure:   val.Secure,
+		}
+		if !val.Expires.IsZero() {
+			cookie.Expires = val.Expires.Format(harTimeFormat)
+		}
+		out = append(out, cookie)
+	}
+	return out
+}
+
+func harMs(val time.Duration) float64 {
+	if val < 0 {
+		return 0
+	}
+	return float64(val) / float64(time.Millisecond)
+}
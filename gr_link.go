@@ -0,0 +1,265 @@
+package gr
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+/*
+Single link from a "Link" header, as defined by RFC 8288. `.Url` is the target
+URI reference as written, without resolving. `.Rel` is the raw value of the
+"rel" parameter, which may contain multiple space-separated relation types; use
+`gr.Link.HasRel` to check for one. Other parameters, such as "type" or "title",
+are stored in `.Params` with lowercase keys. Parameters without a value are
+stored with an empty value. For each parameter, only the first occurrence is
+used, as specified by the RFC.
+*/
+type Link struct {
+	Url    string
+	Rel    string
+	Anchor string
+	Params map[string]string
+}
+
+/*
+True if `.Rel` contains the given relation type. Relation types are compared
+case-insensitively.
+*/
+func (self Link) HasRel(val string) bool {
+	for _, rel := range strings.Fields(self.Rel) {
+		if strings.EqualFold(rel, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sequence of links parsed from one or more "Link" headers.
+type Links []Link
+
+/*
+Returns the first link with the given relation type, such as "next", or a zero
+link if there is none. See `gr.Link.HasRel`.
+*/
+func (self Links) Rel(val string) Link {
+	for _, link := range self {
+		if link.HasRel(val) {
+			return link
+		}
+	}
+	return Link{}
+}
+
+/*
+Parses the given "Link" header values, as defined by RFC 8288. Each value may
+contain multiple comma-separated links. Panics on malformed input. Also see
+`gr.ParseLinksCatch`.
+*/
+func ParseLinks(src ...string) Links {
+	var out Links
+	for _, val := range src {
+		out = (&linkParser{src: val, out: out}).parse()
+	}
+	return out
+}
+
+// Non-panicking version of `gr.ParseLinks`.
+func ParseLinksCatch(src ...string) (_ Links, err error) {
+	defer rec(&err)
+	return ParseLinks(src...), nil
+}
+
+/*
+Parses all "Link" header values, using `gr.ParseLinks`. Panics on malformed
+input. Also see `gr.Head.LinksCatch`.
+*/
+func (self Head) Links() Links { return ParseLinks(self.Values(`Link`)...) }
+
+// Non-panicking version of `gr.Head.Links`.
+func (self Head) LinksCatch() (_ Links, err error) {
+	defer rec(&err)
+	return self.Links(), nil
+}
+
+/*
+Parses the "Link" headers of the response, using `gr.ParseLinks`. Panics on
+malformed input. Also see `(*gr.Res).LinksCatch`.
+*/
+func (self *Res) Links() Links { return Head(self.Header).Links() }
+
+// Non-panicking version of `(*gr.Res).Links`.
+func (self *Res) LinksCatch() (_ Links, err error) {
+	defer rec(&err)
+	return self.Links(), nil
+}
+
+/*
+Finds the first link with the given relation type, such as "next", and returns
+its target as a URL, resolved against the URL of `.Request` if any. Returns nil
+if there is no such link. Panics if the "Link" header or the target URL are
+malformed. Also see `(*gr.Res).LinkUrlCatch`.
+*/
+func (self *Res) LinkUrl(rel string) *url.URL {
+	link := self.Links().Rel(rel)
+	if link.Url == `` {
+		return nil
+	}
+
+	val, err := url.Parse(link.Url)
+	if err != nil {
+		panic(fmt.Errorf(`[gr] failed to parse link URL %q: %w`, link.Url, err))
+	}
+
+	req := self.Request
+	if req != nil && req.URL != nil {
+		return req.URL.ResolveReference(val)
+	}
+	return val
+}
+
+// Non-panicking version of `(*gr.Res).LinkUrl`.
+func (self *Res) LinkUrlCatch(rel string) (_ *url.URL, err error) {
+	defer rec(&err)
+	return self.LinkUrl(rel), nil
+}
+
+type linkParser struct {
+	src string
+	pos int
+	out Links
+}
+
+func (self *linkParser) parse() Links {
+	for {
+		self.skipSpace()
+		if self.more() && self.char() == ',' {
+			self.pos++
+			continue
+		}
+		if !self.more() {
+			return self.out
+		}
+		self.link()
+	}
+}
+
+func (self *linkParser) link() {
+	if self.char() != '<' {
+		panic(self.err(`expected "<"`))
+	}
+
+	end := strings.IndexByte(self.src[self.pos:], '>')
+	if end < 0 {
+		panic(self.err(`unclosed "<"`))
+	}
+
+	link := Link{Url: strings.TrimSpace(self.src[self.pos+1 : self.pos+end])}
+	self.pos += end + 1
+
+	var hasRel, hasAnchor bool
+	for {
+		self.skipSpace()
+		if !self.more() || self.char() == ',' {
+			break
+		}
+		if self.char() != ';' {
+			panic(self.err(`expected ";" or ","`))
+		}
+		self.pos++
+		self.skipSpace()
+
+		key := strings.ToLower(self.token())
+		if key == `` {
+			panic(self.err(`expected parameter name`))
+		}
+
+		self.skipSpace()
+		var val string
+		if self.more() && self.char() == '=' {
+			self.pos++
+			self.skipSpace()
+			val = self.value()
+		}
+
+		switch key {
+		case `rel`:
+			if !hasRel {
+				link.Rel, hasRel = val, true
+			}
+		case `anchor`:
+			if !hasAnchor {
+				link.Anchor, hasAnchor = val, true
+			}
+		default:
+			if link.Params == nil {
+				link.Params = map[string]string{}
+			}
+			_, ok := link.Params[key]
+			if !ok {
+				link.Params[key] = val
+			}
+		}
+	}
+
+	self.out = append(self.out, link)
+}
+
+/*
+Unquoted values should be tokens, but in practice they may contain other
+characters such as "/" in media types. We accept anything up to the next
+delimiter.
+*/
+func (self *linkParser) value() string {
+	if !self.more() || self.char() != '"' {
+		start := self.pos
+		for self.more() && strings.IndexByte(" \t;,", self.char()) < 0 {
+			self.pos++
+		}
+		return self.src[start:self.pos]
+	}
+	self.pos++
+
+	var buf strings.Builder
+	for self.more() {
+		char := self.char()
+		self.pos++
+
+		if char == '"' {
+			return buf.String()
+		}
+		if char == '\\' && self.more() {
+			char = self.char()
+			self.pos++
+		}
+		buf.WriteByte(char)
+	}
+	panic(self.err(`unclosed quoted string`))
+}
+
+func (self *linkParser) token() string {
+	start := self.pos
+	for self.more() && isToken(self.char()) {
+		self.pos++
+	}
+	return self.src[start:self.pos]
+}
+
+func (self *linkParser) skipSpace() {
+	for self.more() && (self.char() == ' ' || self.char() == '\t') {
+		self.pos++
+	}
+}
+
+func (self *linkParser) more() bool { return self.pos < len(self.src) }
+
+func (self *linkParser) char() byte { return self.src[self.pos] }
+
+func (self *linkParser) err(msg string) error {
+	return fmt.Errorf(`[gr] failed to parse Link header %q: %v at position %v`, self.src, msg, self.pos)
+}
+
+// Implements the "tchar" rule from RFC 9110.
+func isToken(char byte) bool {
+	return isAlnum(char) || strings.IndexByte("!#$%&'*+-.^_`|~", char) >= 0
+}
@@ -0,0 +1,153 @@
+package gr
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+/*
+Short for "middleware". Function that wraps an `http.RoundTripper`, returning
+another `http.RoundTripper`, typically `gr.Trans`, which may modify the request,
+the response, or the flow of the request. Middlewares can be composed via
+`gr.Mids` and installed via `(*gr.Cli).Use`, allowing shared client behavior to
+live in one `gr.Cli.Transport` rather than at every call site.
+
+Like any `http.RoundTripper`, middlewares must not mutate the incoming request.
+To modify it, they should use a clone, for example via `(*http.Request).Clone`.
+*/
+type Mid func(http.RoundTripper) http.RoundTripper
+
+/*
+Applies the middleware to the given round tripper. If the round tripper is nil,
+uses `http.DefaultTransport`. If the middleware is nil, returns the round
+tripper as-is.
+*/
+func (self Mid) Wrap(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if self == nil {
+		return next
+	}
+	return self(next)
+}
+
+/*
+Short for "middlewares". Sequence of middlewares, composed in order: the first
+middleware is the outermost, which sees the request first and the response
+last.
+*/
+type Mids []Mid
+
+/*
+Composes the middlewares around the given round tripper, in order: the first
+middleware is the outermost. If the round tripper is nil, uses
+`http.DefaultTransport`. Nil middlewares are skipped.
+*/
+func (self Mids) Wrap(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	for ind := len(self) - 1; ind >= 0; ind-- {
+		next = self[ind].Wrap(next)
+	}
+	return next
+}
+
+/*
+Combines the middlewares into one, equivalent to applying them in order. The
+first middleware is the outermost.
+*/
+func (self Mids) Mid() Mid { return self.Wrap }
+
+/*
+Composes the given middlewares around `.Transport` via `gr.Mids.Wrap`, and sets
+the result as `.Transport`. If `.Transport` is nil, wraps
+`http.DefaultTransport`. Repeated calls add outer layers. Mutates and returns
+the receiver.
+*/
+func (self *Cli) Use(mids ...Mid) *Cli {
+	self.Transport = Mids(mids).Wrap(self.Transport)
+	return self
+}
+
+/*
+Middleware that replaces the given headers in each request, using
+`gr.Head.Patch` on a clone of the request. Useful for headers shared by all
+requests of a client, such as "User-Agent". Accepts an "anonymous" type
+because all alias types such as `http.Header` and `gr.Head` are automatically
+castable into it.
+*/
+func MidHead(head map[string][]string) Mid {
+	head = Head(head).Clone()
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return Trans(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header = Head(req.Header).Patch(head).Header()
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+/*
+Middleware that sets the header "Authorization" to the given value in each
+request, using a clone of the request. The value must include the scheme, for
+example "Bearer <token>". Overrides any previous value.
+*/
+func MidAuth(val string) Mid {
+	return MidHead(Head{`Authorization`: {val}})
+}
+
+/*
+Middleware that measures each round trip, calling the given function after the
+round trip is done. The duration covers the time until the response headers
+are received, but not reading the response body. The response is nil when the
+error is non-nil.
+*/
+func MidTime(fun func(*http.Request, *http.Response, error, time.Duration)) Mid {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if fun == nil {
+			return next
+		}
+
+		return Trans(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+			fun(req, res, err, time.Since(start))
+			return res, err
+		})
+	}
+}
+
+/*
+Middleware that writes one line per round trip to the given output, which
+includes the request method, URL, response status or error, and duration, for
+example:
+
+	[gr] GET https://example.com/one -> 200 OK (12ms)
+
+If the output is nil, this is a nop. Passwords in URLs are redacted, as in
+`(*url.URL).Redacted`. Doesn't log headers or bodies; for those, see
+`(*gr.Req).Dump` and `(*gr.Res).Dump`.
+*/
+func MidLog(out io.Writer) Mid {
+	if out == nil {
+		return nil
+	}
+
+	return MidTime(func(req *http.Request, res *http.Response, err error, dur time.Duration) {
+		dur = dur.Round(time.Microsecond)
+
+		if err != nil {
+			fmt.Fprintf(out, "[gr] %v %v -> error: %v (%v)\n", req.Method, req.URL.Redacted(), err, dur)
+			return
+		}
+		fmt.Fprintf(
+			out, "[gr] %v %v -> %v %v (%v)\n",
+			req.Method, req.URL.Redacted(), res.StatusCode, http.StatusText(res.StatusCode), dur,
+		)
+	})
+}
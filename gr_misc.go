@@ -17,12 +17,22 @@ const (
 
 	TypeJson     = `application/json`
 	TypeJsonUtf8 = `application/json; charset=utf-8`
+	TypeJsonSeq  = `application/json-seq`
+	TypeNdjson   = `application/x-ndjson`
+	TypeProblem  = `application/problem+json`
 
 	TypeForm     = `application/x-www-form-urlencoded`
 	TypeFormUtf8 = `application/x-www-form-urlencoded; charset=utf-8`
 
 	TypeMulti     = `multipart/form-data`
 	TypeMultiUtf8 = `multipart/form-data; charset=utf-8`
+
+	TypeMultiMixed = `multipart/mixed`
+	TypeMultiRange = `multipart/byteranges`
+
+	TypeOctetStream = `application/octet-stream`
+	TypeHttp        = `application/http`
+	TypeEventStream = `text/event-stream`
 )
 
 /*
@@ -102,6 +112,19 @@ func IsClientErr(val int) bool { return val >= 400 && val <= 499 }
 // True if given HTTP status code is between 500 and 599 inclusive.
 func IsServerErr(val int) bool { return val >= 500 && val <= 599 }
 
+/*
+True if given HTTP status code indicates a transient failure, where repeating
+the same request later may succeed: 408, 425, 429, 502, 503, 504.
+*/
+func IsRetryable(val int) bool {
+	return val == http.StatusRequestTimeout ||
+		val == http.StatusTooEarly ||
+		val == http.StatusTooManyRequests ||
+		val == http.StatusBadGateway ||
+		val == http.StatusServiceUnavailable ||
+		val == http.StatusGatewayTimeout
+}
+
 /*
 Appends the string representation of the input to the path of the given URL,
 slash-separated. The input must be string-encodable following the rules of
@@ -0,0 +1,323 @@
+package gr
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Short for "multipart". Chainable builder of "multipart/form-data" request
+bodies. The zero value is ready to use. Usage:
+
+	req := gr.To(`https://example.com`).Post().Multi(
+		new(gr.Multi).
+			Field(`one`, `two`).
+			File(`three`, `some_file.txt`),
+	)
+
+Parts are not buffered in memory. The body is encoded on the fly and streamed
+through a pipe, reading each file or reader only when the transport consumes
+the body. Files added by path are opened only when writing.
+
+When the size of every part is known, `(*gr.Multi).Len` returns the exact
+length of the encoded body, which `(*gr.Req).Multi` uses as
+`.ContentLength`. Sizes are known for fields, files added by path, and
+readers that implement `io.ReaderAt` and `Size() int64`, such as
+`*strings.Reader`, `*bytes.Reader`, `*gr.StringReadCloser` and
+`*gr.BytesReadCloser`.
+
+When every part can be read more than once, `(*gr.Req).Multi` also sets
+`.GetBody`, making the request replayable, for example by `(*gr.Req).RetryRes`.
+This holds for all the cases above. Other readers are read only once.
+*/
+type Multi struct {
+	bound string
+	parts []multiPart
+}
+
+type multiPart struct {
+	head   textproto.MIMEHeader
+	open   func() (io.ReadCloser, error)
+	size   int64
+	replay bool
+}
+
+/*
+Returns the boundary string which separates the parts. If no boundary was set
+via `(*gr.Multi).SetBoundary`, generates a random one on the first call.
+*/
+func (self *Multi) Boundary() string {
+	if self.bound == `` {
+		self.bound = multipart.NewWriter(io.Discard).Boundary()
+	}
+	return self.bound
+}
+
+/*
+Sets the boundary string which separates the parts. Panics if the boundary is
+invalid according to `(*multipart.Writer).SetBoundary`. Mutates and returns
+the receiver.
+*/
+func (self *Multi) SetBoundary(val string) *Multi {
+	err := multipart.NewWriter(io.Discard).SetBoundary(val)
+	if err != nil {
+		panic(fmt.Errorf(`[gr] failed to set multipart boundary %q: %w`, val, err))
+	}
+	self.bound = val
+	return self
+}
+
+/*
+Returns the content type with the boundary, such as
+"multipart/form-data; boundary=...". Used by `(*gr.Req).Multi` for the header
+"Content-Type".
+*/
+func (self *Multi) Type() string {
+	return mime.FormatMediaType(TypeMulti, map[string]string{`boundary`: self.Boundary()})
+}
+
+// Adds a text field. Mutates and returns the receiver.
+func (self *Multi) Field(key, val string) *Multi {
+	head := textproto.MIMEHeader{}
+	head.Set(`Content-Disposition`, multiDisposition(key, ``))
+	return self.add(head, NewStringReadCloser(val))
+}
+
+/*
+Adds a file part read from the given path. The file name in the part header is
+the base name of the path, and the content type is detected from the file
+extension, falling back on `gr.TypeOctetStream`. Uses `os.Stat` to find the file
+size, panicking if the file can't be found. The file is opened only when
+writing the body, and may be opened again when replaying it. Mutates and
+returns the receiver.
+*/
+func (self *Multi) File(key, path string) *Multi {
+	info, err := os.Stat(path)
+	if err != nil {
+		panic(fmt.Errorf(`[gr] failed to add multipart file: %w`, err))
+	}
+
+	name := filepath.Base(path)
+
+	self.parts = append(self.parts, multiPart{
+		head:   multiFileHead(key, name),
+		open:   func() (io.ReadCloser, error) { return os.Open(path) },
+		size:   info.Size(),
+		replay: true,
+	})
+	return self
+}
+
+/*
+Adds a file part read from the given reader, with the given file name. The
+content type is detected from the file name's extension, falling back on
+`gr.TypeOctetStream`. See `gr.Multi` regarding which readers support known
+sizes and replays. Mutates and returns the receiver.
+*/
+func (self *Multi) FileReader(key, name string, src io.Reader) *Multi {
+	return self.add(multiFileHead(key, name), src)
+}
+
+/*
+Adds an arbitrary part with the given headers, which may be nil. The caller is
+responsible for "Content-Disposition" and other headers. See `gr.Multi`
+regarding which readers support known sizes and replays. Accepts an "anonymous"
+type because all alias types such as `http.Header` and `gr.Head` are
+automatically castable into it. Mutates and returns the receiver.
+*/
+func (self *Multi) Part(head map[string][]string, src io.Reader) *Multi {
+	out := textproto.MIMEHeader{}
+	for key, vals := range head {
+		out[canonKey(key)] = append(out[canonKey(key)], vals...)
+	}
+	return self.add(out, src)
+}
+
+func (self *Multi) add(head textproto.MIMEHeader, src io.Reader) *Multi {
+	part := multiPart{head: head, size: -1}
+
+	switch src := src.(type) {
+	case nil:
+		part.open = openEmpty
+		part.size = 0
+		part.replay = true
+
+	case readerAtSize:
+		part.open = func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(src, 0, src.Size())), nil
+		}
+		part.size = src.Size()
+		part.replay = true
+
+	default:
+		part.open = func() (io.ReadCloser, error) { return io.NopCloser(src), nil }
+	}
+
+	self.parts = append(self.parts, part)
+	return self
+}
+
+/*
+Returns the exact length of the encoded body, in bytes, or -1 if the size of
+some part is unknown. See `gr.Multi` regarding known sizes.
+*/
+func (self *Multi) Len() int64 {
+	var size int64
+	for _, part := range self.parts {
+		if part.size < 0 {
+			return -1
+		}
+		size += part.size
+	}
+
+	var count countWriter
+	wri := self.writer(&count)
+	for _, part := range self.parts {
+		_, _ = wri.CreatePart(part.head)
+	}
+	_ = wri.Close()
+
+	return size + int64(count)
+}
+
+/*
+True if every part can be read more than once, which makes it possible to
+replay the body. See `gr.Multi` regarding replays.
+*/
+func (self *Multi) IsReplayable() bool {
+	for _, part := range self.parts {
+		if !part.replay {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Returns a new reader of the encoded body. Encoding happens concurrently in a
+background goroutine which writes into a pipe, reading the parts only as fast
+as the output is consumed. The goroutine starts on the first `.Read`, so a
+reader which is never read holds no resources. Errors, such as failing to open
+a file, are returned from the reader's `.Read`. Closing the reader early stops
+the encoding.
+*/
+func (self *Multi) Reader() io.ReadCloser {
+	return newPipeBody(func(out io.Writer, _ <-chan struct{}) error {
+		return self.writeTo(self.writer(out))
+	})
+}
+
+// Writes the encoded body to the given output. Returns the first error.
+func (self *Multi) WriteTo(out io.Writer) (int64, error) {
+	count := countWriter(0)
+	err := self.writeTo(self.writer(io.MultiWriter(out, &count)))
+	return int64(count), err
+}
+
+func (self *Multi) writer(out io.Writer) *multipart.Writer {
+	wri := multipart.NewWriter(out)
+	_ = wri.SetBoundary(self.Boundary())
+	return wri
+}
+
+func (self *Multi) writeTo(wri *multipart.Writer) error {
+	for _, part := range self.parts {
+		err := part.writeTo(wri)
+		if err != nil {
+			return fmt.Errorf(`[gr] failed to write multipart body: %w`, err)
+		}
+	}
+	return wri.Close()
+}
+
+func (self multiPart) writeTo(wri *multipart.Writer) error {
+	out, err := wri.CreatePart(self.head)
+	if err != nil {
+		return err
+	}
+
+	src, err := self.open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(out, src)
+	return err
+}
+
+/*
+Uses the given multipart builder as the request body, updating the following
+fields:
+
+	* "Content-Type"   -> `(*gr.Multi).Type`, which includes the boundary.
+	* `.ContentLength` -> `(*gr.Multi).Len`, or -1 if unknown.
+	* `.Body`          -> `(*gr.Multi).Reader`.
+	* `.GetBody`       -> nil or function returning `(*gr.Multi).Reader`.
+
+`.GetBody` is set only if `(*gr.Multi).IsReplayable`. If the input is nil, the
+listed fields are set to zero values and the header is removed. Mutates and
+returns the receiver.
+*/
+func (self *Req) Multi(val *Multi) *Req {
+	if val == nil {
+		self.ContentLength = 0
+		self.GetBody = nil
+		self.Body = nil
+		return self.Type(``)
+	}
+
+	self = self.Type(val.Type())
+	self.ContentLength = val.Len()
+
+	if val.IsReplayable() {
+		self.GetBody = func() (io.ReadCloser, error) { return val.Reader(), nil }
+	} else {
+		self.GetBody = nil
+	}
+
+	self.Body = val.Reader()
+	return self
+}
+
+type readerAtSize interface {
+	io.ReaderAt
+	Size() int64
+}
+
+type countWriter int64
+
+func (self *countWriter) Write(val []byte) (int, error) {
+	*self += countWriter(len(val))
+	return len(val), nil
+}
+
+func openEmpty() (io.ReadCloser, error) { return NewStringReadCloser(``), nil }
+
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func multiDisposition(key, name string) string {
+	out := `form-data; name="` + quoteEscaper.Replace(key) + `"`
+	if name != `` {
+		out += `; filename="` + quoteEscaper.Replace(name) + `"`
+	}
+	return out
+}
+
+func multiFileHead(key, name string) textproto.MIMEHeader {
+	typ := mime.TypeByExtension(filepath.Ext(name))
+	if typ == `` {
+		typ = TypeOctetStream
+	}
+
+	head := textproto.MIMEHeader{}
+	head.Set(`Content-Disposition`, multiDisposition(key, name))
+	head.Set(Type, typ)
+	return head
+}
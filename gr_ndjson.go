@@ -0,0 +1,243 @@
+package gr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	r "reflect"
+	"sync"
+)
+
+/*
+Returns a streaming decoder of newline-delimited JSON, also known as NDJSON or
+JSON Lines, decoding the response body one record at a time. Also supports JSON
+text sequences as defined in RFC 7464, where each record is preceded by the
+"record separator" character, which is treated as whitespace. Usage:
+
+	lines := res.JsonLines()
+	defer lines.Done()
+
+	for {
+		var val SomeType
+		if !lines.Next(&val) {
+			break
+		}
+		fmt.Println(val)
+	}
+
+Uses the context of `.Request`, if any. When the context is done, reading stops
+without panicking. The decoder closes the response body after the last record,
+after failing, or after context cancellation. To stop early, call
+`(*gr.JsonLines).Done`.
+*/
+func (self *Res) JsonLines() *JsonLines {
+	out := &JsonLines{Body: self.Body}
+
+	if self.Request != nil {
+		out.Ctx = (*Req)(self.Request).Context()
+	}
+
+	if self.Body != nil {
+		out.dec = json.NewDecoder(recordSepReader{self.Body})
+	}
+	return out
+}
+
+/*
+Streaming decoder of newline-delimited JSON and JSON text sequences. Returned
+by `(*gr.Res).JsonLines`. If `.Ctx` is non-nil, reading stops when it's done.
+*/
+type JsonLines struct {
+	Body io.ReadCloser
+	Ctx  context.Context
+	dec  *json.Decoder
+}
+
+/*
+Decodes the next record into the given output, which must be a non-nil pointer.
+Before decoding, resets the output to its zero value, so that each record is
+decoded into a fresh value rather than merged with the previous one. Returns
+true if a record was decoded, and false if the stream has ended or the context
+is done. Panics on decoding errors, closing the body.
+*/
+func (self *JsonLines) Next(out interface{}) bool {
+	if self == nil || self.dec == nil || self.isDone() {
+		self.Done()
+		return false
+	}
+
+	val := r.ValueOf(out)
+	if val.Kind() != r.Ptr || val.IsNil() {
+		self.Done()
+		panic(fmt.Errorf(`[gr] failed to JSON-decode response record: expected non-nil pointer, got %T`, out))
+	}
+	val = val.Elem()
+	val.Set(r.Zero(val.Type()))
+
+	err := self.dec.Decode(out)
+	if err == nil {
+		return true
+	}
+
+	self.Done()
+	if err == io.EOF || self.isDone() {
+		return false
+	}
+	panic(fmt.Errorf(`[gr] failed to JSON-decode response record: %w`, err))
+}
+
+/*
+Non-panicking version of `(*gr.JsonLines).Next`. Returns false and nil if the
+stream has ended.
+*/
+func (self *JsonLines) NextCatch(out interface{}) (_ bool, err error) {
+	defer rec(&err)
+	return self.Next(out), nil
+}
+
+// Closes the response body if possible. Can be deferred.
+func (self *JsonLines) Done() {
+	if self != nil && self.Body != nil {
+		_ = self.Body.Close()
+		self.dec = nil
+	}
+}
+
+func (self *JsonLines) isDone() bool {
+	return self.Ctx != nil && self.Ctx.Err() != nil
+}
+
+// Replaces the RFC 7464 "record separator" with a space, which JSON ignores.
+type recordSepReader struct{ io.Reader }
+
+func (self recordSepReader) Read(buf []byte) (int, error) {
+	size, err := self.Reader.Read(buf)
+	for ind, char := range buf[:size] {
+		if char == recordSep {
+			buf[ind] = ' '
+		}
+	}
+	return size, err
+}
+
+const recordSep = 0x1e
+
+/*
+Uses the given function to stream newline-delimited JSON as the request body,
+without buffering the entire payload. The function is called in a background
+goroutine, when the body is first read, and must call the provided "emit"
+function for each record, which JSON-encodes the record and writes it to the
+body, followed by a newline. Errors returned by "emit" indicate that the body
+was closed or that encoding failed; the function should stop and return them.
+Returning an error aborts the body, failing the request.
+
+Sets "Content-Type: application/x-ndjson", `.ContentLength` to -1, meaning
+"unknown", and `.GetBody` to a function that calls the given function again,
+making the request replayable. Mutates and returns the receiver.
+*/
+func (self *Req) JsonLinesFunc(fun func(func(interface{}) error) error) *Req {
+	self = self.Type(TypeNdjson)
+
+	if fun == nil {
+		self.ContentLength = 0
+		self.GetBody = nil
+		self.Body = nil
+		return self
+	}
+
+	body := func() (io.ReadCloser, error) {
+		return newPipeBody(func(out io.Writer, _ <-chan struct{}) error {
+			enc := json.NewEncoder(out)
+			return fun(enc.Encode)
+		}), nil
+	}
+
+	self.ContentLength = -1
+	self.GetBody = body
+	self.Body, _ = body()
+	return self
+}
+
+/*
+Streams newline-delimited JSON from the given channel as the request body,
+without buffering the entire payload. The input must be a receivable channel
+of any element type; each element is JSON-encoded as one record. The body ends
+when the channel is closed. Panics if the input is not a channel. If the body
+is closed early, for example due to context cancellation, stops receiving from
+the channel. Encoding errors abort the body, failing the request.
+
+Sets "Content-Type: application/x-ndjson" and `.ContentLength` to -1, meaning
+"unknown". Because a channel can be received only once, the request is not
+replayable and `.GetBody` is nil. Mutates and returns the receiver.
+*/
+func (self *Req) JsonLinesChan(src interface{}) *Req {
+	val := r.ValueOf(src)
+	if val.Kind() != r.Chan || val.Type().ChanDir()&r.RecvDir == 0 {
+		panic(fmt.Errorf(`[gr] failed to stream request records: expected receivable channel, got %T`, src))
+	}
+
+	self = self.Type(TypeNdjson)
+	self.ContentLength = -1
+	self.GetBody = nil
+	self.Body = newPipeBody(func(out io.Writer, done <-chan struct{}) error {
+		enc := json.NewEncoder(out)
+		cases := []r.SelectCase{
+			{Dir: r.SelectRecv, Chan: val},
+			{Dir: r.SelectRecv, Chan: r.ValueOf(done)},
+		}
+
+		for {
+			ind, elem, ok := r.Select(cases)
+			if ind > 0 || !ok {
+				return nil
+			}
+
+			err := enc.Encode(elem.Interface())
+			if err != nil {
+				return err
+			}
+		}
+	})
+	return self
+}
+
+/*
+Request body written by a function in a background goroutine, through a pipe.
+The goroutine is started lazily on the first read. Closing the body closes the
+"done" channel and makes further writes fail, allowing the function to stop.
+*/
+type pipeBody struct {
+	fun    func(io.Writer, <-chan struct{}) error
+	once   sync.Once
+	closed sync.Once
+	done   chan struct{}
+	read   *io.PipeReader
+	wri    *io.PipeWriter
+}
+
+func newPipeBody(fun func(io.Writer, <-chan struct{}) error) *pipeBody {
+	read, wri := io.Pipe()
+	return &pipeBody{fun: fun, done: make(chan struct{}), read: read, wri: wri}
+}
+
+func (self *pipeBody) Read(buf []byte) (int, error) {
+	self.once.Do(self.start)
+	return self.read.Read(buf)
+}
+
+func (self *pipeBody) Close() error {
+	self.once.Do(self.skip)
+	self.closed.Do(self.close)
+	return self.read.Close()
+}
+
+func (self *pipeBody) start() {
+	go func() {
+		_ = self.wri.CloseWithError(self.fun(self.wri, self.done))
+	}()
+}
+
+func (self *pipeBody) skip() {}
+
+func (self *pipeBody) close() { close(self.done) }
@@ -0,0 +1,294 @@
+package gr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Default for `gr.OAuth2.Leeway`. Tokens are refreshed this long before their
+expiry, to account for clock skew and network latency.
+*/
+const OAuth2Leeway = time.Second * 10
+
+/*
+OAuth2 client for the token endpoint `.Url`, which obtains access tokens via
+the "client_credentials" grant or the "refresh_token" grant, as defined by
+RFC 6749, and authorizes outgoing requests with "Authorization: Bearer <token>".
+Usable as `http.Client.Transport` or `gr.Cli.Transport`. To wrap another
+transport, use `(*gr.OAuth2).Mid` as a `gr.Mid`. Also implements `gr.Cred`.
+Safe for concurrent use. Must not be copied after first use.
+
+If a refresh token is known, either from `.RefreshToken` or from a previous
+token response, uses the "refresh_token" grant, and otherwise the
+"client_credentials" grant. When the server issues a new refresh token, it
+replaces the previous one. `.Scopes` and `.Params` are sent with every token
+request. Client credentials are sent via HTTP Basic authentication, as
+recommended by RFC 6749, or in the request body if `.Form` is true.
+
+Tokens are cached in memory until `.Leeway` before their expiry, or
+`gr.OAuth2Leeway` if zero. Tokens without "expires_in" are cached until
+rejected by the server. Only one caller at a time fetches a new token; others
+wait for it and reuse the result.
+
+When the server responds with 401 Unauthorized, the transport fetches a new
+token and retries the request once, provided that the request body can be
+replayed via `.GetBody`, which is the case for requests built via
+`(*gr.Req).String`, `(*gr.Req).Bytes` and related methods.
+
+Token requests are sent via `.Cli`, or `http.DefaultClient` if nil. That client
+must not use this transport.
+*/
+type OAuth2 struct {
+	Url          string
+	ClientId     string
+	ClientSecret string
+	RefreshToken string
+	Scopes       []string
+	Params       map[string][]string
+	Form         bool
+	Leeway       time.Duration
+	Cli          *http.Client
+
+	lock sync.Mutex
+	sem  chan struct{}
+	tok  OAuth2Token
+}
+
+/*
+Successful response of an OAuth2 token endpoint, as defined by RFC 6749.
+`.Expiry` is not part of the response; it's calculated from `.ExpiresIn`
+when the token is obtained via `gr.OAuth2`.
+*/
+type OAuth2Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	ExpiresIn    int64     `json:"expires_in,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	Expiry       time.Time `json:"-"`
+}
+
+/*
+True if the access token is non-empty and doesn't expire within the given
+duration. Tokens with zero `.Expiry` never expire.
+*/
+func (self OAuth2Token) IsValid(leeway time.Duration) bool {
+	return self.AccessToken != `` &&
+		(self.Expiry.IsZero() || time.Now().Add(leeway).Before(self.Expiry))
+}
+
+// Implement `http.RoundTripper`, sending requests via `http.DefaultTransport`.
+func (self *OAuth2) RoundTrip(req *http.Request) (*http.Response, error) {
+	return self.roundTrip(http.DefaultTransport, req)
+}
+
+/*
+Implements `gr.Mid`. Returns a transport which authorizes requests and sends
+them via the given transport, or `http.DefaultTransport` if nil. Usage:
+
+	cli := new(gr.Cli).Use(auth.Mid)
+*/
+func (self *OAuth2) Mid(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return Trans(func(req *http.Request) (*http.Response, error) {
+		return self.roundTrip(next, req)
+	})
+}
+
+/*
+Implement `gr.Cred`, setting the current access token via
+`(*gr.Req).AuthBearer`. Unlike `(*gr.OAuth2).Mid`, this doesn't retry on 401.
+*/
+func (self *OAuth2) Cred(req *Req) error {
+	tok, err := self.token(req.Context(), ``)
+	if err == nil {
+		req.AuthBearer(tok.AccessToken)
+	}
+	return err
+}
+
+/*
+Returns the current token, fetching a new one if there is no valid cached
+token. The context is used for the token request. Panics on errors; see
+`(*gr.OAuth2).TokenCatch`.
+*/
+func (self *OAuth2) Token(ctx context.Context) OAuth2Token {
+	tok, err := self.token(ctx, ``)
+	if err != nil {
+		panic(err)
+	}
+	return tok
+}
+
+// Non-panicking version of `(*gr.OAuth2).Token`.
+func (self *OAuth2) TokenCatch(ctx context.Context) (OAuth2Token, error) {
+	return self.token(ctx, ``)
+}
+
+func (self *OAuth2) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	tok, err := self.token(ctx, ``)
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+
+	res, err := next.RoundTrip(oauth2Authorize(req, tok))
+	if err != nil || res.StatusCode != http.StatusUnauthorized || !(*Req)(req).isReplayable() {
+		return res, err
+	}
+
+	(*Res)(res).Done()
+
+	tok, err = self.token(ctx, tok.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	req = oauth2Authorize(req, tok)
+	if req.GetBody != nil {
+		req.Body, err = req.GetBody()
+		if err != nil {
+			return nil, errReqBodyClone(err)
+		}
+	}
+	return next.RoundTrip(req)
+}
+
+/*
+Returns a valid cached token or fetches a new one. If the cached token matches
+the given rejected token, it's considered invalid.
+*/
+func (self *OAuth2) token(ctx context.Context, rejected string) (OAuth2Token, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	tok, sem := self.cached()
+	if self.isUsable(tok, rejected) {
+		return tok, nil
+	}
+
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return OAuth2Token{}, errOAuth2(ctx.Err())
+	}
+	defer func() { <-sem }()
+
+	// Another caller may have fetched a new token while we were waiting.
+	tok, _ = self.cached()
+	if self.isUsable(tok, rejected) {
+		return tok, nil
+	}
+
+	refresh := tok.RefreshToken
+	if refresh == `` {
+		refresh = self.RefreshToken
+	}
+
+	tok, err := self.fetchCatch(ctx, refresh)
+	if err != nil {
+		return OAuth2Token{}, errOAuth2(err)
+	}
+
+	self.lock.Lock()
+	self.tok = tok
+	self.lock.Unlock()
+	return tok, nil
+}
+
+func (self *OAuth2) cached() (OAuth2Token, chan struct{}) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.sem == nil {
+		self.sem = make(chan struct{}, 1)
+	}
+	return self.tok, self.sem
+}
+
+func (self *OAuth2) isUsable(tok OAuth2Token, rejected string) bool {
+	return tok.AccessToken != rejected && tok.IsValid(self.leeway())
+}
+
+func (self *OAuth2) leeway() time.Duration {
+	if self.Leeway > 0 {
+		return self.Leeway
+	}
+	return OAuth2Leeway
+}
+
+func (self *OAuth2) fetchCatch(ctx context.Context, refresh string) (_ OAuth2Token, err error) {
+	defer rec(&err)
+	return self.fetch(ctx, refresh), nil
+}
+
+func (self *OAuth2) fetch(ctx context.Context, refresh string) OAuth2Token {
+	vals := url.Values{}
+	for key, val := range self.Params {
+		vals[key] = cloneStrings(val)
+	}
+
+	if refresh != `` {
+		vals.Set(`grant_type`, `refresh_token`)
+		vals.Set(`refresh_token`, refresh)
+	} else {
+		vals.Set(`grant_type`, `client_credentials`)
+	}
+
+	if len(self.Scopes) > 0 {
+		vals.Set(`scope`, strings.Join(self.Scopes, ` `))
+	}
+
+	req := new(Req).Ctx(ctx).Cli(self.Cli).Post().To(self.Url)
+
+	if self.Form {
+		if self.ClientId != `` {
+			vals.Set(`client_id`, self.ClientId)
+		}
+		if self.ClientSecret != `` {
+			vals.Set(`client_secret`, self.ClientSecret)
+		}
+	} else if self.ClientId != `` || self.ClientSecret != `` {
+		// RFC 6749 requires form-encoding the credentials before Basic encoding.
+		req.AuthBasic(url.QueryEscape(self.ClientId), url.QueryEscape(self.ClientSecret))
+	}
+
+	start := time.Now()
+
+	var out OAuth2Token
+	req.FormVals(vals).HeadSet(`Accept`, TypeJson).Res().Ok().Json(&out)
+
+	if out.AccessToken == `` {
+		panic(fmt.Errorf(`missing "access_token" in token response`))
+	}
+	if out.ExpiresIn > 0 {
+		out.Expiry = start.Add(time.Duration(out.ExpiresIn) * time.Second)
+	}
+	if out.RefreshToken == `` {
+		out.RefreshToken = refresh
+	}
+	return out
+}
+
+func oauth2Authorize(req *http.Request, tok OAuth2Token) *http.Request {
+	out := (*Req)(req.Clone(req.Context()))
+	out.AuthBearer(tok.AccessToken)
+	return out.Req()
+}
+
+func errOAuth2(err error) error {
+	return fmt.Errorf(`[gr] failed to obtain OAuth2 token: %w`, err)
+}
@@ -0,0 +1,596 @@
+package gr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	r "reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+Returns a paginator that follows "Link" headers with `rel="next"`, as used by
+many REST APIs such as GitHub. Shortcut for `(*gr.Req).Paginate(gr.PageLink{})`.
+Usage:
+
+	pages := gr.To(`https://api.github.com/repos/golang/go/issues`).Pages()
+	pages.Limit = 10
+
+	for {
+		var page []Issue
+		if !pages.Next(&page) {
+			break
+		}
+		fmt.Println(page)
+	}
+
+Pagination stops after the last page, after `.Limit` pages, or when the
+context of the template request is done. See `gr.Pages`.
+*/
+func (self *Req) Pages() *Pages { return self.Paginate(PageLink{}) }
+
+/*
+Returns a paginator using the given strategy, which determines the request for
+each next page from the previous response. The receiver is used as a template,
+and is never sent or modified. Built-in strategies are `gr.PageLink`,
+`gr.PageCursor` and `gr.PageOffset`. For custom strategies, use `gr.PageFunc`:
+
+	pages := gr.To(`https://api.example.com/items`).Paginate(gr.PageFunc(func(page gr.Page) *gr.Req {
+		next := page.Res.Header.Get(`X-Next-Page`)
+		if next == `` {
+			return nil
+		}
+		return page.Req.Clone().To(next)
+	}))
+
+If the strategy is nil, uses `gr.PageLink`.
+*/
+func (self *Req) Paginate(val Pager) *Pages { return &Pages{Req: self, Pager: val} }
+
+/*
+Pagination strategy used by `gr.Pages`. `.Follow` receives the latest page and
+returns the request for the next page, or nil if there are no more pages. It
+must not modify `gr.Page.Req`; to reuse it, clone it via `(*gr.Req).Clone`.
+*/
+type Pager interface{ Follow(Page) *Req }
+
+/*
+Optional interface for strategies whose pages can be requested by index, without
+waiting for previous responses, such as `gr.PageOffset`. `.PageAt` receives the
+template request and a zero-based page index, and returns a new request.
+Allows `gr.Pages` to fetch pages concurrently; see `gr.Pages.Conc`. In that
+mode, `.Follow` is used only to detect the last page by returning nil.
+*/
+type PageIndexer interface {
+	Pager
+	PageAt(tpl *Req, ind int) *Req
+}
+
+/*
+Function type implementing `gr.Pager`, similar to `http.HandlerFunc`. Allows to
+use an arbitrary function as a pagination strategy.
+*/
+type PageFunc func(Page) *Req
+
+// Implement `gr.Pager` by calling the receiver.
+func (self PageFunc) Follow(val Page) *Req {
+	if self == nil {
+		return nil
+	}
+	return self(val)
+}
+
+/*
+Single page fetched by `gr.Pages`. `.Req` is an unsent copy of the request
+that produced this page. `.Res` is the response, with its body already fully
+read into `.Body` and closed. `.Items` are the elements of the JSON array found
+at `gr.Pages.Items`, or nil if there is no array.
+*/
+type Page struct {
+	Index    int
+	Req      *Req
+	Res      *Res
+	Body     []byte
+	Items    []json.RawMessage
+	itemsErr error
+}
+
+/*
+Pagination driver returned by `(*gr.Req).Pages` and `(*gr.Req).Paginate`.
+
+	* `.Req` is the template request, which is never sent or modified.
+	* `.Pager` is the pagination strategy. If nil, uses `gr.PageLink`.
+	* If `.Limit` is positive, it's the maximum number of pages to fetch.
+	* `.Items` is the dot-separated path to the array of items in each page
+	  body, such as "data" or "result.items", used by `(*gr.Pages).Collect`,
+	  `(*gr.Pages).Stream` and `gr.PageOffset`. If empty, the entire body is
+	  expected to be an array.
+	* If `.Conc` is greater than 1 and the strategy implements `gr.PageIndexer`,
+	  pages are fetched concurrently in batches of at most `.Conc`, while still
+	  being returned in order. Pages after the last page detected by the
+	  strategy are discarded. Other strategies always fetch one page at a time.
+	* After fetching a page, `.Res` is its response, with its body already
+	  closed, which allows to inspect its headers.
+
+Pagination stops after the last page, after `.Limit` pages, or when the context
+of the template request is done. Non-OK responses cause panics in methods such
+as `(*gr.Pages).Next`, with errors from `(*gr.Res).Ok`.
+*/
+type Pages struct {
+	Req   *Req
+	Pager Pager
+	Limit int
+	Items string
+	Conc  int
+	Res   *Res
+	next  *Req
+	count int
+	done  bool
+	queue []pageResult
+}
+
+/*
+Fetches the next page and decodes its JSON body into the given output, which
+must be either nil or a pointer. Before decoding, resets the output to its zero
+value, so that each page is decoded into a fresh value rather than merged with
+the previous one. Returns true if a page was fetched, and false if there are no
+more pages, the page limit was reached, or the context is done. Panics on
+transport errors, non-OK responses (see `(*gr.Res).Ok`), and decoding errors.
+*/
+func (self *Pages) Next(out interface{}) bool {
+	page, ok := self.NextPage()
+	if !ok {
+		return false
+	}
+
+	zeroOutput(out)
+	if !isNilOutput(out) {
+		err := json.Unmarshal(page.Body, out)
+		if err != nil {
+			panic(fmt.Errorf(`[gr] failed to JSON-decode response body: %w`, err))
+		}
+	}
+	return true
+}
+
+/*
+Non-panicking version of `(*gr.Pages).Next`. Returns false and nil if there are
+no more pages.
+*/
+func (self *Pages) NextCatch(out interface{}) (_ bool, err error) {
+	defer rec(&err)
+	return self.Next(out), nil
+}
+
+/*
+Fetches the next page without decoding its body. Returns false if there are no
+more pages. Panics like `(*gr.Pages).Next`.
+*/
+func (self *Pages) NextPage() (Page, bool) {
+	if self == nil {
+		return Page{}, false
+	}
+
+	self.fill()
+	if len(self.queue) == 0 {
+		return Page{}, false
+	}
+
+	head := self.queue[0]
+	self.queue[0] = pageResult{}
+	self.queue = self.queue[1:]
+
+	if head.err != nil {
+		panic(head.err)
+	}
+	self.Res = head.page.Res
+	return head.page, true
+}
+
+// Non-panicking version of `(*gr.Pages).NextPage`.
+func (self *Pages) NextPageCatch() (_ Page, _ bool, err error) {
+	defer rec(&err)
+	page, ok := self.NextPage()
+	return page, ok, nil
+}
+
+/*
+Fetches all remaining pages and appends their items to the given output, which
+must be a non-nil pointer to a slice. Items are found via `.Items` and decoded
+from JSON into new slice elements. Panics on errors, like `(*gr.Pages).Next`.
+*/
+func (self *Pages) Collect(out interface{}) {
+	val := r.ValueOf(out)
+	if val.Kind() != r.Ptr || val.IsNil() || val.Elem().Kind() != r.Slice {
+		panic(fmt.Errorf(`[gr] failed to collect page items: expected non-nil pointer to slice, got %T`, out))
+	}
+	val = val.Elem()
+
+	for {
+		page, ok := self.NextPage()
+		if !ok {
+			return
+		}
+		if page.itemsErr != nil {
+			panic(page.itemsErr)
+		}
+
+		for _, item := range page.Items {
+			elem := r.New(val.Type().Elem())
+			decodePageItem(item, elem.Interface())
+			val.Set(r.Append(val, elem.Elem()))
+		}
+	}
+}
+
+// Non-panicking version of `(*gr.Pages).Collect`.
+func (self *Pages) CollectCatch(out interface{}) (err error) {
+	defer rec(&err)
+	self.Collect(out)
+	return
+}
+
+/*
+Returns an iterator over the items of all remaining pages, fetching pages on
+demand. Items are found via `.Items`. Usage:
+
+	items := pages.Stream()
+	for {
+		var val Item
+		if !items.Next(&val) {
+			break
+		}
+		fmt.Println(val)
+	}
+*/
+func (self *Pages) Stream() *PageItems { return &PageItems{Pages: self} }
+
+// Count of pages fetched so far, including pages prefetched concurrently.
+func (self *Pages) Count() int {
+	if self == nil {
+		return 0
+	}
+	return self.count
+}
+
+func (self *Pages) pager() Pager {
+	if self.Pager == nil {
+		return PageLink{}
+	}
+	return self.Pager
+}
+
+func (self *Pages) isDone() bool {
+	ctx := self.Req.Context()
+	return ctx != nil && ctx.Err() != nil
+}
+
+func (self *Pages) fill() {
+	if len(self.queue) > 0 || self.done {
+		return
+	}
+
+	if self.Req == nil || (self.Limit > 0 && self.count >= self.Limit) || self.isDone() {
+		self.done = true
+		return
+	}
+
+	indexer, _ := self.pager().(PageIndexer)
+	if indexer != nil && self.Conc > 1 {
+		self.fillConc(indexer)
+		return
+	}
+
+	req := self.next
+	if self.count == 0 {
+		if indexer != nil {
+			req = indexer.PageAt(self.Req, 0)
+		} else {
+			req = self.Req.Clone()
+		}
+	}
+
+	self.add(self.fetch(req, self.count))
+	if self.done {
+		return
+	}
+
+	// Prevents further requests if the strategy panics.
+	self.done = true
+	self.next = self.pager().Follow(self.queue[len(self.queue)-1].page)
+	self.done = self.next == nil
+}
+
+func (self *Pages) fillConc(indexer PageIndexer) {
+	size := self.Conc
+	if self.Limit > 0 && self.Limit-self.count < size {
+		size = self.Limit - self.count
+	}
+
+	out := make([]pageResult, size)
+	var group sync.WaitGroup
+	for ind := range iter(size) {
+		req := indexer.PageAt(self.Req, self.count+ind)
+		group.Add(1)
+		go func(ind int, req *Req) {
+			defer group.Done()
+			out[ind] = self.fetch(req, self.count+ind)
+		}(ind, req)
+	}
+	group.Wait()
+
+	// Also prevents further requests if the strategy panics.
+	self.done = true
+	for _, val := range out {
+		self.add(val)
+		if val.err != nil || indexer.Follow(val.page) == nil {
+			return
+		}
+	}
+	self.done = false
+}
+
+func (self *Pages) add(val pageResult) {
+	if val.err != nil {
+		self.done = true
+		if self.isDone() {
+			return
+		}
+	} else {
+		self.count++
+	}
+	self.queue = append(self.queue, val)
+}
+
+type pageResult struct {
+	page Page
+	err  error
+}
+
+func (self *Pages) fetch(req *Req, ind int) (out pageResult) {
+	defer rec(&out.err)
+
+	res := req.Clone().Res()
+	res.Ok()
+
+	body := res.ReadBytes()
+	items, err := pageItems(body, self.Items)
+
+	out.page = Page{Index: ind, Req: req, Res: res, Body: body, itemsErr: err}
+	if err == nil {
+		out.page.Items = items
+	}
+	return
+}
+
+/*
+Iterator over page items, returned by `(*gr.Pages).Stream`. Fetches pages from
+`.Pages` on demand.
+*/
+type PageItems struct {
+	Pages *Pages
+	items []json.RawMessage
+}
+
+/*
+Decodes the next item into the given output, which must be a non-nil pointer.
+Before decoding, resets the output to its zero value. Returns false if there are
+no more items. Panics on errors, like `(*gr.Pages).Next`.
+*/
+func (self *PageItems) Next(out interface{}) bool {
+	if self == nil {
+		return false
+	}
+
+	for len(self.items) == 0 {
+		page, ok := self.Pages.NextPage()
+		if !ok {
+			return false
+		}
+		if page.itemsErr != nil {
+			panic(page.itemsErr)
+		}
+		self.items = page.Items
+	}
+
+	item := self.items[0]
+	self.items = self.items[1:]
+
+	zeroOutput(out)
+	decodePageItem(item, out)
+	return true
+}
+
+/*
+Non-panicking version of `(*gr.PageItems).Next`. Returns false and nil if there
+are no more items.
+*/
+func (self *PageItems) NextCatch(out interface{}) (_ bool, err error) {
+	defer rec(&err)
+	return self.Next(out), nil
+}
+
+/*
+Pagination strategy following "Link" headers with `rel="next"`, resolved via
+`(*gr.Res).LinkUrl`. Used by `(*gr.Req).Pages`.
+*/
+type PageLink struct{}
+
+// Implement `gr.Pager`.
+func (PageLink) Follow(page Page) *Req {
+	next := page.Res.LinkUrl(`next`)
+	if next == nil {
+		return nil
+	}
+	return page.Req.Clone().Url(next)
+}
+
+/*
+Pagination strategy for cursors in JSON bodies. `.Field` is the dot-separated
+path to the cursor in the response body, such as "meta.next_cursor". `.Param`
+is the query parameter used to send the cursor, defaulting to "cursor". The
+cursor may be a string or a number. Pagination stops when the cursor is
+missing, null, false, or an empty string.
+*/
+type PageCursor struct {
+	Field string
+	Param string
+}
+
+// Implement `gr.Pager`.
+func (self PageCursor) Follow(page Page) *Req {
+	src, err := jsonPath(page.Body, self.Field)
+	if err != nil {
+		panic(fmt.Errorf(`[gr] failed to find page cursor %q: %w`, self.Field, err))
+	}
+
+	cursor := jsonScalarString(src)
+	if cursor == `` {
+		return nil
+	}
+	return reqQuerySet(page.Req.Clone(), strDefault(self.Param, `cursor`), cursor)
+}
+
+/*
+Pagination strategy for offset and limit query parameters. `.Offset` and
+`.Limit` are parameter names, defaulting to "offset" and "limit". `.Size` is
+the page size, sent as the limit, and must be positive. `.Start` is the offset
+of the first page. Pagination stops when a page has fewer than `.Size` items,
+counted via `gr.Pages.Items`.
+
+Implements `gr.PageIndexer`, allowing concurrent fetching via `gr.Pages.Conc`.
+*/
+type PageOffset struct {
+	Offset string
+	Limit  string
+	Size   int
+	Start  int
+}
+
+// Implement `gr.Pager`.
+func (self PageOffset) Follow(page Page) *Req {
+	if len(page.Items) < self.Size {
+		return nil
+	}
+	return self.PageAt(page.Req, page.Index+1)
+}
+
+// Implement `gr.PageIndexer`.
+func (self PageOffset) PageAt(tpl *Req, ind int) *Req {
+	if self.Size <= 0 {
+		panic(fmt.Errorf(`[gr] failed to paginate: expected positive page size, got %v`, self.Size))
+	}
+
+	req := tpl.Clone()
+	reqQuerySet(req, strDefault(self.Offset, `offset`), strconv.Itoa(self.Start+ind*self.Size))
+	reqQuerySet(req, strDefault(self.Limit, `limit`), strconv.Itoa(self.Size))
+	return req
+}
+
+func reqQuerySet(req *Req, key, val string) *Req {
+	req.initUrl()
+	query := req.URL.Query()
+	query.Set(key, val)
+	req.URL.RawQuery = query.Encode()
+	return req
+}
+
+func strDefault(val, def string) string {
+	if val == `` {
+		return def
+	}
+	return val
+}
+
+func decodePageItem(src json.RawMessage, out interface{}) {
+	err := json.Unmarshal(src, out)
+	if err != nil {
+		panic(fmt.Errorf(`[gr] failed to JSON-decode page item: %w`, err))
+	}
+}
+
+// Finds the array at the given path. Missing and null values are empty.
+func pageItems(src []byte, path string) (out []json.RawMessage, err error) {
+	src, err = jsonPath(src, path)
+	if err == nil && !isJsonNull(src) {
+		err = json.Unmarshal(src, &out)
+	}
+	if err != nil {
+		err = fmt.Errorf(`[gr] failed to decode page items at %q: %w`, path, err)
+	}
+	return
+}
+
+/*
+Finds a value by a dot-separated path of object keys and array indexes.
+Returns nil if not found.
+*/
+func jsonPath(src []byte, path string) (json.RawMessage, error) {
+	if path == `` {
+		return src, nil
+	}
+
+	for _, key := range strings.Split(path, `.`) {
+		src = bytes.TrimSpace(src)
+
+		switch {
+		case bytes.HasPrefix(src, []byte(`{`)):
+			var dict map[string]json.RawMessage
+			err := json.Unmarshal(src, &dict)
+			if err != nil {
+				return nil, err
+			}
+			src = dict[key]
+
+		case bytes.HasPrefix(src, []byte(`[`)):
+			var list []json.RawMessage
+			err := json.Unmarshal(src, &list)
+			if err != nil {
+				return nil, err
+			}
+			ind, err := strconv.Atoi(key)
+			if err != nil || ind < 0 || ind >= len(list) {
+				return nil, nil
+			}
+			src = list[ind]
+
+		default:
+			return nil, nil
+		}
+	}
+	return src, nil
+}
+
+// Converts strings and numbers to strings. Other values become empty.
+func jsonScalarString(src []byte) string {
+	src = bytes.TrimSpace(src)
+	if len(src) == 0 {
+		return ``
+	}
+
+	if src[0] == '"' {
+		var out string
+		_ = json.Unmarshal(src, &out)
+		return out
+	}
+
+	if src[0] == '-' || (src[0] >= '0' && src[0] <= '9') {
+		return string(src)
+	}
+	return ``
+}
+
+func isJsonNull(src []byte) bool {
+	src = bytes.TrimSpace(src)
+	return len(src) == 0 || string(src) == `null`
+}
+
+func zeroOutput(out interface{}) {
+	val := r.ValueOf(out)
+	if val.Kind() == r.Ptr && !val.IsNil() {
+		val = val.Elem()
+		val.Set(r.Zero(val.Type()))
+	}
+}
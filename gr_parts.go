@@ -0,0 +1,284 @@
+package gr
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/*
+True if the parsed media type of `Content-Type` is any "multipart/*" type, such
+as `gr.TypeMulti`, `gr.TypeMultiMixed`, or `gr.TypeMultiRange`. Unlike
+`(*gr.Res).IsMulti`, which only checks for `gr.TypeMulti`.
+*/
+func (self *Res) IsMultipart() bool {
+	return strings.HasPrefix(self.MediaType(), `multipart/`)
+}
+
+/*
+Returns a streaming reader of a multipart response, which reads the parts one
+by one, without buffering the entire body. Supports any "multipart/*" media
+type, including "multipart/form-data", "multipart/mixed" and
+"multipart/byteranges". Uses the boundary from `(*gr.Res).Media`. Panics if the
+response is not multipart or the boundary is missing. Usage:
+
+	parts := res.Parts()
+	defer parts.Done()
+
+	for part := parts.Next(); part != nil; part = parts.Next() {
+		fmt.Println(part.Header)
+		fmt.Println(part.ReadString())
+	}
+
+The reader closes the response body after reading the last part or failing.
+To stop early, call `(*gr.Parts).Done`.
+*/
+func (self *Res) Parts() *Parts {
+	typ, par := self.Media()
+
+	if !strings.HasPrefix(typ, `multipart/`) {
+		defer self.Done()
+		panic(fmt.Errorf(`[gr] failed to read multipart response: unexpected media type %q`, typ))
+	}
+
+	bound := par[`boundary`]
+	if bound == `` {
+		defer self.Done()
+		panic(fmt.Errorf(`[gr] failed to read multipart response: missing boundary in media type %q`, typ))
+	}
+
+	out := &Parts{Body: self.Body}
+	if self.Body != nil {
+		out.Reader = multipart.NewReader(self.Body, bound)
+	}
+	return out
+}
+
+/*
+Non-panicking version of `(*gr.Res).Parts`. Closes the response body in case
+of error.
+*/
+func (self *Res) PartsCatch() (_ *Parts, err error) {
+	defer rec(&err)
+	return self.Parts(), nil
+}
+
+/*
+Streaming reader of multipart response bodies. Returned by `(*gr.Res).Parts`.
+Wraps `multipart.Reader`, and also holds the original response body in order to
+close it.
+*/
+type Parts struct {
+	Reader *multipart.Reader
+	Body   io.ReadCloser
+}
+
+/*
+Returns the next part, or nil if there are no more parts. Panics if reading
+fails. Closes the response body after the last part, or when panicking. The
+returned part is valid only until the next call.
+*/
+func (self *Parts) Next() *Part {
+	if self == nil || self.Reader == nil {
+		self.Done()
+		return nil
+	}
+
+	part, err := self.Reader.NextPart()
+	if err == io.EOF {
+		self.Done()
+		return nil
+	}
+	if err != nil {
+		self.Done()
+		panic(fmt.Errorf(`[gr] failed to read multipart response: %w`, err))
+	}
+	return (*Part)(part)
+}
+
+/*
+Non-panicking version of `(*gr.Parts).Next`. Returns nil and nil if there are
+no more parts.
+*/
+func (self *Parts) NextCatch() (_ *Part, err error) {
+	defer rec(&err)
+	return self.Next(), nil
+}
+
+// Closes the response body if possible. Can be deferred.
+func (self *Parts) Done() {
+	if self != nil && self.Body != nil {
+		_ = self.Body.Close()
+		self.Reader = nil
+	}
+}
+
+/*
+Alias of `multipart.Part` with shortcuts for inspecting and decoding a part of a
+multipart response. Freely castable to and from `multipart.Part`.
+*/
+type Part multipart.Part
+
+// Free cast to `*multipart.Part`.
+func (self *Part) Part() *multipart.Part { return (*multipart.Part)(self) }
+
+// Shortcut for `(*multipart.Part).FormName`.
+func (self *Part) FormName() string { return self.Part().FormName() }
+
+// Shortcut for `(*multipart.Part).FileName`.
+func (self *Part) FileName() string { return self.Part().FileName() }
+
+// Returns the part headers as `gr.Head`.
+func (self *Part) Head() Head { return Head(self.Header) }
+
+/*
+Returns a response-like view of the part, which has the part headers and uses
+the part as its body. Allows to inspect and decode the part with any
+`gr.Res` method, such as `(*gr.Res).MediaType`, `(*gr.Res).JsonCatch`, or
+`(*gr.Res).XmlWith`. Closing the view's body is a nop.
+*/
+func (self *Part) Res() *Res {
+	return &Res{Header: http.Header(self.Header), Body: io.NopCloser(self.Part())}
+}
+
+// Shortcut for `self.Res().ReadBytes()`.
+func (self *Part) ReadBytes() []byte { return self.Res().ReadBytes() }
+
+// Shortcut for `self.Res().ReadString()`.
+func (self *Part) ReadString() string { return self.Res().ReadString() }
+
+// Shortcut for `self.Res().Form()`.
+func (self *Part) Form() url.Values { return self.Res().Form() }
+
+// Shortcut for `self.Res().Json(out)`. Returns the same part.
+func (self *Part) Json(out interface{}) *Part {
+	self.Res().Json(out)
+	return self
+}
+
+// Shortcut for `self.Res().Xml(out)`. Returns the same part.
+func (self *Part) Xml(out interface{}) *Part {
+	self.Res().Xml(out)
+	return self
+}
+
+// Shortcut for `self.Res().XmlWith(out, fun)`. Returns the same part.
+func (self *Part) XmlWith(out interface{}, fun func(*xml.Decoder)) *Part {
+	self.Res().XmlWith(out, fun)
+	return self
+}
+
+/*
+Parses the header "Content-Range" of a part of a "multipart/byteranges"
+response. Panics if the header is missing or malformed.
+*/
+func (self *Part) Range() ContentRange {
+	return ParseContentRange(self.Head().Get(`Content-Range`))
+}
+
+/*
+Parses the part as an HTTP response embedded in a "multipart/mixed" batch
+response, where each part has the type `gr.TypeHttp`. Panics if parsing fails.
+The resulting response body is valid only until the next part is read.
+*/
+func (self *Part) HttpRes() *Res {
+	res, err := http.ReadResponse(bufio.NewReader(self.Part()), nil)
+	if err != nil {
+		panic(fmt.Errorf(`[gr] failed to parse embedded HTTP response: %w`, err))
+	}
+	return (*Res)(res)
+}
+
+/*
+Non-panicking version of `(*gr.Part).HttpRes`.
+*/
+func (self *Part) HttpResCatch() (_ *Res, err error) {
+	defer rec(&err)
+	return self.HttpRes(), nil
+}
+
+/*
+Parsed representation of the header "Content-Range" in its "bytes" form, such
+as "bytes 0-499/1234". `.End` is inclusive. `.Size` is -1 when the complete
+length is unknown, as in "bytes 0-499/*".
+*/
+type ContentRange struct {
+	Start int64
+	End   int64
+	Size  int64
+}
+
+// Length of the range in bytes.
+func (self ContentRange) Len() int64 { return self.End - self.Start + 1 }
+
+// Encodes the range in the format of the "Content-Range" header.
+func (self ContentRange) String() string {
+	size := `*`
+	if self.Size >= 0 {
+		size = strconv.FormatInt(self.Size, 10)
+	}
+	return `bytes ` +
+		strconv.FormatInt(self.Start, 10) + `-` +
+		strconv.FormatInt(self.End, 10) + `/` + size
+}
+
+/*
+Parses the "bytes" form of the header "Content-Range", such as
+"bytes 0-499/1234" or "bytes 0-499/*". Panics if the input is malformed.
+*/
+func ParseContentRange(src string) ContentRange {
+	val, ok := parseContentRange(src)
+	if !ok {
+		panic(fmt.Errorf(`[gr] failed to parse content range %q`, src))
+	}
+	return val
+}
+
+func parseContentRange(src string) (out ContentRange, _ bool) {
+	const prefix = `bytes `
+
+	src = strings.TrimSpace(src)
+	if !strings.HasPrefix(src, prefix) {
+		return out, false
+	}
+	src = strings.TrimSpace(src[len(prefix):])
+
+	ind := strings.IndexByte(src, '/')
+	if ind < 0 {
+		return out, false
+	}
+	span, size := src[:ind], src[ind+1:]
+
+	ind = strings.IndexByte(span, '-')
+	if ind < 0 {
+		return out, false
+	}
+
+	var err error
+	out.Start, err = strconv.ParseInt(span[:ind], 10, 64)
+	if err != nil || out.Start < 0 {
+		return out, false
+	}
+
+	out.End, err = strconv.ParseInt(span[ind+1:], 10, 64)
+	if err != nil || out.End < out.Start {
+		return out, false
+	}
+
+	if size == `*` {
+		out.Size = -1
+		return out, true
+	}
+
+	out.Size, err = strconv.ParseInt(size, 10, 64)
+	if err != nil || out.Size <= out.End {
+		return out, false
+	}
+	return out, true
+}
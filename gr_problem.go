@@ -0,0 +1,158 @@
+package gr
+
+import (
+	"encoding/json"
+	"mime"
+	"strconv"
+)
+
+// Default problem type defined by RFC 9457, used when "type" is absent.
+const ProblemTypeBlank = `about:blank`
+
+/*
+Problem details as defined by RFC 9457, decoded from responses with the media
+type `gr.TypeProblem` ("application/problem+json"). `(*gr.Res).Err`, and
+therefore `(*gr.Res).Ok` and `(*gr.Res).Redir`, decode such responses into
+`gr.Err.Problem`. Fields other than the standard ones go into `.Ext`, keyed by
+their JSON names.
+
+Implements `error`, and `gr.Err` supports `errors.As` with `*gr.Problem` as the
+target, which allows to match problem types without decoding the body by hand:
+
+	var prob gr.Problem
+	if errors.As(err, &prob) && prob.Type == `https://example.com/probs/out-of-credit` {
+		// ...
+	}
+
+When decoding, if "type" is absent, `.Type` is set to `gr.ProblemTypeBlank`, as
+specified by the RFC. Members with invalid types, such as a non-numeric
+"status", are ignored, as recommended by the RFC.
+*/
+type Problem struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	Ext      map[string]interface{}
+}
+
+// Implement the `error` interface.
+func (self Problem) Error() string {
+	return bytesString(self.AppendTo(nil))
+}
+
+// Appends the error representation. Used internally by `.Error`.
+func (self Problem) AppendTo(buf []byte) []byte {
+	buf = growBytes(buf, 64)
+	buf = append(buf, `[gr] problem`...)
+
+	if self.Type != `` && self.Type != ProblemTypeBlank {
+		buf = append(buf, ` `...)
+		buf = strconv.AppendQuote(buf, self.Type)
+	}
+
+	if self.Status != 0 {
+		buf = append(buf, ` (HTTP status `...)
+		buf = strconv.AppendInt(buf, int64(self.Status), 10)
+		buf = append(buf, `)`...)
+	}
+
+	if self.Title != `` {
+		buf = append(buf, `: `...)
+		buf = append(buf, self.Title...)
+	}
+
+	if self.Detail != `` {
+		buf = append(buf, `: `...)
+		buf = append(buf, self.Detail...)
+	}
+	return buf
+}
+
+/*
+Implement `json.Marshaler`, encoding the standard members and the extension
+members from `.Ext` into one object. Empty standard members are omitted.
+*/
+func (self Problem) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{}, len(self.Ext)+5)
+	for key, val := range self.Ext {
+		out[key] = val
+	}
+
+	problemSet(out, `type`, self.Type)
+	problemSet(out, `title`, self.Title)
+	problemSet(out, `detail`, self.Detail)
+	problemSet(out, `instance`, self.Instance)
+	if self.Status != 0 {
+		out[`status`] = self.Status
+	}
+	return json.Marshal(out)
+}
+
+// Implement `json.Unmarshaler`. See `gr.Problem` for the rules.
+func (self *Problem) UnmarshalJSON(src []byte) error {
+	var dict map[string]json.RawMessage
+	err := json.Unmarshal(src, &dict)
+	if err != nil {
+		return err
+	}
+
+	*self = Problem{}
+	for key, val := range dict {
+		switch key {
+		case `type`:
+			_ = json.Unmarshal(val, &self.Type)
+		case `title`:
+			_ = json.Unmarshal(val, &self.Title)
+		case `status`:
+			_ = json.Unmarshal(val, &self.Status)
+		case `detail`:
+			_ = json.Unmarshal(val, &self.Detail)
+		case `instance`:
+			_ = json.Unmarshal(val, &self.Instance)
+		default:
+			var ext interface{}
+			err := json.Unmarshal(val, &ext)
+			if err != nil {
+				return err
+			}
+			if self.Ext == nil {
+				self.Ext = map[string]interface{}{}
+			}
+			self.Ext[key] = ext
+		}
+	}
+
+	if self.Type == `` {
+		self.Type = ProblemTypeBlank
+	}
+	return nil
+}
+
+func problemSet(out map[string]interface{}, key, val string) {
+	if val != `` {
+		out[key] = val
+	}
+}
+
+/*
+True if the parsed media type of `Content-Type` is `gr.TypeProblem`. Like
+`(*gr.Res).MediaType`, panics if the header is malformed.
+*/
+func (self *Res) IsProblem() bool { return self.MediaType() == TypeProblem }
+
+// Non-panicking version of `(*gr.Res).IsProblem` used by `(*gr.Res).Err`.
+func (self *Res) isProblem() bool {
+	typ, _, _ := mime.ParseMediaType(self.Type())
+	return typ == TypeProblem
+}
+
+// Decodes problem details, ignoring invalid bodies.
+func decodeProblem(src []byte) *Problem {
+	var out Problem
+	if json.Unmarshal(src, &out) != nil {
+		return nil
+	}
+	return &out
+}
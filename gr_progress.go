@@ -0,0 +1,154 @@
+package gr
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+/*
+Progress of reading a request or response body, reported to `gr.ProgressFunc`.
+`.Done` is the count of bytes read so far. `.Total` is the expected count from
+`.ContentLength`, or -1 if unknown. `.Rate` is the average rate in bytes per
+second since the first read. `.Elapsed` is the time since the first read.
+`.End` is true on the last report, after the body has been fully read, either
+reaching `.Total` or the end of the stream.
+*/
+type Progress struct {
+	Done    int64
+	Total   int64
+	Rate    float64
+	Elapsed time.Duration
+	End     bool
+}
+
+/*
+Fraction of the body read so far, between 0 and 1. Returns -1 if the total is
+unknown.
+*/
+func (self Progress) Ratio() float64 {
+	if self.Total < 0 {
+		return -1
+	}
+	if self.Total == 0 {
+		return 1
+	}
+	return float64(self.Done) / float64(self.Total)
+}
+
+/*
+Callback for progress reporting, used by `(*gr.Req).Progress`,
+`(*gr.Res).Progress` and `gr.ProgressReadCloser`. Called synchronously after
+each read that returns a non-zero count of bytes, and once more at the end of
+the body. Must be fast.
+*/
+type ProgressFunc func(Progress)
+
+/*
+Wraps `.Body` to report upload progress to the given function, with the total
+from `.ContentLength`. Also wraps `.GetBody`, so that bodies replayed for
+redirects, retries, or by `(*gr.Req).Clone`, also report progress, starting
+from zero. Must be called after setting the body, for example via
+`(*gr.Req).Bytes` or `(*gr.Req).Reader`. Closing the body is delegated to the
+original body. If the body or the function is nil, this is a nop. Mutates and
+returns the receiver.
+
+For requests, `.ContentLength` of zero with a non-nil body means that the
+length is unknown, which is reported as -1.
+*/
+func (self *Req) Progress(fun ProgressFunc) *Req {
+	if fun == nil || self.Body == nil || self.Body == http.NoBody {
+		return self
+	}
+
+	total := self.ContentLength
+	if total == 0 {
+		total = -1
+	}
+
+	self.Body = NewProgressReadCloser(self.Body, total, fun)
+
+	getBody := self.GetBody
+	if getBody != nil {
+		self.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil || body == nil || body == http.NoBody {
+				return body, err
+			}
+			return NewProgressReadCloser(body, total, fun), nil
+		}
+	}
+	return self
+}
+
+/*
+Wraps `.Body` to report download progress to the given function, with the
+total from `.ContentLength`, which is -1 when unknown. Closing the body is
+delegated to the original body, so the usual methods such as
+`(*gr.Res).ReadBytes` and `(*gr.Res).Done` work as before. If the body or the
+function is nil, this is a nop. Mutates and returns the receiver.
+*/
+func (self *Res) Progress(fun ProgressFunc) *Res {
+	if fun == nil || self.Body == nil || self.Body == http.NoBody {
+		return self
+	}
+	self.Body = NewProgressReadCloser(self.Body, self.ContentLength, fun)
+	return self
+}
+
+/*
+Creates a `gr.ProgressReadCloser` which reports progress of reading the given
+body to the given function. The total is the expected count of bytes, or -1 if
+unknown.
+*/
+func NewProgressReadCloser(body io.ReadCloser, total int64, fun ProgressFunc) *ProgressReadCloser {
+	return &ProgressReadCloser{ReadCloser: body, Total: total, Fun: fun}
+}
+
+/*
+Wraps an `io.ReadCloser`, reporting progress to `.Fun` after each read. See
+`gr.ProgressFunc`. Used by `(*gr.Req).Progress` and `(*gr.Res).Progress`.
+Not safe for concurrent reads, like most readers.
+*/
+type ProgressReadCloser struct {
+	io.ReadCloser
+	Total int64
+	Fun   ProgressFunc
+	done  int64
+	start time.Time
+	end   bool
+}
+
+// Implement `io.Reader`, reporting progress.
+func (self *ProgressReadCloser) Read(buf []byte) (int, error) {
+	if self.start.IsZero() {
+		self.start = time.Now()
+	}
+
+	size, err := self.ReadCloser.Read(buf)
+	self.done += int64(size)
+
+	if size > 0 || (err == io.EOF && !self.end) {
+		self.end = err == io.EOF || (self.Total >= 0 && self.done >= self.Total)
+		self.report()
+	}
+	return size, err
+}
+
+// Returns the current progress.
+func (self *ProgressReadCloser) Progress() Progress {
+	out := Progress{Done: self.done, Total: self.Total, End: self.end}
+	if !self.start.IsZero() {
+		out.Elapsed = time.Since(self.start)
+		if out.Elapsed > 0 {
+			out.Rate = float64(self.done) / out.Elapsed.Seconds()
+		}
+	}
+	return out
+}
+
+func (self *ProgressReadCloser) report() {
+	if self.Fun != nil {
+		self.Fun(self.Progress())
+	}
+}
@@ -581,7 +581,7 @@ func (self *Req) CliRes(cli *http.Client) *Res {
 
 	res, err := cli.Do(self.Init().Req())
 	if err != nil {
-		panic(fmt.Errorf(`[gr] failed to perform HTTP request: %w`, err))
+		panic(errReqRes(err))
 	}
 
 	return (*Res)(res)
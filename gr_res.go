@@ -371,41 +371,52 @@ func (self *Res) XmlWithCatch(out interface{}, fun func(*xml.Decoder)) (err erro
 }
 
 /*
-Returns an error that includes the response HTTP status code and the downloaded
-body, as well as the provided short description. Always downloads and closes
-the response body, if any. The description must be non-empty, and represent a
-reason why the response is unsatisfactory, such as "non-OK" or "non-redirect".
+Returns an error that includes the response HTTP status code, headers, content
+type, and the downloaded body, the method and URL of `.Request` if any, as well
+as the provided short description. If the body is "application/problem+json",
+also decodes it into `gr.Err.Problem`. Always downloads and closes the response
+body, if any. The description must be non-empty, and represent a reason why the
+response is unsatisfactory, such as "non-OK" or "non-redirect".
 */
 func (self *Res) Err(desc string) Err {
+	out := Err{
+		Status: self.StatusCode,
+		Type:   self.Type(),
+		Header: self.Header.Clone(),
+	}
+
+	req := self.Request
+	if req != nil {
+		out.Method = req.Method
+		if req.URL != nil {
+			out.Url = req.URL.Redacted()
+		}
+	}
+
 	body := self.Body
 	if body == nil {
-		return Err{
-			Status: self.StatusCode,
-			Cause:  errResUnexpectedWithEmptyBody(desc),
-		}
+		out.Cause = errResUnexpectedWithEmptyBody(desc)
+		return out
 	}
 	defer body.Close()
 
 	chunk, err := io.ReadAll(body)
 	if err != nil {
-		return Err{
-			Status: self.StatusCode,
-			Cause:  errResUnexpectedFailedToReadBody(desc),
-		}
+		out.Cause = errResUnexpectedFailedToReadBody(desc)
+		return out
 	}
 
 	if len(chunk) == 0 {
-		return Err{
-			Status: self.StatusCode,
-			Cause:  errResUnexpectedWithEmptyBody(desc),
-		}
+		out.Cause = errResUnexpectedWithEmptyBody(desc)
+		return out
 	}
 
-	return Err{
-		Status: self.StatusCode,
-		Body:   chunk,
-		Cause:  errResUnexpected(desc),
+	out.Body = chunk
+	out.Cause = errResUnexpected(desc)
+	if self.isProblem() {
+		out.Problem = decodeProblem(chunk)
 	}
+	return out
 }
 
 /*
@@ -0,0 +1,288 @@
+package gr
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Default for `gr.Retry.Min`.
+	RetryMin = time.Millisecond * 100
+
+	// Default for `gr.Retry.Max`.
+	RetryMax = time.Second * 30
+)
+
+/*
+Short for "retry policy". Used by `(*gr.Req).RetryRes` and
+`(*gr.Req).RetryCliRes`. Describes how many times to retry a request, which
+responses to retry, and how long to wait between attempts.
+
+Transport errors are always retried, unless the request context is done.
+Responses are retried only when their status code is listed in `.Status`.
+
+The delay before each retry grows exponentially from `.Min`, doubling after
+each attempt, and is capped at `.Max`. The delay is randomized ("jittered")
+between half and full of its nominal value. If the response has the header
+"Retry-After", the delay is at least as long as that header demands, but never
+longer than `.Max`, which prevents the server from suspending the caller
+indefinitely. To honor longer "Retry-After", raise `.Max` accordingly.
+
+If the request context has a deadline, and the next attempt would begin after
+that deadline, retrying stops early, returning the last response or panicking
+with the last transport error.
+*/
+type Retry struct {
+	Count  int           // Max retries after the first attempt. 0 = no retries.
+	Status []int         // HTTP status codes to retry, such as 429 and 503.
+	Min    time.Duration // Base delay. 0 = `gr.RetryMin`.
+	Max    time.Duration // Max delay before jitter. 0 = `gr.RetryMax`.
+}
+
+// True if the given HTTP status code is listed in `.Status`.
+func (self Retry) HasStatus(code int) bool {
+	for _, val := range self.Status {
+		if val == code {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Returns the nominal delay before the retry with the given index, starting at 0,
+without jitter and without considering "Retry-After".
+*/
+func (self Retry) Backoff(ind int) time.Duration {
+	min, max := self.min(), self.max()
+	out := min
+
+	for range iter(ind) {
+		if out >= max/2 {
+			return max
+		}
+		out *= 2
+	}
+
+	if out > max {
+		return max
+	}
+	return out
+}
+
+func (self Retry) min() time.Duration {
+	if self.Min > 0 {
+		return self.Min
+	}
+	return RetryMin
+}
+
+func (self Retry) max() time.Duration {
+	if self.Max > 0 {
+		return self.Max
+	}
+	return RetryMax
+}
+
+func (self Retry) delay(ind int, res *Res) time.Duration {
+	out := jitter(self.Backoff(ind))
+
+	after := res.RetryAfter()
+	if max := self.max(); after > max {
+		after = max
+	}
+	if after > out {
+		return after
+	}
+	return out
+}
+
+func (self Retry) shouldRetry(ctx context.Context, res *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return res != nil && self.HasStatus(res.StatusCode)
+}
+
+/*
+Shortcut for `self.RetryCliRes(self.Client(), opt)`. Similar to
+`(*gr.Req).Res`, but retries according to the given policy. See `gr.Retry` for
+the details.
+
+The caller MUST close the response body by calling `*gr.Res.Done` or its other
+reading or closing methods.
+*/
+func (self *Req) RetryRes(opt Retry) *Res {
+	return self.RetryCliRes(self.Client(), opt)
+}
+
+/*
+Variant of `(*gr.Req).RetryRes` that returns an error instead of panicking. If
+the response is non-nil, the caller MUST close the response body by calling
+`*gr.Res.Done` or its other reading or closing methods.
+*/
+func (self *Req) RetryResCatch(opt Retry) (_ *Res, err error) {
+	defer rec(&err)
+	return self.RetryRes(opt), nil
+}
+
+/*
+Similar to `(*gr.Req).CliRes`, but retries according to the given policy. See
+`gr.Retry` for the details. If the client is nil, uses `http.DefaultClient`.
+Panics on the last transport error, but NOT in case of HTTP responses with
+non-OK status codes, including the codes listed in `gr.Retry.Status`.
+
+Each retry obtains a fresh copy of the body from `.GetBody`, which is set by
+`(*gr.Req).String`, `(*gr.Req).Bytes` and related methods. If the request has a
+body but no `.GetBody`, for example after `(*gr.Req).Reader`, the body can't be
+replayed, and this panics before sending anything. The receiver itself is sent
+on the first attempt; retries use shallow copies.
+
+The caller MUST close the response body by calling `*gr.Res.Done` or its other
+reading or closing methods.
+*/
+func (self *Req) RetryCliRes(cli *http.Client, opt Retry) *Res {
+	if opt.Count <= 0 {
+		return self.CliRes(cli)
+	}
+
+	if !self.isReplayable() {
+		panic(errRetryBody)
+	}
+
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+
+	req := self.Init()
+	ctx := req.Context()
+
+	for ind := 0; ; ind++ {
+		res, err := cli.Do(req.attempt(ind))
+
+		if ind >= opt.Count || !opt.shouldRetry(ctx, res, err) {
+			if err != nil {
+				panic(errReqRes(err))
+			}
+			return (*Res)(res)
+		}
+
+		delay := opt.delay(ind, (*Res)(res))
+
+		if !ctxAllows(ctx, delay) {
+			if err != nil {
+				panic(errReqRes(err))
+			}
+			return (*Res)(res)
+		}
+
+		if res != nil {
+			(*Res)(res).Done()
+		}
+
+		err = sleep(ctx, delay)
+		if err != nil {
+			panic(errReqRes(err))
+		}
+	}
+}
+
+/*
+Variant of `(*gr.Req).RetryCliRes` that returns an error instead of panicking.
+If the response is non-nil, the caller MUST close the response body by calling
+`*gr.Res.Done` or its other reading or closing methods.
+*/
+func (self *Req) RetryCliResCatch(cli *http.Client, opt Retry) (_ *Res, err error) {
+	defer rec(&err)
+	return self.RetryCliRes(cli, opt), nil
+}
+
+/*
+True if the request body can be sent more than once: either there's no body,
+or there's `.GetBody` which makes copies.
+*/
+func (self *Req) isReplayable() bool {
+	return self.GetBody != nil || self.Body == nil || self.Body == http.NoBody
+}
+
+func (self *Req) attempt(ind int) *http.Request {
+	if ind == 0 || self.GetBody == nil {
+		return self.Req()
+	}
+
+	body, err := self.GetBody()
+	if err != nil {
+		panic(errReqBodyClone(err))
+	}
+
+	out := *self.Req()
+	out.Body = body
+	return &out
+}
+
+/*
+Parses the response header "Retry-After", which may be either a number of
+seconds or an HTTP date, returning the delay it demands. Returns 0 if the
+header is missing, malformed, or describes a moment in the past.
+*/
+func (self *Res) RetryAfter() time.Duration {
+	if self == nil {
+		return 0
+	}
+
+	src := strings.TrimSpace(Head(self.Header).Get(`Retry-After`))
+	if src == `` {
+		return 0
+	}
+
+	secs, err := strconv.ParseInt(src, 10, 64)
+	if err == nil {
+		if secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+		return 0
+	}
+
+	date, err := http.ParseTime(src)
+	if err == nil {
+		out := time.Until(date)
+		if out > 0 {
+			return out
+		}
+	}
+	return 0
+}
+
+// Returns a random duration between half and full of the input.
+func jitter(val time.Duration) time.Duration {
+	if val <= 1 {
+		return val
+	}
+	half := val / 2
+	return half + time.Duration(rand.Int63n(int64(val-half)+1))
+}
+
+// False if the context's deadline would pass before the given delay elapses.
+func ctxAllows(ctx context.Context, delay time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Now().Add(delay).Before(deadline)
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,377 @@
+package gr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Default for `gr.EventSource.Retry`, matching common browser behavior.
+	EventRetry = time.Second * 3
+
+	// Max length of a single line of an event stream.
+	EventLineMax = 1 << 24
+)
+
+/*
+Single "server-sent event" decoded from an event stream. Returned by
+`(*gr.Events).Next` and `(*gr.EventSource).Next`.
+
+`.Id` is the last event ID seen in the stream so far, which may have been set
+by a previous event, matching the behavior of the browser API. `.Event` is the
+event type; it's empty unless specified by the server, and should then be
+treated as "message". `.Data` is the event data with multiple "data" lines
+joined by "\n". `.Retry` is non-zero only if this event specified it.
+*/
+type Event struct {
+	Id    string        `json:"id,omitempty"`
+	Event string        `json:"event,omitempty"`
+	Data  string        `json:"data,omitempty"`
+	Retry time.Duration `json:"retry,omitempty"`
+}
+
+/*
+Decodes `.Data` as JSON into the given output, which must be either nil or a
+pointer. Panics on errors. If the output is nil, skips decoding. Returns the
+same event.
+*/
+func (self Event) Json(out interface{}) Event {
+	if isNilOutput(out) {
+		return self
+	}
+
+	err := json.Unmarshal(stringBytes(self.Data), out)
+	if err != nil {
+		panic(fmt.Errorf(`[gr] failed to JSON-decode event data: %w`, err))
+	}
+	return self
+}
+
+// Non-panicking version of `gr.Event.Json`.
+func (self Event) JsonCatch(out interface{}) (err error) {
+	defer rec(&err)
+	self.Json(out)
+	return
+}
+
+// True if the parsed media type of `Content-Type` is `gr.TypeEventStream`.
+func (self *Res) IsEventStream() bool { return self.MediaType() == TypeEventStream }
+
+/*
+Returns a streaming reader of "server-sent events", decoding the response body
+in the "text/event-stream" format. Doesn't check the response status or content
+type. Usage:
+
+	events := res.Events()
+	defer events.Done()
+
+	for event := events.Next(); event != nil; event = events.Next() {
+		fmt.Println(event.Event, event.Data)
+	}
+
+The reader closes the response body after reading the last event or failing.
+To stop early, call `(*gr.Events).Done`. For automatic reconnection, see
+`gr.EventSource`.
+*/
+func (self *Res) Events() *Events {
+	out := &Events{Body: self.Body}
+	if self.Body != nil {
+		out.scan = bufio.NewScanner(self.Body)
+		out.scan.Buffer(nil, EventLineMax)
+		out.scan.Split(new(eventLines).split)
+	}
+	return out
+}
+
+/*
+Streaming reader of "server-sent events". Returned by `(*gr.Res).Events`.
+`.LastId` and `.Retry` are updated as the stream is read, and are preserved
+between events as required by the format.
+*/
+type Events struct {
+	Body   io.ReadCloser
+	LastId string
+	Retry  time.Duration
+	scan   *bufio.Scanner
+	line   int
+}
+
+/*
+Returns the next event, or nil if the stream has ended. Panics if reading
+fails. Closes the response body after the end of the stream, or when panicking.
+Events without data are skipped, as required by the format.
+*/
+func (self *Events) Next() *Event {
+	if self == nil || self.scan == nil {
+		self.Done()
+		return nil
+	}
+
+	var event Event
+	var data strings.Builder
+	var hasData bool
+
+	for self.scan.Scan() {
+		line := self.scan.Bytes()
+		if self.line == 0 {
+			line = bytes.TrimPrefix(line, bytesBom)
+		}
+		self.line++
+
+		if len(line) == 0 {
+			if !hasData {
+				event = Event{}
+				continue
+			}
+			event.Id = self.LastId
+			event.Data = data.String()
+			return &event
+		}
+
+		if line[0] == ':' {
+			continue
+		}
+
+		key, val := line, []byte(nil)
+		ind := bytes.IndexByte(line, ':')
+		if ind >= 0 {
+			key, val = line[:ind], line[ind+1:]
+			val = bytes.TrimPrefix(val, bytesSpace)
+		}
+
+		switch string(key) {
+		case `event`:
+			event.Event = string(val)
+
+		case `data`:
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.Write(val)
+			hasData = true
+
+		case `id`:
+			if bytes.IndexByte(val, 0) < 0 {
+				self.LastId = string(val)
+			}
+
+		case `retry`:
+			ms, err := strconv.ParseUint(string(val), 10, 32)
+			if err == nil {
+				self.Retry = time.Duration(ms) * time.Millisecond
+				event.Retry = self.Retry
+			}
+		}
+	}
+
+	err := self.scan.Err()
+	self.Done()
+	if err != nil {
+		panic(fmt.Errorf(`[gr] failed to read event stream: %w`, err))
+	}
+	return nil
+}
+
+/*
+Non-panicking version of `(*gr.Events).Next`. Returns nil and nil if the stream
+has ended.
+*/
+func (self *Events) NextCatch() (_ *Event, err error) {
+	defer rec(&err)
+	return self.Next(), nil
+}
+
+// Closes the response body if possible. Can be deferred.
+func (self *Events) Done() {
+	if self != nil && self.Body != nil {
+		_ = self.Body.Close()
+		self.scan = nil
+	}
+}
+
+/*
+Reconnecting reader of "server-sent events", similar to the browser API
+"EventSource". Each connection uses a clone of `.Req` made via
+`(*gr.Req).Clone`, with the header "Last-Event-ID" set to the last event ID
+received so far, if any. Usage:
+
+	src := &gr.EventSource{Req: gr.To(`https://example.com/events`).Ctx(ctx)}
+	defer src.Done()
+
+	for event := src.Next(); event != nil; event = src.Next() {
+		fmt.Println(event.Event, event.Data)
+	}
+
+When the stream ends or a connection fails, waits for `.Retry` and reconnects.
+The server may change `.Retry` via the "retry" field. Stops when the request
+context is done, or when the server responds with 204 No Content. Responses
+with other non-OK statuses, or without the type `gr.TypeEventStream`, are
+treated as fatal, causing a panic.
+*/
+type EventSource struct {
+	Req    *Req
+	LastId string
+	Retry  time.Duration
+	events *Events
+	conns  int
+}
+
+/*
+Returns the next event, connecting or reconnecting as needed. Returns nil when
+the request context is done or the server responds with 204 No Content. Panics
+on fatal responses. See `gr.EventSource` for the details.
+*/
+func (self *EventSource) Next() *Event {
+	ctx := self.ctx()
+
+	for {
+		if self.events == nil {
+			if self.conns > 0 && sleep(ctx, self.retry()) != nil {
+				return nil
+			}
+			if !self.connect(ctx) {
+				return nil
+			}
+		}
+
+		// Read failures are treated like disconnects, followed by reconnecting.
+		event, _ := self.events.NextCatch()
+		if self.events.Retry > 0 {
+			self.Retry = self.events.Retry
+		}
+
+		if event != nil {
+			self.LastId = event.Id
+			return event
+		}
+
+		self.events.Done()
+		self.events = nil
+	}
+}
+
+/*
+Non-panicking version of `(*gr.EventSource).Next`. Returns nil and nil when
+the event source has stopped.
+*/
+func (self *EventSource) NextCatch() (_ *Event, err error) {
+	defer rec(&err)
+	return self.Next(), nil
+}
+
+// Closes the current connection, if any. Can be deferred.
+func (self *EventSource) Done() {
+	if self != nil {
+		self.events.Done()
+		self.events = nil
+	}
+}
+
+func (self *EventSource) connect(ctx context.Context) bool {
+	for {
+		self.conns++
+
+		req := self.Req.Clone()
+		if req == nil {
+			req = new(Req)
+		}
+		req = req.HeadSet(`Accept`, TypeEventStream)
+		if self.LastId != `` {
+			req = req.HeadSet(`Last-Event-ID`, self.LastId)
+		}
+
+		res, err := req.ResCatch()
+		if err != nil {
+			if ctx.Err() != nil || sleep(ctx, self.retry()) != nil {
+				return false
+			}
+			continue
+		}
+
+		if res.StatusCode == http.StatusNoContent {
+			res.Done()
+			return false
+		}
+
+		res.Ok()
+		if !res.IsEventStream() {
+			defer res.Done()
+			panic(fmt.Errorf(`[gr] failed to read event stream: unexpected media type %q`, res.MediaType()))
+		}
+
+		self.events = res.Events()
+		self.events.LastId = self.LastId
+		return true
+	}
+}
+
+func (self *EventSource) ctx() context.Context {
+	if self.Req != nil && self.Req.Context() != nil {
+		return self.Req.Context()
+	}
+	return context.Background()
+}
+
+func (self *EventSource) retry() time.Duration {
+	if self.Retry > 0 {
+		return self.Retry
+	}
+	return EventRetry
+}
+
+/*
+Splits an event stream into lines, which may be terminated by CRLF, LF, or CR,
+as required by the format. A CR at the end of the buffered data terminates the
+line without waiting for more data, which allows to dispatch events of streams
+using bare CR; if the next read begins with LF, it's skipped as part of CRLF.
+*/
+type eventLines struct{ cr bool }
+
+func (self *eventLines) split(src []byte, eof bool) (int, []byte, error) {
+	var skip int
+	if self.cr && len(src) > 0 {
+		self.cr = false
+		if src[0] == '\n' {
+			skip = 1
+		}
+	}
+
+	size, line := scanEventLine(src[skip:], eof)
+	if line == nil {
+		return skip, nil, nil
+	}
+	self.cr = size == len(src)-skip && src[len(src)-1] == '\r'
+	return skip + size, line, nil
+}
+
+/*
+Returns the size of the next line including its terminator, and the line
+without the terminator, or nil if more data is needed. A CR at the end of the
+data terminates the line.
+*/
+func scanEventLine(src []byte, eof bool) (int, []byte) {
+	ind := bytes.IndexAny(src, "\r\n")
+
+	if ind < 0 {
+		if eof && len(src) > 0 {
+			return len(src), src
+		}
+		return 0, nil
+	}
+
+	if src[ind] == '\n' || ind+1 == len(src) {
+		return ind + 1, src[:ind]
+	}
+	if src[ind+1] == '\n' {
+		return ind + 2, src[:ind]
+	}
+	return ind + 1, src[:ind]
+}
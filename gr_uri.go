@@ -0,0 +1,470 @@
+package gr
+
+import (
+	"fmt"
+	"net/url"
+	r "reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Expands a URI template as defined by RFC 6570, supporting all levels (1 to 4):
+simple and reserved expansion, all operators ("+", "#", ".", "/", ";", "?",
+"&"), prefix modifiers such as "{var:3}", and explode modifiers such as
+"{list*}". Example:
+
+	gr.ExpandUri(`/users/{id}/repos{?page,per_page}`, map[string]interface{}{
+		`id`:   10,
+		`page`: 2,
+	})
+	// "/users/10/repos?page=2"
+
+Variables are taken from the given map with string keys, or from the given
+struct, whose fields are named by the struct tag "uri", falling back on the
+field name. Variable values are converted as follows:
+
+	* nil, nil pointers, missing variables -> undefined, skipped as per RFC
+	* slices and arrays                    -> lists; empty lists are undefined
+	* maps with string keys                -> associative arrays, sorted by key;
+	                                          empty maps are undefined
+	* everything else                      -> string, via `gr.Str`
+
+Unlike the RFC, which expands undefined or empty variables to nothing, this
+treats variables in simple "{var}", reserved "{+var}" and path segment
+"{/var}" expressions as required, and panics when they're undefined or empty,
+similarly to how `gr.UrlAppend` panics on empty strings. This prevents
+accidentally producing a different URL, such as "/users//repos" instead of
+"/users/10/repos". Also panics on invalid templates.
+*/
+func ExpandUri(tpl string, vars interface{}) string {
+	out, err := expandUri(tpl, vars)
+	if err != nil {
+		panic(fmt.Errorf(`[gr] failed to expand URI template %q: %w`, tpl, err))
+	}
+	return out
+}
+
+// Non-panicking version of `gr.ExpandUri`.
+func ExpandUriCatch(tpl string, vars interface{}) (_ string, err error) {
+	defer rec(&err)
+	return ExpandUri(tpl, vars), nil
+}
+
+/*
+Expands the given URI template via `gr.ExpandUri` and uses the result as the
+destination. If the result is an absolute URL, it replaces `.URL`. Otherwise
+it's resolved relative to the current `.URL` via `(*url.URL).ResolveReference`,
+so "/path" replaces the path, while "path" is relative to the current path,
+following the usual rules. Panics on expansion or parsing errors. Mutates and
+returns the receiver. Example:
+
+	gr.To(`https://api.example.com`).Expand(`/users/{id}/repos{?page}`, vars)
+*/
+func (self *Req) Expand(tpl string, vars interface{}) *Req {
+	val, err := url.Parse(ExpandUri(tpl, vars))
+	if err != nil {
+		panic(fmt.Errorf(`[gr] failed to parse expanded URI template %q: %w`, tpl, err))
+	}
+
+	if self.URL != nil && !val.IsAbs() {
+		val = self.URL.ResolveReference(val)
+	}
+	return self.Url(val)
+}
+
+type uriOp struct {
+	first    string
+	sep      string
+	named    bool
+	ifEmpty  string
+	reserved bool
+	required bool
+}
+
+var uriOps = map[byte]uriOp{
+	'+': {first: ``, sep: `,`, reserved: true, required: true},
+	'#': {first: `#`, sep: `,`, reserved: true},
+	'.': {first: `.`, sep: `.`},
+	'/': {first: `/`, sep: `/`, required: true},
+	';': {first: `;`, sep: `;`, named: true},
+	'?': {first: `?`, sep: `&`, named: true, ifEmpty: `=`},
+	'&': {first: `&`, sep: `&`, named: true, ifEmpty: `=`},
+}
+
+var uriOpSimple = uriOp{first: ``, sep: `,`, required: true}
+
+// Also catches panics from `gr.Str` on unsupported values.
+func expandUri(tpl string, vars interface{}) (_ string, err error) {
+	defer rec(&err)
+
+	lookup, err := uriLookup(vars)
+	if err != nil {
+		return ``, err
+	}
+
+	var buf strings.Builder
+	src := tpl
+
+	for src != `` {
+		start := strings.IndexAny(src, `{}`)
+		if start < 0 {
+			uriEncode(&buf, src, true)
+			break
+		}
+		if src[start] == '}' {
+			return ``, fmt.Errorf(`unexpected "}" at position %v`, len(tpl)-len(src)+start)
+		}
+
+		uriEncode(&buf, src[:start], true)
+		src = src[start+1:]
+
+		end := strings.IndexAny(src, `{}`)
+		if end < 0 || src[end] == '{' {
+			return ``, fmt.Errorf(`unclosed expression at position %v`, len(tpl)-len(src)-1)
+		}
+
+		err := uriExpr(&buf, src[:end], lookup)
+		if err != nil {
+			return ``, err
+		}
+		src = src[end+1:]
+	}
+
+	return buf.String(), nil
+}
+
+func uriExpr(buf *strings.Builder, expr string, lookup func(string) r.Value) error {
+	if expr == `` {
+		return fmt.Errorf(`empty expression`)
+	}
+
+	op := uriOpSimple
+	if impl, ok := uriOps[expr[0]]; ok {
+		op = impl
+		expr = expr[1:]
+	} else if strings.IndexByte(`=,!@|`, expr[0]) >= 0 {
+		return fmt.Errorf(`unsupported operator %q`, expr[:1])
+	}
+
+	first := true
+
+	for _, spec := range strings.Split(expr, `,`) {
+		name, prefix, explode, err := uriVarSpec(spec)
+		if err != nil {
+			return err
+		}
+
+		val := uriValue(lookup(name))
+
+		if !val.IsValid() {
+			if op.required {
+				return fmt.Errorf(`missing required variable %q`, name)
+			}
+			continue
+		}
+
+		kind := val.Kind()
+		isList := kind == r.Slice || kind == r.Array
+		isMap := kind == r.Map
+
+		if op.required && !isList && !isMap && Str(val.Interface()) == `` {
+			return fmt.Errorf(`unexpected empty value for required variable %q`, name)
+		}
+
+		if (isList || isMap) && prefix > 0 {
+			return fmt.Errorf(`unexpected prefix modifier for composite variable %q`, name)
+		}
+
+		if first {
+			buf.WriteString(op.first)
+			first = false
+		} else {
+			buf.WriteString(op.sep)
+		}
+
+		switch {
+		case isList:
+			uriList(buf, op, name, val, explode)
+		case isMap:
+			err := uriMap(buf, op, name, val, explode)
+			if err != nil {
+				return err
+			}
+		default:
+			str := Str(val.Interface())
+			if op.named {
+				buf.WriteString(name)
+				if str == `` {
+					buf.WriteString(op.ifEmpty)
+					continue
+				}
+				buf.WriteString(`=`)
+			}
+			if prefix > 0 {
+				str = runePrefix(str, prefix)
+			}
+			uriEncode(buf, str, op.reserved)
+		}
+	}
+	return nil
+}
+
+func uriList(buf *strings.Builder, op uriOp, name string, val r.Value, explode bool) {
+	if !explode {
+		if op.named {
+			buf.WriteString(name)
+			buf.WriteString(`=`)
+		}
+		for ind := range iter(val.Len()) {
+			if ind > 0 {
+				buf.WriteString(`,`)
+			}
+			uriEncode(buf, Str(val.Index(ind).Interface()), op.reserved)
+		}
+		return
+	}
+
+	for ind := range iter(val.Len()) {
+		if ind > 0 {
+			buf.WriteString(op.sep)
+		}
+		str := Str(val.Index(ind).Interface())
+		if op.named {
+			buf.WriteString(name)
+			if str == `` {
+				buf.WriteString(op.ifEmpty)
+				continue
+			}
+			buf.WriteString(`=`)
+		}
+		uriEncode(buf, str, op.reserved)
+	}
+}
+
+func uriMap(buf *strings.Builder, op uriOp, name string, val r.Value, explode bool) error {
+	if val.Type().Key().Kind() != r.String {
+		return fmt.Errorf(`unsupported map type %v for variable %q`, val.Type(), name)
+	}
+
+	keys := make([]string, 0, val.Len())
+	for _, key := range val.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+
+	if !explode && op.named {
+		buf.WriteString(name)
+		buf.WriteString(`=`)
+	}
+
+	for ind, key := range keys {
+		str := Str(val.MapIndex(r.ValueOf(key).Convert(val.Type().Key())).Interface())
+
+		if !explode {
+			if ind > 0 {
+				buf.WriteString(`,`)
+			}
+			uriEncode(buf, key, op.reserved)
+			buf.WriteString(`,`)
+			uriEncode(buf, str, op.reserved)
+			continue
+		}
+
+		if ind > 0 {
+			buf.WriteString(op.sep)
+		}
+		uriEncode(buf, key, op.reserved)
+		if str == `` && op.named {
+			buf.WriteString(op.ifEmpty)
+			continue
+		}
+		buf.WriteString(`=`)
+		uriEncode(buf, str, op.reserved)
+	}
+	return nil
+}
+
+func uriVarSpec(spec string) (name string, prefix int, explode bool, _ error) {
+	name = spec
+
+	if strings.HasSuffix(name, `*`) {
+		name = name[:len(name)-1]
+		explode = true
+	} else if ind := strings.IndexByte(name, ':'); ind >= 0 {
+		val, err := strconv.Atoi(name[ind+1:])
+		if err != nil || val <= 0 || val >= 10000 || name[ind+1] == '0' {
+			return ``, 0, false, fmt.Errorf(`invalid prefix modifier in %q`, spec)
+		}
+		name, prefix = name[:ind], val
+	}
+
+	if !isUriVarName(name) {
+		return ``, 0, false, fmt.Errorf(`invalid variable name %q`, name)
+	}
+	return name, prefix, explode, nil
+}
+
+func isUriVarName(val string) bool {
+	if val == `` || val[0] == '.' || val[len(val)-1] == '.' || strings.Contains(val, `..`) {
+		return false
+	}
+
+	for ind := 0; ind < len(val); ind++ {
+		char := val[ind]
+		switch {
+		case isAlnum(char) || char == '_' || char == '.':
+		case char == '%' && ind+2 < len(val) && isHex(val[ind+1]) && isHex(val[ind+2]):
+			ind += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Returns a function which finds variables by name in a map with string keys, or
+in a struct. A nil input has no variables.
+*/
+func uriLookup(vars interface{}) (func(string) r.Value, error) {
+	val := valueDerefIface(r.ValueOf(vars))
+
+	if !val.IsValid() {
+		return func(string) r.Value { return r.Value{} }, nil
+	}
+
+	switch val.Kind() {
+	case r.Map:
+		if val.Type().Key().Kind() != r.String {
+			break
+		}
+		keyTyp := val.Type().Key()
+		return func(key string) r.Value {
+			return val.MapIndex(r.ValueOf(key).Convert(keyTyp))
+		}, nil
+
+	case r.Struct:
+		return func(key string) r.Value { return uriField(val, key) }, nil
+	}
+
+	return nil, fmt.Errorf(`expected map with string keys or struct, got %T`, vars)
+}
+
+func uriField(val r.Value, key string) r.Value {
+	typ := val.Type()
+
+	for ind := range iter(typ.NumField()) {
+		field := typ.Field(ind)
+		if field.PkgPath != `` {
+			continue
+		}
+
+		name, _ := tagNameOpts(field.Tag.Get(`uri`))
+		if name == `-` {
+			continue
+		}
+
+		if field.Anonymous && name == `` && isNestedType(field.Type) {
+			inner := valueDeref(val.Field(ind))
+			if inner.IsValid() {
+				out := uriField(inner, key)
+				if out.IsValid() {
+					return out
+				}
+			}
+			continue
+		}
+
+		if name == `` {
+			name = field.Name
+		}
+		if name == key {
+			return val.Field(ind)
+		}
+	}
+	return r.Value{}
+}
+
+/*
+Dereferences the value, returning an invalid value for nil and for empty lists
+and maps, which the RFC considers undefined. Byte slices are treated as
+strings.
+*/
+func uriValue(val r.Value) r.Value {
+	val = valueDerefIface(val)
+	if !val.IsValid() {
+		return val
+	}
+
+	switch val.Kind() {
+	case r.Slice:
+		if val.Type().Elem().Kind() == r.Uint8 {
+			return r.ValueOf(string(val.Bytes()))
+		}
+		if val.Len() == 0 {
+			return r.Value{}
+		}
+	case r.Array, r.Map:
+		if val.Len() == 0 {
+			return r.Value{}
+		}
+	}
+	return val
+}
+
+/*
+Percent-encodes the input, leaving unreserved characters as-is. When "reserved"
+is true, also leaves reserved characters and existing percent-encoded triplets
+as-is, as required by reserved expansion and template literals.
+*/
+func uriEncode(buf *strings.Builder, src string, reserved bool) {
+	for ind := 0; ind < len(src); ind++ {
+		char := src[ind]
+
+		if isUriUnreserved(char) || (reserved && isUriReserved(char)) {
+			buf.WriteByte(char)
+			continue
+		}
+
+		if reserved && char == '%' && ind+2 < len(src) && isHex(src[ind+1]) && isHex(src[ind+2]) {
+			buf.WriteString(src[ind : ind+3])
+			ind += 2
+			continue
+		}
+
+		buf.WriteByte('%')
+		buf.WriteByte(hexUpper[char>>4])
+		buf.WriteByte(hexUpper[char&15])
+	}
+}
+
+const hexUpper = `0123456789ABCDEF`
+
+func isUriUnreserved(char byte) bool {
+	return isAlnum(char) || char == '-' || char == '.' || char == '_' || char == '~'
+}
+
+func isUriReserved(char byte) bool {
+	return strings.IndexByte(`:/?#[]@!$&'()*+,;=`, char) >= 0
+}
+
+func isAlnum(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+}
+
+func isHex(char byte) bool {
+	return (char >= '0' && char <= '9') || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F')
+}
+
+// Returns up to the given count of leading characters (not bytes).
+func runePrefix(src string, count int) string {
+	for ind := range src {
+		if count == 0 {
+			return src[:ind]
+		}
+		count--
+	}
+	return src
+}
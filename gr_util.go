@@ -13,7 +13,10 @@ import (
 
 var (
 	errUrlAppend = fmt.Errorf(`[gt] failed to append to URL path: unexpected empty string`)
+	errRetryBody = fmt.Errorf(`[gr] failed to retry HTTP request: body can't be replayed without "GetBody"`)
 	bytesNewline = []byte("\n")
+	bytesSpace   = []byte(" ")
+	bytesBom     = []byte("\xef\xbb\xbf")
 )
 
 func errResUnexpected(desc string) error {
@@ -28,6 +31,10 @@ func errResUnexpectedFailedToReadBody(desc string) error {
 	return fmt.Errorf(`unexpected %v response; failed to read response body`, desc)
 }
 
+func errReqRes(err error) error {
+	return fmt.Errorf(`[gr] failed to perform HTTP request: %w`, err)
+}
+
 func errReqBodyClone(err error) error {
 	return fmt.Errorf(`[gr] failed to clone request body: %w`, err)
 }
@@ -50,6 +57,20 @@ func bytesString(input []byte) string {
 	return *(*string)(u.Pointer(&input))
 }
 
+/*
+Allocation-free conversion. Reinterprets a string as a byte slice, which must
+not be mutated. Should be used only for passing strings to functions that read
+byte slices without retaining them.
+*/
+func stringBytes(input string) []byte {
+	return *(*[]byte)(u.Pointer(&sliceHeader{input, len(input)}))
+}
+
+type sliceHeader struct {
+	str string
+	cap int
+}
+
 // Must be deferred.
 func rec(ptr *error) {
 	val := recover()
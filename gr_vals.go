@@ -0,0 +1,899 @@
+package gr
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	r "reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Encodes a struct into URL query parameters, using the struct tag "query" for
+parameter names. Panics if the input is not a struct or a pointer to a struct,
+or if a field can't be encoded. A nil input produces empty values. Field rules:
+
+	* `query:"name"`           -> parameter "name"
+	* `query:"name,omitempty"` -> omit zero values
+	* `query:"-"`              -> skip field
+	* no tag                   -> use the field name
+	* embedded structs         -> fields are promoted, like in "encoding/json"
+	* unexported fields        -> skipped, including embedded ones
+
+Value rules:
+
+	* nil pointers and nil interfaces  -> omitted
+	* non-nil pointers                 -> dereferenced
+	* `time.Time`                      -> formatted with the layout from the
+	                                      "layout" tag, or `time.RFC3339`
+	* `fmt.Stringer`                   -> `.String()`
+	* built-in primitive types         -> encoded like `gr.Str`
+	* byte slices                      -> strings
+	* other slices and arrays          -> repeated keys, one per element
+	* nested structs                   -> nested keys like "outer[inner]"
+	* maps with string keys            -> nested keys like "outer[key]"
+
+Example:
+
+	type Params struct {
+		Ids   []int     `query:"id"`
+		Since time.Time `query:"since,omitempty" layout:"2006-01-02"`
+		Limit *int      `query:"limit"`
+	}
+*/
+func EncodeQuery(src interface{}) url.Values { return encodeVals(`query`, src) }
+
+/*
+Encodes the given struct via `gr.EncodeQuery`, and sets the result as
+`.URL.RawQuery`, creating a new URL reference if the URL was nil. Mutates and
+returns the receiver.
+*/
+func (self *Req) QueryStruct(src interface{}) *Req {
+	return self.Query(EncodeQuery(src))
+}
+
+/*
+Encodes a struct into form values, using the struct tag "form" for field names.
+Follows the same rules as `gr.EncodeQuery`, including nested keys like
+"outer[inner]" for nested structs and maps.
+*/
+func EncodeForm(src interface{}) url.Values { return encodeVals(`form`, src) }
+
+/*
+Encodes the given struct via `gr.EncodeForm`, and uses the result as the
+request body via `(*gr.Req).FormVals`, which also sets "Content-Type",
+`.ContentLength` and `.GetBody`. Mutates and returns the receiver.
+*/
+func (self *Req) FormStruct(src interface{}) *Req {
+	return self.FormVals(EncodeForm(src))
+}
+
+/*
+Decodes form values into the given output, which must be a non-nil pointer to a
+struct. Inverse of `gr.EncodeForm`: uses the struct tag "form" and the same
+rules for field names, nested keys, and time layouts. Fields without matching
+keys are left unchanged. Supported field types:
+
+	* built-in primitive types       -> parsed via "strconv"
+	* `time.Time`                    -> parsed with the layout from the
+	                                    "layout" tag, or `time.RFC3339`
+	* `time.Duration`                -> parsed via `time.ParseDuration`
+	* `encoding.TextUnmarshaler`     -> `.UnmarshalText`
+	* pointers                       -> allocated when a key matches
+	* byte slices                    -> first value as-is
+	* other slices and arrays        -> one element per repeated key
+	* nested structs                 -> nested keys like "outer[inner]"
+	* maps with string keys          -> nested keys like "outer[key]"
+
+Attempts to decode every field. If some fields fail, panics with `gr.FieldErrs`
+which describes each failure, leaving other fields decoded. Panics on invalid
+outputs. Accepts an "anonymous" type because all alias types such as
+`url.Values` are automatically castable into it.
+*/
+func DecodeForm(src map[string][]string, out interface{}) {
+	decodeVals(`form`, src, out)
+}
+
+// Non-panicking version of `gr.DecodeForm`.
+func DecodeFormCatch(src map[string][]string, out interface{}) (err error) {
+	defer rec(&err)
+	DecodeForm(src, out)
+	return
+}
+
+/*
+Decodes the response body via `(*gr.Res).Form` and then into the given struct
+via `gr.DecodeForm`. Panics on errors. Returns the same response. Always closes
+the body.
+*/
+func (self *Res) FormStruct(out interface{}) *Res {
+	DecodeForm(self.Form(), out)
+	return self
+}
+
+/*
+Non-panicking version of `(*gr.Res).FormStruct`. If decoding of some fields
+fails, the error is `gr.FieldErrs`. Always closes the body.
+*/
+func (self *Res) FormStructCatch(out interface{}) (err error) {
+	defer rec(&err)
+	self.FormStruct(out)
+	return
+}
+
+/*
+Describes a failure to decode one field, as part of `gr.FieldErrs`. `.Key` is
+the full key, such as "outer[inner]" for nested fields.
+*/
+type FieldErr struct {
+	Key   string `json:"key"`
+	Cause error  `json:"cause"`
+}
+
+// Implement a hidden interface in "errors".
+func (self FieldErr) Unwrap() error { return self.Cause }
+
+// Implement the `error` interface.
+func (self FieldErr) Error() string {
+	return fmt.Sprintf(`field %q: %v`, self.Key, self.Cause)
+}
+
+/*
+Describes failures to decode struct fields. Returned or thrown by decoding
+functions such as `gr.DecodeForm`. Use `errors.As` to find it.
+*/
+type FieldErrs []FieldErr
+
+/*
+Implement a hidden interface in "errors", supported since Go 1.20. See
+`gr.FieldErrs.Is` and `gr.FieldErrs.As` for older versions.
+*/
+func (self FieldErrs) Unwrap() []error {
+	out := make([]error, len(self))
+	for ind, val := range self {
+		out[ind] = val
+	}
+	return out
+}
+
+/*
+Implement a hidden interface in "errors", allowing `errors.Is` to find the
+causes of individual field errors in any Go version.
+*/
+func (self FieldErrs) Is(err error) bool {
+	for _, val := range self {
+		if errors.Is(val, err) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Implement a hidden interface in "errors", allowing `errors.As` to find the
+causes of individual field errors in any Go version.
+*/
+func (self FieldErrs) As(out interface{}) bool {
+	for _, val := range self {
+		if errors.As(val, out) {
+			return true
+		}
+	}
+	return false
+}
+
+// Implement the `error` interface.
+func (self FieldErrs) Error() string {
+	var buf strings.Builder
+	buf.WriteString(`[gr] failed to decode `)
+
+	for ind, err := range self {
+		if ind > 0 {
+			buf.WriteString(`; `)
+		}
+		buf.WriteString(err.Error())
+	}
+	return buf.String()
+}
+
+const tagLayout = `layout`
+
+var (
+	typeTime          = r.TypeOf(time.Time{})
+	typeDuration      = r.TypeOf(time.Duration(0))
+	typeStringer      = r.TypeOf((*fmt.Stringer)(nil)).Elem()
+	typeTextUnmarshal = r.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func encodeVals(tag string, src interface{}) url.Values {
+	out := url.Values{}
+
+	val := valueOf(src)
+	if !val.IsValid() {
+		return out
+	}
+
+	if val.Kind() != r.Struct {
+		panic(fmt.Errorf(`[gr] failed to encode %v: expected struct, got %T`, tag, src))
+	}
+
+	// Makes fields addressable, allowing to use `fmt.Stringer` implemented on
+	// pointer types.
+	if !val.CanAddr() {
+		ptr := r.New(val.Type())
+		ptr.Elem().Set(val)
+		val = ptr.Elem()
+	}
+
+	enc := valsEncoder{tag: tag, out: out}
+	enc.fields(``, val)
+	return out
+}
+
+type valsEncoder struct {
+	tag string
+	out url.Values
+}
+
+func (self valsEncoder) fields(prefix string, val r.Value) {
+	typ := val.Type()
+
+	for ind := range iter(typ.NumField()) {
+		field := typ.Field(ind)
+		if field.PkgPath != `` {
+			continue
+		}
+
+		name, opts := tagNameOpts(field.Tag.Get(self.tag))
+		if name == `-` {
+			continue
+		}
+
+		fieldVal := val.Field(ind)
+
+		if field.Anonymous && name == `` && isNestedType(field.Type) {
+			fieldVal = valueDeref(fieldVal)
+			if fieldVal.IsValid() {
+				self.fields(prefix, fieldVal)
+			}
+			continue
+		}
+
+		if name == `` {
+			name = field.Name
+		}
+
+		if hasTagOpt(opts, `omitempty`) && fieldVal.IsZero() {
+			continue
+		}
+
+		self.value(nestKey(prefix, name), fieldVal, field.Tag.Get(tagLayout))
+	}
+}
+
+func (self valsEncoder) value(key string, val r.Value, layout string) {
+	val = valueDerefIface(val)
+	if !val.IsValid() {
+		return
+	}
+
+	if val.Type() == typeTime {
+		self.out.Add(key, val.Interface().(time.Time).Format(timeLayout(layout)))
+		return
+	}
+
+	if val.Type().Implements(typeStringer) {
+		self.out.Add(key, val.Interface().(fmt.Stringer).String())
+		return
+	}
+	if val.CanAddr() && val.Addr().Type().Implements(typeStringer) {
+		self.out.Add(key, val.Addr().Interface().(fmt.Stringer).String())
+		return
+	}
+
+	switch val.Kind() {
+	case r.Slice, r.Array:
+		if val.Kind() == r.Slice && val.Type().Elem().Kind() == r.Uint8 {
+			self.out.Add(key, string(val.Bytes()))
+			return
+		}
+		for ind := range iter(val.Len()) {
+			self.value(key, val.Index(ind), layout)
+		}
+
+	case r.Struct:
+		self.fields(key, val)
+
+	case r.Map:
+		if val.Type().Key().Kind() != r.String {
+			panic(errEncodeField(self.tag, key, fmt.Errorf(`unsupported map type %v`, val.Type())))
+		}
+		entries := val.MapRange()
+		for entries.Next() {
+			self.value(nestKey(key, entries.Key().String()), entries.Value(), layout)
+		}
+
+	default:
+		str, err := strCatch(val.Interface())
+		if err != nil {
+			panic(errEncodeField(self.tag, key, err))
+		}
+		self.out.Add(key, str)
+	}
+}
+
+func errEncodeField(tag, key string, err error) error {
+	return fmt.Errorf(`[gr] failed to encode %v field %q: %w`, tag, key, err)
+}
+
+func strCatch(src interface{}) (_ string, err error) {
+	defer rec(&err)
+	return Str(src), nil
+}
+
+// Like `valueDeref`, but also unwraps interfaces.
+func valueDerefIface(val r.Value) r.Value {
+	for val.Kind() == r.Ptr || val.Kind() == r.Interface {
+		if val.IsNil() {
+			return r.Value{}
+		}
+		val = val.Elem()
+	}
+	return val
+}
+
+/*
+True if the type, after dereferencing, is a struct encoded field-by-field rather
+than as a single value.
+*/
+func isNestedType(typ r.Type) bool {
+	typ = typeDeref(typ)
+	return typ.Kind() == r.Struct &&
+		typ != typeTime &&
+		!typ.Implements(typeStringer) &&
+		!r.PtrTo(typ).Implements(typeStringer)
+}
+
+func nestKey(prefix, key string) string {
+	if prefix == `` {
+		return key
+	}
+	return prefix + `[` + key + `]`
+}
+
+func timeLayout(val string) string {
+	if val == `` {
+		return time.RFC3339
+	}
+	return val
+}
+
+func tagNameOpts(tag string) (string, string) {
+	ind := strings.IndexByte(tag, ',')
+	if ind < 0 {
+		return tag, ``
+	}
+	return tag[:ind], tag[ind+1:]
+}
+
+func hasTagOpt(opts, opt string) bool {
+	for opts != `` {
+		var cur string
+		cur, opts = tagNameOpts(opts)
+		if cur == opt {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeVals(tag string, src url.Values, out interface{}) {
+	val := r.ValueOf(out)
+	if val.Kind() != r.Ptr || val.IsNil() || val.Elem().Kind() != r.Struct {
+		panic(fmt.Errorf(`[gr] failed to decode %v: expected non-nil pointer to struct, got %T`, tag, out))
+	}
+
+	dec := valsDecoder{tag: tag, src: src}
+	dec.fields(``, val.Elem())
+	if dec.errs != nil {
+		panic(dec.errs)
+	}
+}
+
+type valsDecoder struct {
+	tag  string
+	src  url.Values
+	errs FieldErrs
+}
+
+func (self *valsDecoder) fields(prefix string, val r.Value) {
+	typ := val.Type()
+
+	for ind := range iter(typ.NumField()) {
+		field := typ.Field(ind)
+		if field.PkgPath != `` {
+			continue
+		}
+
+		name, _ := tagNameOpts(field.Tag.Get(self.tag))
+		if name == `-` {
+			continue
+		}
+
+		layout := field.Tag.Get(tagLayout)
+
+		if field.Anonymous && name == `` && isNestedType(field.Type) {
+			self.embed(prefix, val.Field(ind), layout)
+			continue
+		}
+
+		if name == `` {
+			name = field.Name
+		}
+		self.value(nestKey(prefix, name), val.Field(ind), layout)
+	}
+}
+
+// Embedded struct pointers are allocated only when some of their fields match.
+func (self *valsDecoder) embed(prefix string, val r.Value, layout string) {
+	if val.Kind() != r.Ptr {
+		self.fields(prefix, val)
+		return
+	}
+
+	if !val.IsNil() {
+		self.embed(prefix, val.Elem(), layout)
+		return
+	}
+
+	tmp := r.New(val.Type().Elem())
+	self.embed(prefix, tmp.Elem(), layout)
+	if !tmp.Elem().IsZero() {
+		val.Set(tmp)
+	}
+}
+
+func (self *valsDecoder) value(key string, val r.Value, layout string) {
+	typ := val.Type()
+
+	if typ.Kind() == r.Ptr {
+		if !self.has(key) {
+			return
+		}
+		if val.IsNil() {
+			val.Set(r.New(typ.Elem()))
+		}
+		self.value(key, val.Elem(), layout)
+		return
+	}
+
+	if isScalarType(typ) {
+		vals := self.src[key]
+		if len(vals) > 0 {
+			self.scalar(key, vals[0], val, layout)
+		}
+		return
+	}
+
+	switch typ.Kind() {
+	case r.Slice:
+		vals, ok := self.src[key]
+		if !ok {
+			return
+		}
+		out := r.MakeSlice(typ, len(vals), len(vals))
+		for ind, str := range vals {
+			self.scalarElem(key, str, out.Index(ind), layout)
+		}
+		val.Set(out)
+
+	case r.Array:
+		vals := self.src[key]
+		for ind := range iter(val.Len()) {
+			if ind >= len(vals) {
+				break
+			}
+			self.scalarElem(key, vals[ind], val.Index(ind), layout)
+		}
+
+	case r.Struct:
+		self.fields(key, val)
+
+	case r.Map:
+		self.dict(key, val, layout)
+
+	default:
+		// Unsupported fields are fine as long as the input doesn't mention them.
+		if !self.has(key) {
+			return
+		}
+		self.fail(key, fmt.Errorf(`unsupported type %v`, typ))
+	}
+}
+
+func (self *valsDecoder) dict(key string, val r.Value, layout string) {
+	typ := val.Type()
+	if typ.Key().Kind() != r.String || !isScalarType(typ.Elem()) {
+		if !self.has(key) {
+			return
+		}
+		self.fail(key, fmt.Errorf(`unsupported map type %v`, typ))
+		return
+	}
+
+	prefix := key + `[`
+	for srcKey, vals := range self.src {
+		if len(vals) == 0 || !strings.HasPrefix(srcKey, prefix) || !strings.HasSuffix(srcKey, `]`) {
+			continue
+		}
+
+		mapKey := srcKey[len(prefix) : len(srcKey)-1]
+		if strings.ContainsAny(mapKey, `[]`) {
+			continue
+		}
+
+		if val.IsNil() {
+			val.Set(r.MakeMap(typ))
+		}
+
+		elem := r.New(typ.Elem()).Elem()
+		if self.scalar(srcKey, vals[0], elem, layout) {
+			val.SetMapIndex(r.ValueOf(mapKey).Convert(typ.Key()), elem)
+		}
+	}
+}
+
+func (self *valsDecoder) scalarElem(key, src string, val r.Value, layout string) {
+	if val.Kind() == r.Ptr {
+		val.Set(r.New(val.Type().Elem()))
+		val = val.Elem()
+	}
+
+	if !isScalarType(val.Type()) {
+		self.fail(key, fmt.Errorf(`unsupported element type %v`, val.Type()))
+		return
+	}
+	self.scalar(key, src, val, layout)
+}
+
+func (self *valsDecoder) scalar(key, src string, val r.Value, layout string) bool {
+	err := parseScalar(src, val, layout)
+	if err != nil {
+		self.fail(key, err)
+		return false
+	}
+	return true
+}
+
+func (self *valsDecoder) fail(key string, err error) {
+	self.errs = append(self.errs, FieldErr{Key: key, Cause: err})
+}
+
+// True if the values contain the key or any key nested under it.
+func (self *valsDecoder) has(key string) bool {
+	_, ok := self.src[key]
+	if ok {
+		return true
+	}
+
+	prefix := key + `[`
+	for srcKey := range self.src {
+		if strings.HasPrefix(srcKey, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+True if the type is decoded from a single string. Inverse of the rules used by
+`gr.Str` for encoding, with `encoding.TextUnmarshaler` as the inverse of
+`fmt.Stringer`.
+*/
+func isScalarType(typ r.Type) bool {
+	if typ == typeTime || typ == typeDuration || r.PtrTo(typ).Implements(typeTextUnmarshal) {
+		return true
+	}
+
+	switch typ.Kind() {
+	case r.Int8, r.Int16, r.Int32, r.Int64, r.Int,
+		r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uint,
+		r.Float32, r.Float64, r.Bool, r.String:
+		return true
+
+	case r.Slice:
+		return typ.Elem().Kind() == r.Uint8
+
+	default:
+		return false
+	}
+}
+
+// Parses the string into the given settable value of a scalar type.
+func parseScalar(src string, val r.Value, layout string) error {
+	typ := val.Type()
+
+	if typ == typeTime {
+		out, err := time.Parse(timeLayout(layout), src)
+		if err != nil {
+			return err
+		}
+		val.Set(r.ValueOf(out))
+		return nil
+	}
+
+	if typ == typeDuration {
+		out, err := time.ParseDuration(src)
+		if err != nil {
+			return err
+		}
+		val.SetInt(int64(out))
+		return nil
+	}
+
+	if r.PtrTo(typ).Implements(typeTextUnmarshal) {
+		return val.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(stringBytes(src))
+	}
+
+	switch typ.Kind() {
+	case r.Int8, r.Int16, r.Int32, r.Int64, r.Int:
+		out, err := strconv.ParseInt(src, 10, typ.Bits())
+		if err != nil {
+			return err
+		}
+		val.SetInt(out)
+
+	case r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uint:
+		out, err := strconv.ParseUint(src, 10, typ.Bits())
+		if err != nil {
+			return err
+		}
+		val.SetUint(out)
+
+	case r.Float32, r.Float64:
+		out, err := strconv.ParseFloat(src, typ.Bits())
+		if err != nil {
+			return err
+		}
+		val.SetFloat(out)
+
+	case r.Bool:
+		out, err := strconv.ParseBool(src)
+		if err != nil {
+			return err
+		}
+		val.SetBool(out)
+
+	case r.String:
+		val.SetString(src)
+
+	case r.Slice:
+		val.SetBytes([]byte(src))
+
+	default:
+		return fmt.Errorf(`unsupported type %v`, typ)
+	}
+	return nil
+}
+
+/*
+Decodes header values into the given output, which must be a non-nil pointer to
+a struct. Uses the struct tag "header" for header names, which are looked up
+via `gr.Head.Values`, and therefore don't need to be canonical. Untagged fields
+use the field name; fields tagged "-" and unexported fields are skipped;
+embedded structs are promoted. Fields without matching headers are left
+unchanged. Supported field types:
+
+	* built-in primitive types       -> parsed via "strconv"
+	* `time.Time`                    -> parsed with the layout from the
+	                                    "layout" tag, or as an HTTP date via
+	                                    `http.ParseTime`
+	* `time.Duration`                -> integer or decimal seconds, as in
+	                                    "Retry-After", or `time.ParseDuration`
+	* `encoding.TextUnmarshaler`     -> `.UnmarshalText`
+	* pointers                       -> allocated when a header matches
+	* slices                         -> every value of every matching header,
+	                                    split on commas, as in "Vary: A, B";
+	                                    `time.Time` elements are not split
+
+Single values are taken from the first matching header. Surrounding whitespace
+is trimmed. Example:
+
+	type RateLimit struct {
+		Limit     int           `header:"X-RateLimit-Limit"`
+		Remaining *int          `header:"X-RateLimit-Remaining"`
+		Reset     time.Duration `header:"X-RateLimit-Reset"`
+		RequestId string        `header:"X-Request-Id"`
+		Vary      []string      `header:"Vary"`
+	}
+
+Attempts to decode every field. If some fields fail, panics with `gr.FieldErrs`
+which describes each failure, leaving other fields decoded. Panics on invalid
+outputs. Accepts an "anonymous" type because all alias types such as
+`http.Header` and `gr.Head` are automatically castable into it.
+*/
+func DecodeHead(src map[string][]string, out interface{}) {
+	val := r.ValueOf(out)
+	if val.Kind() != r.Ptr || val.IsNil() || val.Elem().Kind() != r.Struct {
+		panic(fmt.Errorf(`[gr] failed to decode header: expected non-nil pointer to struct, got %T`, out))
+	}
+
+	dec := headDecoder{src: src}
+	dec.fields(val.Elem())
+	if dec.errs != nil {
+		panic(dec.errs)
+	}
+}
+
+// Non-panicking version of `gr.DecodeHead`.
+func DecodeHeadCatch(src map[string][]string, out interface{}) (err error) {
+	defer rec(&err)
+	DecodeHead(src, out)
+	return
+}
+
+/*
+Decodes the response header into the given struct via `gr.DecodeHead`. Doesn't
+read or close the body. Panics on errors. Returns the same response.
+*/
+func (self *Res) HeadStruct(out interface{}) *Res {
+	DecodeHead(self.Header, out)
+	return self
+}
+
+/*
+Non-panicking version of `(*gr.Res).HeadStruct`. If decoding of some fields
+fails, the error is `gr.FieldErrs`.
+*/
+func (self *Res) HeadStructCatch(out interface{}) (err error) {
+	defer rec(&err)
+	self.HeadStruct(out)
+	return
+}
+
+type headDecoder struct {
+	src  Head
+	errs FieldErrs
+}
+
+func (self *headDecoder) fields(val r.Value) {
+	typ := val.Type()
+
+	for ind := range iter(typ.NumField()) {
+		field := typ.Field(ind)
+		if field.PkgPath != `` {
+			continue
+		}
+
+		name, _ := tagNameOpts(field.Tag.Get(`header`))
+		if name == `-` {
+			continue
+		}
+
+		fieldVal := val.Field(ind)
+
+		if field.Anonymous && name == `` && isNestedType(field.Type) {
+			self.embed(fieldVal)
+			continue
+		}
+
+		if name == `` {
+			name = field.Name
+		}
+
+		vals := self.src.Values(name)
+		if len(vals) == 0 {
+			continue
+		}
+
+		err := decodeHeadField(vals, fieldVal, field.Tag.Get(tagLayout))
+		if err != nil {
+			self.errs = append(self.errs, FieldErr{Key: name, Cause: err})
+		}
+	}
+}
+
+// Embedded struct pointers are allocated only when some of their fields match.
+func (self *headDecoder) embed(val r.Value) {
+	if val.Kind() != r.Ptr {
+		self.fields(val)
+		return
+	}
+
+	if !val.IsNil() {
+		self.embed(val.Elem())
+		return
+	}
+
+	tmp := r.New(val.Type().Elem())
+	self.embed(tmp.Elem())
+	if !tmp.Elem().IsZero() {
+		val.Set(tmp)
+	}
+}
+
+func decodeHeadField(vals []string, val r.Value, layout string) error {
+	if val.Kind() == r.Ptr {
+		if val.IsNil() {
+			val.Set(r.New(val.Type().Elem()))
+		}
+		return decodeHeadField(vals, val.Elem(), layout)
+	}
+
+	typ := val.Type()
+
+	if isScalarType(typ) {
+		return parseHeadScalar(strings.TrimSpace(vals[0]), val, layout)
+	}
+
+	if typ.Kind() != r.Slice {
+		return fmt.Errorf(`unsupported type %v`, typ)
+	}
+
+	elemTyp := typ.Elem()
+	split := typeDeref(elemTyp) != typeTime
+
+	var strs []string
+	for _, val := range vals {
+		if !split {
+			strs = append(strs, strings.TrimSpace(val))
+			continue
+		}
+		for _, str := range strings.Split(val, `,`) {
+			str = strings.TrimSpace(str)
+			if str != `` {
+				strs = append(strs, str)
+			}
+		}
+	}
+
+	out := r.MakeSlice(typ, len(strs), len(strs))
+	for ind, str := range strs {
+		elem := out.Index(ind)
+		if elem.Kind() == r.Ptr {
+			elem.Set(r.New(elemTyp.Elem()))
+			elem = elem.Elem()
+		}
+		if !isScalarType(elem.Type()) {
+			return fmt.Errorf(`unsupported element type %v`, elemTyp)
+		}
+
+		err := parseHeadScalar(str, elem, layout)
+		if err != nil {
+			return err
+		}
+	}
+
+	val.Set(out)
+	return nil
+}
+
+// Like `parseScalar`, but with header-specific rules for times and durations.
+func parseHeadScalar(src string, val r.Value, layout string) error {
+	switch val.Type() {
+	case typeTime:
+		if layout != `` {
+			break
+		}
+		out, err := http.ParseTime(src)
+		if err != nil {
+			return err
+		}
+		val.Set(r.ValueOf(out))
+		return nil
+
+	case typeDuration:
+		secs, err := strconv.ParseFloat(src, 64)
+		if err != nil {
+			break
+		}
+		val.SetInt(int64(secs * float64(time.Second)))
+		return nil
+	}
+
+	return parseScalar(src, val, layout)
+}
@@ -0,0 +1,530 @@
+package gr_test
+
+import (
+	"net/http"
+	ht "net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mitranim/gr"
+)
+
+// Test server whose responses are defined by the given function. Counts
+// requests and records the last request headers.
+type cacheServer struct {
+	*ht.Server
+	count int32
+	head  http.Header
+}
+
+func newCacheServer(fun func(W, *Q)) *cacheServer {
+	out := new(cacheServer)
+	out.Server = ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+		atomic.AddInt32(&out.count, 1)
+		out.head = req.Header.Clone()
+		fun(rew, req)
+	}))
+	return out
+}
+
+func (self *cacheServer) Count() int { return int(atomic.LoadInt32(&self.count)) }
+
+func cacheGet(t testing.TB, cli *http.Client, path string, head ...string) (string, string) {
+	t.Helper()
+	req := gr.To(path).Cli(cli)
+	for ind := 0; ind+1 < len(head); ind += 2 {
+		req.HeadSet(head[ind], head[ind+1])
+	}
+	res := req.Res().Ok()
+	return res.ReadString(), res.Header.Get(gr.CacheHead)
+}
+
+func cacheCli(cache *gr.Cache) *http.Client {
+	return &http.Client{Transport: cache}
+}
+
+func TestCache_fresh(t *testing.T) {
+	var body int32
+	srv := newCacheServer(func(rew W, _ *Q) {
+		rew.Header().Set(`Cache-Control`, `max-age=60`)
+		_, _ = rew.Write([]byte(strconv.Itoa(int(atomic.AddInt32(&body, 1)))))
+	})
+	defer srv.Close()
+
+	cli := cacheCli(new(gr.Cache))
+
+	test := func(expBody, expStatus string, expCount int) {
+		t.Helper()
+		body, status := cacheGet(t, cli, srv.URL+`/one`)
+		eq(t, expBody, body)
+		eq(t, expStatus, status)
+		eq(t, expCount, srv.Count())
+	}
+
+	test(`1`, gr.CacheMiss, 1)
+	test(`1`, gr.CacheHit, 1)
+	test(`1`, gr.CacheHit, 1)
+
+	t.Run(`different URL`, func(t *testing.T) {
+		body, status := cacheGet(t, cli, srv.URL+`/two`)
+		eq(t, `2`, body)
+		eq(t, gr.CacheMiss, status)
+	})
+
+	t.Run(`HEAD is cached separately`, func(t *testing.T) {
+		res := gr.To(srv.URL + `/one`).Meth(http.MethodHead).Cli(cli).Res().Ok().Done()
+		eq(t, gr.CacheMiss, res.Header.Get(gr.CacheHead))
+
+		res = gr.To(srv.URL + `/one`).Meth(http.MethodHead).Cli(cli).Res().Ok().Done()
+		eq(t, gr.CacheHit, res.Header.Get(gr.CacheHead))
+		eq(t, int64(1), res.ContentLength)
+	})
+
+	t.Run(`request no-cache`, func(t *testing.T) {
+		body, status := cacheGet(t, cli, srv.URL+`/one`, `Cache-Control`, `no-cache`)
+		eq(t, `4`, body)
+		eq(t, gr.CacheMiss, status)
+
+		body, status = cacheGet(t, cli, srv.URL+`/one`, `Pragma`, `no-cache`)
+		eq(t, `5`, body)
+		eq(t, gr.CacheMiss, status)
+
+		body, status = cacheGet(t, cli, srv.URL+`/one`)
+		eq(t, `5`, body)
+		eq(t, gr.CacheHit, status)
+	})
+
+	t.Run(`request no-store`, func(t *testing.T) {
+		body, status := cacheGet(t, cli, srv.URL+`/one`, `Cache-Control`, `no-store`)
+		eq(t, `6`, body)
+		eq(t, gr.CacheMiss, status)
+
+		body, status = cacheGet(t, cli, srv.URL+`/one`)
+		eq(t, `5`, body)
+		eq(t, gr.CacheHit, status)
+	})
+
+	t.Run(`request max-age`, func(t *testing.T) {
+		body, status := cacheGet(t, cli, srv.URL+`/one`, `Cache-Control`, `max-age=0`)
+		eq(t, `7`, body)
+		eq(t, gr.CacheMiss, status)
+	})
+
+	t.Run(`request min-fresh`, func(t *testing.T) {
+		body, status := cacheGet(t, cli, srv.URL+`/one`, `Cache-Control`, `min-fresh=30`)
+		eq(t, `7`, body)
+		eq(t, gr.CacheHit, status)
+
+		body, status = cacheGet(t, cli, srv.URL+`/one`, `Cache-Control`, `min-fresh=120`)
+		eq(t, `8`, body)
+		eq(t, gr.CacheMiss, status)
+	})
+
+	t.Run(`bypass`, func(t *testing.T) {
+		body, status := cacheGet(t, cli, srv.URL+`/one`, `If-None-Match`, `"one"`)
+		eq(t, `9`, body)
+		eq(t, gr.CacheMiss, status)
+		eq(t, `"one"`, srv.head.Get(`If-None-Match`))
+	})
+}
+
+func TestCache_Age(t *testing.T) {
+	srv := newCacheServer(func(rew W, _ *Q) {
+		rew.Header().Set(`Cache-Control`, `max-age=60`)
+		rew.Header().Set(`Age`, `50`)
+		_, _ = rew.Write([]byte(`body`))
+	})
+	defer srv.Close()
+
+	cli := cacheCli(new(gr.Cache))
+
+	cacheGet(t, cli, srv.URL)
+	res := gr.To(srv.URL).Cli(cli).Res().Ok().Done()
+	eq(t, gr.CacheHit, res.Header.Get(gr.CacheHead))
+	eq(t, `50`, res.Header.Get(`Age`))
+
+	_, status := cacheGet(t, cli, srv.URL, `Cache-Control`, `max-age=40`)
+	eq(t, gr.CacheMiss, status)
+}
+
+func TestCache_stale(t *testing.T) {
+	srv := newCacheServer(func(rew W, _ *Q) {
+		rew.Header().Set(`Cache-Control`, `max-age=60`)
+		rew.Header().Set(`Age`, `100`)
+		_, _ = rew.Write([]byte(`body`))
+	})
+	defer srv.Close()
+
+	cli := cacheCli(new(gr.Cache))
+
+	_, status := cacheGet(t, cli, srv.URL)
+	eq(t, gr.CacheMiss, status)
+
+	// Without validators, stale responses are fetched again.
+	_, status = cacheGet(t, cli, srv.URL)
+	eq(t, gr.CacheMiss, status)
+	eq(t, 2, srv.Count())
+
+	_, status = cacheGet(t, cli, srv.URL, `Cache-Control`, `max-stale=30`)
+	eq(t, gr.CacheMiss, status)
+
+	_, status = cacheGet(t, cli, srv.URL, `Cache-Control`, `max-stale=50`)
+	eq(t, gr.CacheHit, status)
+
+	_, status = cacheGet(t, cli, srv.URL, `Cache-Control`, `max-stale`)
+	eq(t, gr.CacheHit, status)
+	eq(t, 3, srv.Count())
+}
+
+func TestCache_Expires(t *testing.T) {
+	srv := newCacheServer(func(rew W, req *Q) {
+		now := time.Now().UTC()
+		rew.Header().Set(`Date`, now.Format(http.TimeFormat))
+		if req.URL.Path == `/past` {
+			rew.Header().Set(`Expires`, now.Add(-time.Hour).Format(http.TimeFormat))
+		} else if req.URL.Path == `/invalid` {
+			rew.Header().Set(`Expires`, `0`)
+		} else {
+			rew.Header().Set(`Expires`, now.Add(time.Hour).Format(http.TimeFormat))
+		}
+	})
+	defer srv.Close()
+
+	cli := cacheCli(new(gr.Cache))
+
+	test := func(path, exp string) {
+		t.Helper()
+		cacheGet(t, cli, srv.URL+path)
+		_, status := cacheGet(t, cli, srv.URL+path)
+		eq(t, exp, status)
+	}
+
+	test(`/future`, gr.CacheHit)
+	test(`/past`, gr.CacheMiss)
+	test(`/invalid`, gr.CacheMiss)
+}
+
+func TestCache_heuristic(t *testing.T) {
+	srv := newCacheServer(func(rew W, req *Q) {
+		now := time.Now().UTC()
+		rew.Header().Set(`Date`, now.Format(http.TimeFormat))
+		rew.Header().Set(`Last-Modified`, now.Add(-time.Hour*24).Format(http.TimeFormat))
+		if req.URL.Path == `/missing` {
+			rew.WriteHeader(http.StatusNotFound)
+		} else if req.URL.Path == `/error` {
+			rew.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	defer srv.Close()
+
+	cli := cacheCli(new(gr.Cache))
+
+	test := func(path, exp string) {
+		t.Helper()
+		for range iter(2) {
+			gr.To(srv.URL + path).Cli(cli).Res().Done()
+		}
+		res := gr.To(srv.URL + path).Cli(cli).Res().Done()
+		eq(t, exp, res.Header.Get(gr.CacheHead))
+	}
+
+	test(`/ok`, gr.CacheHit)
+	test(`/missing`, gr.CacheHit)
+	test(`/error`, gr.CacheMiss)
+}
+
+func TestCache_revalidate(t *testing.T) {
+	var version int32 = 1
+	mod := time.Now().UTC().Add(-time.Hour).Format(http.TimeFormat)
+
+	srv := newCacheServer(func(rew W, req *Q) {
+		etag := `"v` + strconv.Itoa(int(atomic.LoadInt32(&version))) + `"`
+		rew.Header().Set(`Cache-Control`, `no-cache`)
+		rew.Header().Set(`Etag`, etag)
+		rew.Header().Set(`Last-Modified`, mod)
+		rew.Header().Set(`X-Version`, etag)
+
+		if req.Header.Get(`If-None-Match`) == etag {
+			rew.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = rew.Write([]byte(`body ` + etag))
+	})
+	defer srv.Close()
+
+	cli := cacheCli(new(gr.Cache))
+
+	body, status := cacheGet(t, cli, srv.URL)
+	eq(t, `body "v1"`, body)
+	eq(t, gr.CacheMiss, status)
+	eq(t, ``, srv.head.Get(`If-None-Match`))
+
+	res := gr.To(srv.URL).Cli(cli).Res().Ok()
+	eq(t, `body "v1"`, res.ReadString())
+	eq(t, gr.CacheRevalidated, res.Header.Get(gr.CacheHead))
+	eq(t, `"v1"`, srv.head.Get(`If-None-Match`))
+	eq(t, mod, srv.head.Get(`If-Modified-Since`))
+	eq(t, 2, srv.Count())
+
+	atomic.StoreInt32(&version, 2)
+
+	body, status = cacheGet(t, cli, srv.URL)
+	eq(t, `body "v2"`, body)
+	eq(t, gr.CacheMiss, status)
+
+	body, status = cacheGet(t, cli, srv.URL)
+	eq(t, `body "v2"`, body)
+	eq(t, gr.CacheRevalidated, status)
+	eq(t, `"v2"`, srv.head.Get(`If-None-Match`))
+	eq(t, 4, srv.Count())
+
+	t.Run(`only-if-cached`, func(t *testing.T) {
+		res := gr.To(srv.URL+`/other`).Cli(cli).HeadSet(`Cache-Control`, `only-if-cached`).Res().Done()
+		eq(t, http.StatusGatewayTimeout, res.StatusCode)
+		eq(t, gr.CacheMiss, res.Header.Get(gr.CacheHead))
+		eq(t, 4, srv.Count())
+	})
+}
+
+func TestCache_revalidate_headers(t *testing.T) {
+	var count int32
+	srv := newCacheServer(func(rew W, req *Q) {
+		val := strconv.Itoa(int(atomic.AddInt32(&count, 1)))
+		rew.Header().Set(`Cache-Control`, `max-age=0`)
+		rew.Header().Set(`Etag`, `"one"`)
+		rew.Header().Set(`X-Count`, val)
+
+		if req.Header.Get(`If-None-Match`) != `` {
+			rew.Header().Set(`Cache-Control`, `max-age=60`)
+			rew.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = rew.Write([]byte(`body`))
+	})
+	defer srv.Close()
+
+	cli := cacheCli(new(gr.Cache))
+
+	test := func(expStatus, expCount string) {
+		t.Helper()
+		res := gr.To(srv.URL).Cli(cli).Res().Ok()
+		eq(t, `body`, res.ReadString())
+		eq(t, expStatus, res.Header.Get(gr.CacheHead))
+		eq(t, expCount, res.Header.Get(`X-Count`))
+	}
+
+	test(gr.CacheMiss, `1`)
+	test(gr.CacheRevalidated, `2`)
+	test(gr.CacheHit, `2`)
+	eq(t, 2, srv.Count())
+}
+
+func TestCache_Vary(t *testing.T) {
+	srv := newCacheServer(func(rew W, req *Q) {
+		rew.Header().Set(`Cache-Control`, `max-age=60`)
+		if req.URL.Path == `/star` {
+			rew.Header().Set(`Vary`, `*`)
+		} else {
+			rew.Header().Set(`Vary`, `accept-language, X-Other`)
+		}
+		_, _ = rew.Write([]byte(req.Header.Get(`Accept-Language`)))
+	})
+	defer srv.Close()
+
+	cli := cacheCli(new(gr.Cache))
+
+	test := func(lang, expStatus string) {
+		t.Helper()
+		body, status := cacheGet(t, cli, srv.URL, `Accept-Language`, lang)
+		eq(t, lang, body)
+		eq(t, expStatus, status)
+	}
+
+	test(`en`, gr.CacheMiss)
+	test(`en`, gr.CacheHit)
+	test(`fr`, gr.CacheMiss)
+	test(`fr`, gr.CacheHit)
+	test(`en`, gr.CacheMiss)
+
+	_, status := cacheGet(t, cli, srv.URL, `Accept-Language`, `en`, `X-Other`, `one`)
+	eq(t, gr.CacheMiss, status)
+
+	cacheGet(t, cli, srv.URL+`/star`)
+	_, status = cacheGet(t, cli, srv.URL+`/star`)
+	eq(t, gr.CacheMiss, status)
+}
+
+func TestCache_storable(t *testing.T) {
+	srv := newCacheServer(func(rew W, req *Q) {
+		switch req.URL.Path {
+		case `/no-store`:
+			rew.Header().Set(`Cache-Control`, `no-store, max-age=60`)
+		case `/private`:
+			rew.Header().Set(`Cache-Control`, `private, max-age=60`)
+		case `/quoted`:
+			rew.Header().Set(`Cache-Control`, `no-cache="Set-Cookie, X-Other", max-age=60`)
+		case `/created`:
+			rew.Header().Set(`Cache-Control`, `max-age=60`)
+			rew.WriteHeader(http.StatusCreated)
+		case `/partial`:
+			rew.Header().Set(`Cache-Control`, `max-age=60`)
+			rew.Header().Set(`Content-Range`, `bytes 0-0/10`)
+			rew.WriteHeader(http.StatusPartialContent)
+		case `/none`:
+		}
+		_, _ = rew.Write([]byte(`b`))
+	})
+	defer srv.Close()
+
+	cli := cacheCli(new(gr.Cache))
+
+	test := func(path, exp string) {
+		t.Helper()
+		gr.To(srv.URL + path).Cli(cli).Res().Done()
+		res := gr.To(srv.URL + path).Cli(cli).Res().Done()
+		eq(t, exp, res.Header.Get(gr.CacheHead))
+	}
+
+	test(`/no-store`, gr.CacheMiss)
+	test(`/private`, gr.CacheHit)
+	test(`/quoted`, gr.CacheMiss)
+	test(`/created`, gr.CacheHit)
+	test(`/partial`, gr.CacheMiss)
+	test(`/none`, gr.CacheMiss)
+}
+
+func TestCache_invalidate(t *testing.T) {
+	var count int32
+	srv := newCacheServer(func(rew W, req *Q) {
+		if req.Method == http.MethodPost {
+			if req.URL.Path == `/fail` {
+				rew.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		rew.Header().Set(`Cache-Control`, `max-age=60`)
+		_, _ = rew.Write([]byte(strconv.Itoa(int(atomic.AddInt32(&count, 1)))))
+	})
+	defer srv.Close()
+
+	cli := cacheCli(new(gr.Cache))
+
+	test := func(path, expBody, expStatus string) {
+		t.Helper()
+		body, status := cacheGet(t, cli, srv.URL+path)
+		eq(t, expBody, body)
+		eq(t, expStatus, status)
+	}
+
+	test(`/one`, `1`, gr.CacheMiss)
+	test(`/fail`, `2`, gr.CacheMiss)
+
+	res := gr.To(srv.URL + `/one`).Post().Cli(cli).Res().Ok().Done()
+	eq(t, ``, res.Header.Get(gr.CacheHead))
+	test(`/one`, `3`, gr.CacheMiss)
+
+	gr.To(srv.URL + `/fail`).Post().Cli(cli).Res().Done()
+	test(`/fail`, `2`, gr.CacheHit)
+}
+
+func TestCacheDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), `cache`)
+
+	srv := newCacheServer(func(rew W, _ *Q) {
+		rew.Header().Set(`Cache-Control`, `max-age=60`)
+		rew.Header().Set(`Vary`, `Accept`)
+		rew.Header().Set(`Content-Type`, gr.TypeJson)
+		_, _ = rew.Write([]byte(`{"one":"two"}`))
+	})
+	defer srv.Close()
+
+	test := func(expStatus string) {
+		t.Helper()
+		cli := cacheCli(&gr.Cache{Store: gr.CacheDir(dir)})
+
+		res := gr.To(srv.URL).Cli(cli).HeadSet(`Accept`, gr.TypeJson).Res().Ok()
+		eq(t, `{"one":"two"}`, res.ReadString())
+		eq(t, expStatus, res.Header.Get(gr.CacheHead))
+		eq(t, gr.TypeJson, res.Header.Get(`Content-Type`))
+		eq(t, int64(13), res.ContentLength)
+	}
+
+	test(gr.CacheMiss)
+
+	// New instances reuse the stored responses.
+	test(gr.CacheHit)
+	test(gr.CacheHit)
+	eq(t, 1, srv.Count())
+
+	files, err := os.ReadDir(dir)
+	try(err)
+	eq(t, 1, len(files))
+
+	t.Run(`corrupted`, func(t *testing.T) {
+		try(os.WriteFile(filepath.Join(dir, files[0].Name()), []byte(`invalid`), os.ModePerm))
+		test(gr.CacheMiss)
+		test(gr.CacheHit)
+		eq(t, 2, srv.Count())
+	})
+
+	t.Run(`store`, func(t *testing.T) {
+		store := gr.CacheDir(t.TempDir())
+
+		val, err := store.Load(`one`)
+		eq(t, nil, err)
+		eq(t, []byte(nil), val)
+
+		try(store.Store(`one`, []byte(`two`)))
+		val, err = store.Load(`one`)
+		eq(t, nil, err)
+		eq(t, []byte(`two`), val)
+
+		try(store.Delete(`one`))
+		try(store.Delete(`one`))
+		val, err = store.Load(`one`)
+		eq(t, nil, err)
+		eq(t, []byte(nil), val)
+	})
+}
+
+func TestCacheMem(t *testing.T) {
+	var store gr.CacheMem
+	cache := &gr.Cache{Store: &store}
+
+	srv := newCacheServer(func(rew W, _ *Q) {
+		rew.Header().Set(`Cache-Control`, `max-age=60`)
+	})
+	defer srv.Close()
+
+	cli := &http.Client{Transport: gr.Mids{cache.Mid}.Wrap(nil)}
+	cacheGet(t, cli, srv.URL+`/one`)
+	cacheGet(t, cli, srv.URL+`/two`)
+	cacheGet(t, cli, srv.URL+`/two`)
+	eq(t, 2, store.Len())
+	eq(t, 2, srv.Count())
+
+	try(store.Delete(`GET ` + srv.URL + `/one`))
+	eq(t, 1, store.Len())
+}
+
+func TestCache_errors(t *testing.T) {
+	cache := new(gr.Cache)
+	cli := &http.Client{Transport: cache.Mid(&Trans{Err: errRead})}
+
+	_, err := gr.To(`https://example.com`).Cli(cli).ResCatch()
+	errs(t, errRead.Error(), err)
+
+	cli = &http.Client{Transport: cache.Mid(&Trans{Res: &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{`Cache-Control`: {`max-age=60`}},
+		Body:       FailReadCloser{},
+	}})}
+
+	_, err = gr.To(`https://example.com`).Cli(cli).ResCatch()
+	errs(t, `[gr] cache failure`, err)
+	errs(t, errRead.Error(), err)
+}
@@ -0,0 +1,120 @@
+package gr_test
+
+import (
+	"fmt"
+	"net/http"
+	ht "net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitranim/gr"
+)
+
+func cassetteServer() *ht.Server {
+	var count int
+
+	return ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+		count++
+		rew.Header().Set(`Set-Cookie`, `session=secret`)
+		fmt.Fprintf(rew, `%v %v %v %v`, count, req.Method, req.URL.RequestURI(), readStr(req.Body))
+	}))
+}
+
+func cassetteCli(cas *gr.Cassette) *gr.Cli {
+	return &gr.Cli{Transport: cas}
+}
+
+func TestCassette(t *testing.T) {
+	srv := cassetteServer()
+	path := filepath.Join(t.TempDir(), `cassette.http`)
+
+	rec := &gr.Cassette{Path: path, Redact: []string{`authorization`, `Set-Cookie`}, Body: true}
+	eq(t, false, rec.IsReplay())
+
+	send := func(cli *gr.Cli, req *gr.Req) string {
+		t.Helper()
+		return cli.Do(req).Ok().ReadString()
+	}
+
+	recCli := cassetteCli(rec)
+	eq(t, `1 GET /one?a=1&b=2 `, send(recCli, gr.To(srv.URL).Path(`/one`).RawQuery(`a=1&b=2`).HeadSet(`Authorization`, `Bearer secret`)))
+	eq(t, `2 GET /one?a=1&b=2 `, send(recCli, gr.To(srv.URL).Path(`/one`).RawQuery(`a=1&b=2`)))
+	eq(t, `3 POST /two body_one`, send(recCli, gr.To(srv.URL).Path(`/two`).Post().String(`body_one`)))
+	eq(t, `4 POST /two body_two`, send(recCli, gr.To(srv.URL).Path(`/two`).Post().String(`body_two`)))
+	srv.Close()
+
+	chunk, err := os.ReadFile(path)
+	try(err)
+	file := string(chunk)
+	eq(t, false, strings.Contains(file, `secret`))
+	eq(t, true, strings.Contains(file, "Authorization: "+gr.Redacted+"\r\n"))
+	eq(t, true, strings.Contains(file, "Set-Cookie: "+gr.Redacted+"\r\n"))
+
+	play := &gr.Cassette{Path: path, Mode: gr.CassetteReplay, Body: true}
+	eq(t, true, play.IsReplay())
+	playCli := cassetteCli(play)
+
+	t.Run(`normalized query`, func(t *testing.T) {
+		host := strings.TrimPrefix(srv.URL, `http://`)
+		eq(t, `1 GET /one?a=1&b=2 `, send(playCli, gr.To(`https://`+host).Path(`/one`).RawQuery(`b=2&a=1`)))
+		eq(t, `2 GET /one?a=1&b=2 `, send(playCli, gr.To(srv.URL).Path(`/one`).RawQuery(`a=1&b=2`)))
+		eq(t, `2 GET /one?a=1&b=2 `, send(playCli, gr.To(srv.URL).Path(`/one`).RawQuery(`a=1&b=2`)))
+	})
+
+	t.Run(`body`, func(t *testing.T) {
+		eq(t, `4 POST /two body_two`, send(playCli, gr.To(srv.URL).Path(`/two`).Post().String(`body_two`)))
+		eq(t, `3 POST /two body_one`, send(playCli, gr.To(srv.URL).Path(`/two`).Post().String(`body_one`)))
+
+		res := gr.To(srv.URL).Path(`/two`).Post().String(`body_one`).Cli(playCli.Cli()).Res()
+		eq(t, http.StatusOK, res.StatusCode)
+		eq(t, gr.Redacted, res.Header.Get(`Set-Cookie`))
+		eq(t, `3 POST /two body_one`, res.ReadString())
+	})
+
+	t.Run(`mismatch`, func(t *testing.T) {
+		_, err := gr.To(srv.URL).Path(`/three`).Cli(playCli.Cli()).ResCatch()
+		errs(t, `[gr] cassette failure: no recorded exchange matches GET `, err)
+
+		_, err = gr.To(srv.URL).Path(`/two`).Post().String(`body_three`).Cli(playCli.Cli()).ResCatch()
+		errs(t, `no recorded exchange matches POST`, err)
+	})
+
+	t.Run(`ignoring body`, func(t *testing.T) {
+		cli := cassetteCli(&gr.Cassette{Path: path, Mode: gr.CassetteReplay})
+		eq(t, `3 POST /two body_one`, send(cli, gr.To(srv.URL).Path(`/two`).Post().String(`body_three`)))
+	})
+}
+
+func TestCassette_Mid(t *testing.T) {
+	srv := ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+		rew.Header().Set(`Content-Length`, `11`)
+		if req.Method != http.MethodHead {
+			_, _ = rew.Write([]byte(`hello world`))
+		}
+	}))
+	path := filepath.Join(t.TempDir(), `cassette.http`)
+
+	test := func(cli *gr.Cli) {
+		t.Helper()
+
+		// Without a path, the request is written with "/".
+		eq(t, `hello world`, cli.Req().To(srv.URL).Res().Ok().ReadString())
+
+		// Responses to HEAD preserve the length of the representation.
+		res := cli.Req().To(srv.URL).Path(`/file`).Meth(http.MethodHead).Res().Ok()
+		eq(t, int64(11), res.ContentLength)
+		eq(t, `11`, res.Header.Get(`Content-Length`))
+		eq(t, ``, res.ReadString())
+	}
+
+	rec := &gr.Cassette{Path: path, Mode: gr.CassetteRecord}
+	test(new(gr.Cli).Use(rec.Mid))
+	srv.Close()
+
+	play := &gr.Cassette{Path: path, Mode: gr.CassetteReplay}
+	trans := &Trans{Err: errRead}
+	test((&gr.Cli{Transport: trans}).Use(play.Mid))
+	eq(t, (*http.Request)(nil), trans.Req)
+}
@@ -0,0 +1,122 @@
+package gr_test
+
+import (
+	"net/http"
+	ht "net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitranim/gr"
+)
+
+func TestReq_IfNoneMatch(t *testing.T) {
+	test := func(exp string, vals ...string) {
+		t.Helper()
+		req := gr.To(`/`).HeadSet(`If-None-Match`, `"prev"`).IfNoneMatch(vals...)
+		eq(t, exp, req.Header.Get(`If-None-Match`))
+		eq(t, exp != ``, gr.Head(req.Header).Has(`If-None-Match`))
+	}
+
+	test(``)
+	test(``, ``, ` `)
+	test(`*`, `*`)
+	test(`"one"`, `one`)
+	test(`"one"`, `"one"`)
+	test(`W/"one"`, `W/"one"`)
+	test(`"one", W/"two", "three"`, `one`, ``, `W/"two"`, ` "three" `)
+
+	eq(t, `"one"`, new(gr.Req).IfNoneMatch(`one`).Header.Get(`If-None-Match`))
+}
+
+func TestReq_IfMatch(t *testing.T) {
+	eq(t, `"one", "two"`, new(gr.Req).IfMatch(`one`, `"two"`).Header.Get(`If-Match`))
+	eq(t, gr.Head(nil).Init(), gr.Head(new(gr.Req).IfMatch(`one`).IfMatch().Header))
+}
+
+func TestReq_IfModifiedSince(t *testing.T) {
+	inst := time.Date(2024, 1, 2, 3, 4, 5, 6, time.FixedZone(``, 3600))
+
+	eq(t, `Tue, 02 Jan 2024 02:04:05 GMT`, new(gr.Req).IfModifiedSince(inst).Header.Get(`If-Modified-Since`))
+	eq(t, `Tue, 02 Jan 2024 02:04:05 GMT`, new(gr.Req).IfUnmodifiedSince(inst).Header.Get(`If-Unmodified-Since`))
+
+	req := new(gr.Req).IfModifiedSince(inst).IfModifiedSince(time.Time{})
+	eq(t, false, gr.Head(req.Header).Has(`If-Modified-Since`))
+}
+
+func TestRes_Etag(t *testing.T) {
+	eq(t, ``, new(gr.Res).Etag())
+	eq(t, `W/"one"`, (&gr.Res{Header: H{`Etag`: {`W/"one"`}}}).Etag())
+}
+
+func TestRes_LastModified(t *testing.T) {
+	eq(t, time.Time{}, new(gr.Res).LastModified())
+	eq(t, time.Time{}, (&gr.Res{Header: H{`Last-Modified`: {`invalid`}}}).LastModified())
+	eq(
+		t,
+		time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		(&gr.Res{Header: H{`Last-Modified`: {`Tue, 02 Jan 2024 03:04:05 GMT`}}}).LastModified(),
+	)
+}
+
+func TestRes_NotModified(t *testing.T) {
+	test := func(code int, exp bool, expClose bool) {
+		t.Helper()
+		body := NewReaderCloseFlag(`body`)
+		res := &gr.Res{StatusCode: code, Body: body}
+		eq(t, true, res.IsNotModified() == (code == http.StatusNotModified))
+		eq(t, exp, res.NotModified())
+		eq(t, expClose, body.DidClose)
+	}
+
+	test(http.StatusNotModified, true, true)
+	test(http.StatusOK, false, false)
+
+	ok, err := (&gr.Res{StatusCode: http.StatusNotFound, Body: NewReaderCloseFlag(`missing`)}).NotModifiedCatch()
+	eq(t, false, ok)
+	errs(t, `[gr] error (HTTP status 404): unexpected non-OK response; body: missing`, err)
+}
+
+func TestRes_PreconditionFailed(t *testing.T) {
+	test := func(code int, exp bool, expClose bool) {
+		t.Helper()
+		body := NewReaderCloseFlag(`body`)
+		res := &gr.Res{StatusCode: code, Body: body}
+		eq(t, true, res.IsPreconditionFailed() == (code == http.StatusPreconditionFailed))
+		eq(t, exp, res.PreconditionFailed())
+		eq(t, expClose, body.DidClose)
+	}
+
+	test(http.StatusPreconditionFailed, true, true)
+	test(http.StatusNoContent, false, false)
+
+	ok, err := (&gr.Res{StatusCode: http.StatusConflict, Body: NewReaderCloseFlag(`conflict`)}).PreconditionFailedCatch()
+	eq(t, false, ok)
+	errs(t, `[gr] error (HTTP status 409): unexpected non-OK response; body: conflict`, err)
+}
+
+// Round trip with `http.ServeContent`, which implements conditional requests.
+func TestCond_server(t *testing.T) {
+	mod := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	srv := ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+		rew.Header().Set(`Etag`, `"v1"`)
+		http.ServeContent(rew, req, ``, mod, strings.NewReader(`content`))
+	}))
+	defer srv.Close()
+
+	res := gr.To(srv.URL).Res()
+	eq(t, false, res.NotModified())
+	eq(t, `content`, res.ReadString())
+	eq(t, `"v1"`, res.Etag())
+	eq(t, mod, res.LastModified())
+
+	eq(t, true, gr.To(srv.URL).IfNoneMatch(`v1`).Res().NotModified())
+	eq(t, false, gr.To(srv.URL).IfNoneMatch(`v0`).Res().NotModified())
+	eq(t, true, gr.To(srv.URL).IfModifiedSince(mod).Res().NotModified())
+	eq(t, false, gr.To(srv.URL).IfModifiedSince(mod.Add(-time.Second)).Res().NotModified())
+
+	eq(t, false, gr.To(srv.URL).Put().IfMatch(`v1`).Res().PreconditionFailed())
+	eq(t, true, gr.To(srv.URL).Put().IfMatch(`v0`).Res().PreconditionFailed())
+	eq(t, false, gr.To(srv.URL).Put().IfUnmodifiedSince(mod).Res().PreconditionFailed())
+	eq(t, true, gr.To(srv.URL).Put().IfUnmodifiedSince(mod.Add(-time.Second)).Res().PreconditionFailed())
+}
@@ -0,0 +1,145 @@
+package gr_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitranim/gr"
+)
+
+func TestReq_Curl(t *testing.T) {
+	eq(t, `curl`, new(gr.Req).Curl())
+	eq(t, `curl https://example.com/path`, gr.To(`https://example.com/path`).Curl())
+
+	req := gr.To(`https://example.com/path?one=two&three=four`).
+		Post().
+		HeadSet(`X-Quote`, `it's`).
+		HeadSet(`X-Empty`, ``).
+		Json(map[string]string{`five`: `six seven`})
+
+	eq(
+		t,
+		`curl -X POST 'https://example.com/path?one=two&three=four' -H 'Content-Type: application/json' -H 'X-Empty;' -H 'X-Quote: it'\''s' --data-binary '{"five":"six seven"}'`,
+		req.Curl(),
+	)
+
+	eq(t, `{"five":"six seven"}`, readStr(req.Body))
+
+	// With a body, curl defaults to POST.
+	eq(t, `curl -X GET https://example.com -H 'Content-Type: text/plain' --data-binary one`, gr.To(`https://example.com`).HeadSet(`Content-Type`, `text/plain`).String(`one`).Curl())
+	eq(t, `curl -X GET https://example.com --data-binary one`, gr.To(`https://example.com`).Get().String(`one`).Curl())
+	eq(t, `curl https://example.com`, gr.To(`https://example.com`).Get().String(``).Curl())
+
+	out := gr.ParseCurl(gr.To(`https://example.com`).String(`one`).Curl())
+	eq(t, http.MethodGet, out.Method)
+	eq(t, `one`, readStr(out.Body))
+
+	t.Run(`roundtrip`, func(t *testing.T) {
+		src := gr.To(`https://example.com/path?one=two`).Put().HeadSet(`X-One`, `it's`).String(`"body" $HOME`)
+		out := gr.ParseCurl(src.Curl())
+		eq(t, src.Method, out.Method)
+		eq(t, src.URL.String(), out.URL.String())
+		eq(t, `it's`, out.Header.Get(`X-One`))
+		eq(t, `"body" $HOME`, readStr(out.Body))
+	})
+}
+
+func TestParseCurl(t *testing.T) {
+	t.Run(`method and url`, func(t *testing.T) {
+		req := gr.ParseCurl(`curl example.com/path`)
+		eq(t, http.MethodGet, req.Method)
+		eq(t, `http://example.com/path`, req.URL.String())
+		eq(t, nil, req.Body)
+
+		eq(t, http.MethodDelete, gr.ParseCurl(`curl -X DELETE https://example.com`).Method)
+		eq(t, http.MethodPatch, gr.ParseCurl(`curl -XPATCH https://example.com`).Method)
+		eq(t, http.MethodPut, gr.ParseCurl(`curl --request=PUT --url https://example.com`).Method)
+		eq(t, http.MethodHead, gr.ParseCurl(`curl -sSL -I https://example.com`).Method)
+	})
+
+	t.Run(`headers`, func(t *testing.T) {
+		req := gr.ParseCurl(`curl https://example.com -H 'X-One: two' -H "X-One: three" --header X-Empty\; -H 'Content-Type:' -d four`)
+		eq(t, H{`X-One`: {`two`, `three`}, `X-Empty`: {``}}, req.Header)
+	})
+
+	t.Run(`data`, func(t *testing.T) {
+		req := gr.ParseCurl(`curl https://example.com -d one=two --data 'three=four five' --data-urlencode 'six=seven & eight' --data-urlencode =nine/ten`)
+		eq(t, http.MethodPost, req.Method)
+		eq(t, gr.TypeForm, req.Header.Get(gr.Type))
+		eq(t, `one=two&three=four five&six=seven+%26+eight&nine%2Ften`, readStr(req.Body))
+
+		req = gr.ParseCurl(`curl -X PUT https://example.com --data-raw @literal`)
+		eq(t, http.MethodPut, req.Method)
+		eq(t, `@literal`, readStr(req.Body))
+	})
+
+	t.Run(`data files`, func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, `data.txt`)
+		try(os.WriteFile(path, []byte("one\r\ntwo\n"), os.ModePerm))
+
+		eq(t, `onetwo`, readStr(gr.ParseCurl(`curl example.com -d @`+path).Body))
+		eq(t, "one\r\ntwo\n", readStr(gr.ParseCurl(`curl example.com --data-binary @`+path).Body))
+		eq(t, `key=one%0D%0Atwo%0A`, readStr(gr.ParseCurl(`curl example.com --data-urlencode key@`+path).Body))
+	})
+
+	t.Run(`json`, func(t *testing.T) {
+		req := gr.ParseCurl(`curl https://example.com --json '{"one":' --json '"two"}'`)
+		eq(t, http.MethodPost, req.Method)
+		eq(t, H{gr.Type: {gr.TypeJson}, `Accept`: {gr.TypeJson}}, req.Header)
+		eq(t, `{"one":"two"}`, readStr(req.Body))
+	})
+
+	t.Run(`user`, func(t *testing.T) {
+		req := gr.ParseCurl(`curl -u 'one:two' https://example.com`)
+		eq(t, `Basic b25lOnR3bw==`, req.Header.Get(`Authorization`))
+
+		user, pass, ok := req.Req().BasicAuth()
+		eq(t, true, ok)
+		eq(t, `one`, user)
+		eq(t, `two`, pass)
+	})
+
+	t.Run(`form`, func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, `file.txt`)
+		try(os.WriteFile(path, []byte(`file content`), os.ModePerm))
+
+		req := gr.ParseCurl(`curl https://example.com -F one=two -F 'three=@` + path + `' -F 'four=@` + path + `;type=text/x-custom;filename=other.txt' -F 'five=<` + path + `'`)
+		eq(t, http.MethodPost, req.Method)
+		eq(t, true, strings.HasPrefix(req.Header.Get(gr.Type), gr.TypeMulti+`; boundary=`))
+
+		body := readStr(req.Body)
+		eq(t, true, strings.Contains(body, "name=\"one\"\r\n\r\ntwo\r\n"))
+		eq(t, true, strings.Contains(body, "name=\"three\"; filename=\"file.txt\"\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nfile content\r\n"))
+		eq(t, true, strings.Contains(body, "name=\"four\"; filename=\"other.txt\"\r\nContent-Type: text/x-custom\r\n\r\nfile content\r\n"))
+		eq(t, true, strings.Contains(body, "name=\"five\"\r\n\r\nfile content\r\n"))
+	})
+
+	t.Run(`shell quoting`, func(t *testing.T) {
+		req := gr.ParseCurl("curl \\\n  'https://example.com' \\\n  -d \"one \\\"two\\\" \\$three\" -d four\\ five")
+		eq(t, `one "two" $three&four five`, readStr(req.Body))
+	})
+
+	t.Run(`errors`, func(t *testing.T) {
+		test := func(exp, src string) {
+			t.Helper()
+			_, err := gr.ParseCurlCatch(src)
+			errs(t, `[gr] failed to parse curl command: `+exp, err)
+		}
+
+		test(`missing URL`, `curl -X POST`)
+		test(`unexpected argument "two"`, `curl one two`)
+		test(`missing value for option "-H"`, `curl example.com -H`)
+		test(`unsupported option "--proxy"`, `curl example.com --proxy one`)
+		test(`invalid header "one"`, `curl example.com -H one`)
+		test(`invalid form field "one"`, `curl example.com -F one`)
+		test(`can't combine form and data options`, `curl example.com -F one=two -d three`)
+		test(`unterminated single quote`, `curl 'example.com`)
+		test(`unterminated double quote`, `curl "example.com`)
+		test(`unexpected trailing backslash`, `curl example.com \`)
+	})
+}
@@ -0,0 +1,355 @@
+package gr_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	ht "net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mitranim/gr"
+)
+
+const downloadContent = `Lorem ipsum dolor sit amet, consectetur adipiscing elit.`
+
+func downloadSum(src string) []byte {
+	sum := sha256.Sum256([]byte(src))
+	return sum[:]
+}
+
+/*
+Serves `downloadContent` via `http.ServeContent`, which supports "Range" and
+"If-Range". Records request headers. If `.cut` is positive, the next response
+is interrupted after that many bytes.
+*/
+type downloadServer struct {
+	*ht.Server
+	lock    sync.Mutex
+	heads   []http.Header
+	etag    string
+	content string
+	cut     int
+	head    http.Header
+}
+
+func newDownloadServer() *downloadServer {
+	out := &downloadServer{etag: `"v1"`, content: downloadContent}
+	out.Server = ht.NewServer(http.HandlerFunc(out.serve))
+	return out
+}
+
+func (self *downloadServer) serve(rew W, req *Q) {
+	self.lock.Lock()
+	self.heads = append(self.heads, req.Header.Clone())
+	cut := self.cut
+	self.cut = 0
+	content, etag, head := self.content, self.etag, self.head
+	self.lock.Unlock()
+
+	if req.URL.Path == `/missing` {
+		http.NotFound(rew, req)
+		return
+	}
+
+	for key, vals := range head {
+		rew.Header()[key] = vals
+	}
+	if etag != `` {
+		rew.Header().Set(`Etag`, etag)
+	}
+
+	if cut > 0 {
+		rew.Header().Set(`Content-Length`, strconv.Itoa(len(content)))
+		rew.WriteHeader(http.StatusOK)
+		_, _ = rew.Write([]byte(content[:cut]))
+		rew.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	http.ServeContent(rew, req, ``, time.Time{}, strings.NewReader(content))
+}
+
+func (self *downloadServer) lastHead() http.Header {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.heads[len(self.heads)-1]
+}
+
+func readFile(t testing.TB, path string) string {
+	t.Helper()
+	out, err := os.ReadFile(path)
+	try(err)
+	return string(out)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestReq_Download(t *testing.T) {
+	srv := newDownloadServer()
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), `file.txt`)
+	tpl := gr.To(srv.URL)
+
+	size := tpl.Download(gr.Download{Path: path, Sha256: hex.EncodeToString(downloadSum(downloadContent)), Digest: true})
+	eq(t, int64(len(downloadContent)), size)
+	eq(t, downloadContent, readFile(t, path))
+	eq(t, false, fileExists(path+`.part`))
+	eq(t, false, fileExists(path+`.part.meta`))
+	eq(t, ``, srv.lastHead().Get(`Range`))
+	eq(t, gr.Head(nil), gr.Head(tpl.Header))
+
+	t.Run(`overwrite`, func(t *testing.T) {
+		srv.content = `other`
+		eq(t, int64(5), tpl.Download(gr.Download{Path: path}))
+		eq(t, `other`, readFile(t, path))
+		srv.content = downloadContent
+	})
+}
+
+func TestReq_Download_resume(t *testing.T) {
+	srv := newDownloadServer()
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), `file.txt`)
+	opt := gr.Download{Path: path, Sha256: hex.EncodeToString(downloadSum(downloadContent))}
+
+	srv.cut = 10
+	_, err := gr.To(srv.URL).DownloadCatch(opt)
+	errs(t, `[gr] failed to download to `, err)
+	eq(t, false, fileExists(path))
+	eq(t, downloadContent[:10], readFile(t, path+`.part`))
+	eq(t, `"v1"`, readFile(t, path+`.part.meta`))
+
+	eq(t, int64(len(downloadContent)), gr.To(srv.URL).Download(opt))
+	eq(t, downloadContent, readFile(t, path))
+	eq(t, `bytes=10-`, srv.lastHead().Get(`Range`))
+	eq(t, `"v1"`, srv.lastHead().Get(`If-Range`))
+	eq(t, false, fileExists(path+`.part`))
+	eq(t, false, fileExists(path+`.part.meta`))
+}
+
+func TestReq_Download_resume_changed(t *testing.T) {
+	srv := newDownloadServer()
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), `file.txt`)
+
+	srv.cut = 10
+	_, err := gr.To(srv.URL).DownloadCatch(gr.Download{Path: path})
+	errs(t, `[gr] failed to download to `, err)
+
+	srv.etag = `"v2"`
+	srv.content = `changed content`
+
+	eq(t, int64(15), gr.To(srv.URL).Download(gr.Download{Path: path, Sha256: hex.EncodeToString(downloadSum(`changed content`))}))
+	eq(t, `changed content`, readFile(t, path))
+	eq(t, `bytes=10-`, srv.lastHead().Get(`Range`))
+}
+
+func TestReq_Download_resume_complete(t *testing.T) {
+	srv := newDownloadServer()
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), `file.txt`)
+	try(os.WriteFile(path+`.part`, []byte(downloadContent), os.ModePerm))
+	try(os.WriteFile(path+`.part.meta`, []byte(`"v1"`), os.ModePerm))
+
+	eq(t, int64(len(downloadContent)), gr.To(srv.URL).Download(gr.Download{Path: path, Sha256: hex.EncodeToString(downloadSum(downloadContent))}))
+	eq(t, downloadContent, readFile(t, path))
+	eq(t, `bytes=`+strconv.Itoa(len(downloadContent))+`-`, srv.lastHead().Get(`Range`))
+	eq(t, 1, len(srv.heads))
+}
+
+func TestReq_Download_resume_unsatisfiable(t *testing.T) {
+	srv := newDownloadServer()
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), `file.txt`)
+	try(os.WriteFile(path+`.part`, []byte(downloadContent+`extra`), os.ModePerm))
+	try(os.WriteFile(path+`.part.meta`, []byte(`"v1"`), os.ModePerm))
+
+	eq(t, int64(len(downloadContent)), gr.To(srv.URL).Download(gr.Download{Path: path}))
+	eq(t, downloadContent, readFile(t, path))
+	eq(t, 2, len(srv.heads))
+	eq(t, ``, srv.lastHead().Get(`Range`))
+}
+
+func TestReq_Download_resume_without_validator(t *testing.T) {
+	srv := newDownloadServer()
+	srv.etag = ``
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), `file.txt`)
+
+	srv.cut = 10
+	_, err := gr.To(srv.URL).DownloadCatch(gr.Download{Path: path})
+	errs(t, `[gr] failed to download to `, err)
+	eq(t, false, fileExists(path+`.part.meta`))
+
+	eq(t, int64(len(downloadContent)), gr.To(srv.URL).Download(gr.Download{Path: path}))
+	eq(t, downloadContent, readFile(t, path))
+	eq(t, ``, srv.lastHead().Get(`Range`))
+}
+
+func TestReq_Download_resume_weak(t *testing.T) {
+	srv := newDownloadServer()
+	srv.etag = `W/"v1"`
+	srv.head = http.Header{`Last-Modified`: {`Tue, 02 Jan 2024 03:04:05 GMT`}}
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), `file.txt`)
+
+	srv.cut = 10
+	_, err := gr.To(srv.URL).DownloadCatch(gr.Download{Path: path})
+	errs(t, `[gr] failed to download to `, err)
+	eq(t, `Tue, 02 Jan 2024 03:04:05 GMT`, readFile(t, path+`.part.meta`))
+
+	gr.To(srv.URL).Download(gr.Download{Path: path})
+	eq(t, `Tue, 02 Jan 2024 03:04:05 GMT`, srv.lastHead().Get(`If-Range`))
+	eq(t, downloadContent, readFile(t, path))
+}
+
+func TestReq_Download_Digest(t *testing.T) {
+	srv := newDownloadServer()
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), `file.txt`)
+	valid := base64.StdEncoding.EncodeToString(downloadSum(downloadContent))
+	invalid := base64.StdEncoding.EncodeToString(downloadSum(`other`))
+
+	test := func(key, val string, exp string) {
+		t.Helper()
+		srv.head = http.Header{key: {val}}
+		_, err := gr.To(srv.URL).DownloadCatch(gr.Download{Path: path, Digest: true})
+		if exp == `` {
+			eq(t, nil, err)
+			eq(t, downloadContent, readFile(t, path))
+		} else {
+			errs(t, exp, err)
+			eq(t, false, fileExists(path+`.part`))
+		}
+		try(os.RemoveAll(path))
+	}
+
+	test(`Repr-Digest`, `sha-512=:abc:, sha-256=:`+valid+`:`, ``)
+	test(`Repr-Digest`, `sha-256=:`+invalid+`:`, `Repr-Digest mismatch`)
+	test(`Digest`, `MD5=abc, SHA-256=`+valid, ``)
+	test(`Digest`, `SHA-256=`+invalid, `Digest mismatch`)
+	test(`Content-Digest`, `sha-256=:`+valid+`:`, ``)
+	test(`Content-Digest`, `sha-256=:`+invalid+`:`, `Content-Digest mismatch`)
+	test(`Digest`, `MD5=abc`, ``)
+	test(`Digest`, `SHA-256=invalid`, ``)
+
+	t.Run(`partial content`, func(t *testing.T) {
+		// "Content-Digest" of partial responses describes only the range.
+		srv.head = http.Header{`Content-Digest`: {`sha-256=:` + invalid + `:`}}
+		try(os.WriteFile(path+`.part`, []byte(downloadContent[:10]), os.ModePerm))
+		try(os.WriteFile(path+`.part.meta`, []byte(`"v1"`), os.ModePerm))
+
+		gr.To(srv.URL).Download(gr.Download{Path: path, Digest: true})
+		eq(t, downloadContent, readFile(t, path))
+		eq(t, `bytes=10-`, srv.lastHead().Get(`Range`))
+	})
+
+	t.Run(`compressed`, func(t *testing.T) {
+		// Digests describe the content as sent, compressed or not.
+		var gzipped bytes.Buffer
+		enc := gzip.NewWriter(&gzipped)
+		_, _ = io.WriteString(enc, downloadContent)
+		try(enc.Close())
+
+		var accept string
+		srv := ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+			accept = req.Header.Get(`Accept-Encoding`)
+			body := []byte(downloadContent)
+			if strings.Contains(accept, `gzip`) {
+				body = gzipped.Bytes()
+				rew.Header().Set(`Content-Encoding`, `gzip`)
+			}
+			rew.Header().Set(`Repr-Digest`, `sha-256=:`+base64.StdEncoding.EncodeToString(downloadSum(string(body)))+`:`)
+			_, _ = rew.Write(body)
+		}))
+		defer srv.Close()
+
+		gr.To(srv.URL).Download(gr.Download{Path: path, Digest: true})
+		eq(t, downloadContent, readFile(t, path))
+		eq(t, `identity`, accept)
+		try(os.RemoveAll(path))
+	})
+
+	t.Run(`decompressed`, func(t *testing.T) {
+		trans := &Trans{Res: &S{
+			StatusCode:    http.StatusOK,
+			Header:        H{`Repr-Digest`: {`sha-256=:` + invalid + `:`}},
+			Body:          io.NopCloser(strings.NewReader(downloadContent)),
+			ContentLength: -1,
+			Uncompressed:  true,
+		}}
+
+		gr.To(`https://example.com`).Cli(&http.Client{Transport: trans}).Download(gr.Download{Path: path, Digest: true})
+		eq(t, downloadContent, readFile(t, path))
+		try(os.RemoveAll(path))
+	})
+}
+
+func TestReq_Download_errors(t *testing.T) {
+	srv := newDownloadServer()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, `file.txt`)
+
+	t.Run(`missing path`, func(t *testing.T) {
+		_, err := gr.To(srv.URL).DownloadCatch(gr.Download{})
+		errs(t, `[gr] failed to download to "": missing file path`, err)
+	})
+
+	t.Run(`SHA-256 mismatch`, func(t *testing.T) {
+		_, err := gr.To(srv.URL).DownloadCatch(gr.Download{Path: path, Sha256: hex.EncodeToString(downloadSum(`other`))})
+		errs(t, `SHA-256 mismatch: expected `+hex.EncodeToString(downloadSum(`other`)), err)
+		eq(t, false, fileExists(path))
+		eq(t, false, fileExists(path+`.part`))
+		eq(t, false, fileExists(path+`.part.meta`))
+	})
+
+	t.Run(`invalid SHA-256`, func(t *testing.T) {
+		_, err := gr.To(srv.URL).DownloadCatch(gr.Download{Path: path, Sha256: `xyz`})
+		errs(t, `invalid SHA-256 "xyz"`, err)
+	})
+
+	t.Run(`non-OK`, func(t *testing.T) {
+		_, err := gr.To(srv.URL).Path(`/missing`).DownloadCatch(gr.Download{Path: path})
+		errs(t, `(HTTP status 404)`, err)
+		eq(t, false, fileExists(path))
+	})
+
+	t.Run(`unexpected range`, func(t *testing.T) {
+		_, err := gr.To(srv.URL).HeadSet(`Range`, `bytes=5-`).DownloadCatch(gr.Download{Path: path})
+		errs(t, `unexpected content range "bytes 5-55/56" for offset 0`, err)
+		eq(t, false, fileExists(path))
+	})
+
+	t.Run(`transport`, func(t *testing.T) {
+		_, err := gr.To(`https://example.com`).Cli(&http.Client{Transport: &Trans{Err: errRead}}).DownloadCatch(gr.Download{Path: path})
+		errs(t, errRead.Error(), err)
+	})
+
+	t.Run(`directory`, func(t *testing.T) {
+		_, err := gr.To(srv.URL).DownloadCatch(gr.Download{Path: filepath.Join(dir, `missing`, `file.txt`)})
+		errs(t, `[gr] failed to download to `, err)
+	})
+}
@@ -0,0 +1,148 @@
+package gr_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/mitranim/gr"
+)
+
+func TestParseLinks(t *testing.T) {
+	test := func(exp gr.Links, src ...string) {
+		t.Helper()
+		eq(t, exp, gr.ParseLinks(src...))
+	}
+
+	test(nil)
+	test(nil, ``)
+	test(nil, ` , `)
+	test(gr.Links{{Url: `https://example.com`}}, `<https://example.com>`)
+
+	test(
+		gr.Links{{Url: `/page/2`, Rel: `next`}},
+		`</page/2>; rel="next"`,
+	)
+
+	test(
+		gr.Links{{Url: `/page/2`, Rel: `next`}},
+		`</page/2>;rel=next`,
+	)
+
+	test(
+		gr.Links{
+			{Url: `https://api.example.com/items?page=2&per_page=10`, Rel: `next`},
+			{Url: `https://api.example.com/items?page=5&per_page=10`, Rel: `last`},
+		},
+		`<https://api.example.com/items?page=2&per_page=10>; rel="next", <https://api.example.com/items?page=5&per_page=10>; rel="last"`,
+	)
+
+	test(
+		gr.Links{{Url: `/a,b`, Rel: `next`}, {Url: `/c`, Rel: `prev`}},
+		`</a,b>; rel="next"`,
+		`</c>; rel=prev`,
+	)
+
+	// Examples from RFC 8288, section 3.5.
+	test(
+		gr.Links{{Url: `http://example.com/TheBook/chapter2`, Rel: `previous`, Params: map[string]string{`title`: `previous chapter`}}},
+		`<http://example.com/TheBook/chapter2>; rel="previous"; title="previous chapter"`,
+	)
+
+	test(
+		gr.Links{{Url: `/terms`, Rel: `copyright`, Anchor: `#foo`}},
+		`</terms>; rel="copyright"; anchor="#foo"`,
+	)
+
+	test(
+		gr.Links{{Url: `/TheBook/chapter2`, Rel: `previous`, Params: map[string]string{`title*`: `UTF-8'de'letztes%20Kapitel`}}},
+		`</TheBook/chapter2>; rel="previous"; title*=UTF-8'de'letztes%20Kapitel`,
+	)
+
+	test(
+		gr.Links{{Url: `http://example.org/`, Rel: `start http://example.net/relation/other`}},
+		`<http://example.org/>; rel="start http://example.net/relation/other"`,
+	)
+
+	t.Run(`params`, func(t *testing.T) {
+		test(
+			gr.Links{{Url: `/`, Rel: `one`, Params: map[string]string{`type`: `text/html`, `title`: `a "b", c; d`, `hreflang`: ``}}},
+			`</>; REL=one; rel=two; Type=text/html; hreflang; title="a \"b\", c; d"; title=other`,
+		)
+	})
+}
+
+func TestParseLinks_malformed(t *testing.T) {
+	test := func(msg, src string) {
+		t.Helper()
+		_, err := gr.ParseLinksCatch(src)
+		errs(t, `[gr] failed to parse Link header`, err)
+		errs(t, msg, err)
+	}
+
+	test(`expected "<" at position 0`, `/page/2; rel=next`)
+	test(`unclosed "<" at position 0`, `</page/2; rel=next`)
+	test(`expected ";" or "," at position 10`, `</page/2> rel=next`)
+	test(`expected parameter name at position 11`, `</page/2>; =next`)
+	test(`unclosed quoted string`, `</page/2>; rel="next`)
+}
+
+func TestLink_HasRel(t *testing.T) {
+	link := gr.Link{Rel: `start  Next`}
+
+	eq(t, true, link.HasRel(`start`))
+	eq(t, true, link.HasRel(`next`))
+	eq(t, true, link.HasRel(`NEXT`))
+	eq(t, false, link.HasRel(`prev`))
+	eq(t, false, link.HasRel(``))
+	eq(t, false, gr.Link{}.HasRel(`next`))
+}
+
+func TestLinks_Rel(t *testing.T) {
+	links := gr.Links{
+		{Url: `/one`, Rel: `prev`},
+		{Url: `/two`, Rel: `next`},
+		{Url: `/three`, Rel: `next last`},
+	}
+
+	eq(t, gr.Link{Url: `/one`, Rel: `prev`}, links.Rel(`prev`))
+	eq(t, gr.Link{Url: `/two`, Rel: `next`}, links.Rel(`next`))
+	eq(t, gr.Link{Url: `/three`, Rel: `next last`}, links.Rel(`last`))
+	eq(t, gr.Link{}, links.Rel(`first`))
+	eq(t, gr.Link{}, gr.Links(nil).Rel(`next`))
+}
+
+func TestHead_Links(t *testing.T) {
+	eq(t, gr.Links(nil), gr.Head(nil).Links())
+
+	eq(
+		t,
+		gr.Links{{Url: `/one`, Rel: `next`}, {Url: `/two`, Rel: `last`}},
+		gr.Head{`Link`: {`</one>; rel=next`, `</two>; rel=last`}}.Links(),
+	)
+
+	_, err := gr.Head{`Link`: {`/one`}}.LinksCatch()
+	errs(t, `expected "<"`, err)
+}
+
+func TestRes_LinkUrl(t *testing.T) {
+	res := &gr.Res{
+		Header:  H{`Link`: {`<?page=2>; rel="next", <https://other.com/last>; rel="last"`}},
+		Request: &Q{URL: &url.URL{Scheme: `https`, Host: `example.com`, Path: `/items`, RawQuery: `page=1`}},
+	}
+
+	eq(t, gr.Links{{Url: `?page=2`, Rel: `next`}, {Url: `https://other.com/last`, Rel: `last`}}, res.Links())
+	eq(t, `https://example.com/items?page=2`, res.LinkUrl(`next`).String())
+	eq(t, `https://other.com/last`, res.LinkUrl(`last`).String())
+	eq(t, (*url.URL)(nil), res.LinkUrl(`prev`))
+
+	res.Request = nil
+	eq(t, `?page=2`, res.LinkUrl(`next`).String())
+
+	res.Header = H{`Link`: {`<%zz>; rel=next`}}
+	_, err := res.LinkUrlCatch(`next`)
+	errs(t, `[gr] failed to parse link URL "%zz"`, err)
+
+	res.Header = H{`Link`: {`%zz`}}
+	_, err = res.LinksCatch()
+	errs(t, `expected "<"`, err)
+}
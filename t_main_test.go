@@ -186,8 +186,13 @@ var (
 	errRead   = fmt.Errorf(`unexpected read`)
 	errClose  = fmt.Errorf(`unexpected close`)
 	errDecode = fmt.Errorf(`failing to decode`)
+	errWrite  = fmt.Errorf(`unexpected write`)
 )
 
+type FailWriter struct{}
+
+func (FailWriter) Write([]byte) (int, error) { return 0, errWrite }
+
 type FailReadCloser struct{}
 
 func (FailReadCloser) Read([]byte) (int, error) { return 0, errRead }
@@ -21,6 +21,18 @@ func TestTypeJsonUtf8(t *testing.T) {
 	eq(t, `application/x-www-form-urlencoded; charset=utf-8`, gr.TypeFormUtf8)
 }
 
+func TestTypeJsonSeq(t *testing.T) {
+	eq(t, `application/json-seq`, gr.TypeJsonSeq)
+}
+
+func TestTypeNdjson(t *testing.T) {
+	eq(t, `application/x-ndjson`, gr.TypeNdjson)
+}
+
+func TestTypeProblem(t *testing.T) {
+	eq(t, `application/problem+json`, gr.TypeProblem)
+}
+
 func TestTypeForm(t *testing.T) {
 	eq(t, `application/json`, gr.TypeJson)
 }
@@ -37,6 +49,26 @@ func TestTypeMultiUtf8(t *testing.T) {
 	eq(t, `multipart/form-data; charset=utf-8`, gr.TypeMultiUtf8)
 }
 
+func TestTypeMultiMixed(t *testing.T) {
+	eq(t, `multipart/mixed`, gr.TypeMultiMixed)
+}
+
+func TestTypeMultiRange(t *testing.T) {
+	eq(t, `multipart/byteranges`, gr.TypeMultiRange)
+}
+
+func TestTypeOctetStream(t *testing.T) {
+	eq(t, `application/octet-stream`, gr.TypeOctetStream)
+}
+
+func TestTypeHttp(t *testing.T) {
+	eq(t, `application/http`, gr.TypeHttp)
+}
+
+func TestTypeEventStream(t *testing.T) {
+	eq(t, `text/event-stream`, gr.TypeEventStream)
+}
+
 func TestIsReadOnly(t *testing.T) {
 	test := func(exp bool, val string) {
 		t.Helper()
@@ -71,6 +103,24 @@ func TestIsRedir(t *testing.T)     { testIsRedir(t, gr.IsRedir) }
 func TestIsClientErr(t *testing.T) { testIsClientErr(t, gr.IsClientErr) }
 func TestIsServerErr(t *testing.T) { testIsServerErr(t, gr.IsServerErr) }
 
+func TestIsRetryable(t *testing.T) {
+	test := codeTest(t, gr.IsRetryable)
+
+	test(false, 0)
+	test(false, 200)
+	test(false, 400)
+	test(false, 404)
+	test(true, 408)
+	test(true, 425)
+	test(true, 429)
+	test(false, 500)
+	test(false, 501)
+	test(true, 502)
+	test(true, 503)
+	test(true, 504)
+	test(false, 505)
+}
+
 func testIsInfo(t testing.TB, fun func(int) bool) {
 	test := codeTest(t, fun)
 
@@ -0,0 +1,222 @@
+package gr_test
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	ht "net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mitranim/gr"
+)
+
+const multiBound = `f5ff0ca9b8f1b3bb`
+
+type MultiPart struct {
+	Head H
+	Body string
+}
+
+func readMulti(t testing.TB, typ string, body io.Reader) (out []MultiPart) {
+	t.Helper()
+
+	media, par, err := mime.ParseMediaType(typ)
+	try(err)
+	eq(t, gr.TypeMulti, media)
+
+	read := multipart.NewReader(body, par[`boundary`])
+	for {
+		part, err := read.NextRawPart()
+		if err == io.EOF {
+			return
+		}
+		try(err)
+		out = append(out, MultiPart{H(part.Header), readStr(part)})
+	}
+}
+
+func TestMulti_Boundary(t *testing.T) {
+	multi := new(gr.Multi)
+	bound := multi.Boundary()
+	eq(t, true, len(bound) > 0)
+	eq(t, bound, multi.Boundary())
+
+	eq(t, multiBound, new(gr.Multi).SetBoundary(multiBound).Boundary())
+
+	panics(t, `[gr] failed to set multipart boundary ""`, func() {
+		new(gr.Multi).SetBoundary(``)
+	})
+
+	panics(t, `[gr] failed to set multipart boundary "one\ntwo"`, func() {
+		new(gr.Multi).SetBoundary("one\ntwo")
+	})
+}
+
+func TestMulti_Type(t *testing.T) {
+	eq(
+		t,
+		`multipart/form-data; boundary=`+multiBound,
+		new(gr.Multi).SetBoundary(multiBound).Type(),
+	)
+}
+
+func TestMulti_Reader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, `file.json`)
+	try(os.WriteFile(path, []byte(`{"one":"two"}`), os.ModePerm))
+
+	multi := new(gr.Multi).
+		SetBoundary(multiBound).
+		Field(`one`, `two`).
+		Field(`quo"te`, ``).
+		File(`three`, path).
+		FileReader(`four`, `four.bin`, strings.NewReader(`five`)).
+		Part(H{`content-id`: {`six`}}, nil)
+
+	exp := []MultiPart{
+		{H{`Content-Disposition`: {`form-data; name="one"`}}, `two`},
+		{H{`Content-Disposition`: {`form-data; name="quo\"te"`}}, ``},
+		{
+			H{
+				`Content-Disposition`: {`form-data; name="three"; filename="file.json"`},
+				gr.Type:               {gr.TypeJson},
+			},
+			`{"one":"two"}`,
+		},
+		{
+			H{
+				`Content-Disposition`: {`form-data; name="four"; filename="four.bin"`},
+				gr.Type:               {gr.TypeOctetStream},
+			},
+			`five`,
+		},
+		{H{`Content-Id`: {`six`}}, ``},
+	}
+
+	eq(t, true, multi.IsReplayable())
+	eq(t, exp, readMulti(t, multi.Type(), multi.Reader()))
+	eq(t, exp, readMulti(t, multi.Type(), multi.Reader()))
+
+	var buf bytes.Buffer
+	size, err := multi.WriteTo(&buf)
+	try(err)
+
+	eq(t, int64(buf.Len()), size)
+	eq(t, size, multi.Len())
+	eq(t, buf.String(), readStr(multi.Reader()))
+}
+
+func TestMulti_Len(t *testing.T) {
+	eq(t, int64(len("\r\n--"+multiBound+"--\r\n")), new(gr.Multi).SetBoundary(multiBound).Len())
+
+	t.Run(`unknown size`, func(t *testing.T) {
+		multi := new(gr.Multi).
+			Field(`one`, `two`).
+			Part(nil, io.MultiReader(strings.NewReader(`three`)))
+
+		eq(t, int64(-1), multi.Len())
+		eq(t, false, multi.IsReplayable())
+	})
+}
+
+func TestMulti_Reader_error(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, `file.txt`)
+	try(os.WriteFile(path, []byte(`hello world`), os.ModePerm))
+
+	multi := new(gr.Multi).File(`one`, path)
+	try(os.Remove(path))
+
+	_, err := io.ReadAll(multi.Reader())
+	errs(t, `[gr] failed to write multipart body`, err)
+
+	panics(t, `[gr] failed to add multipart file`, func() {
+		new(gr.Multi).File(`one`, path)
+	})
+}
+
+func TestReq_Multi(t *testing.T) {
+	t.Run(`nil`, func(t *testing.T) {
+		eq(t, new(gr.Req), new(gr.Req).Multi(nil))
+		eq(t, (&gr.Req{Header: H{}}), new(gr.Req).TypeMulti().String(`one`).Multi(nil))
+	})
+
+	t.Run(`replayable`, func(t *testing.T) {
+		multi := new(gr.Multi).SetBoundary(multiBound).Field(`one`, `two`)
+		req := new(gr.Req).Post().Multi(multi)
+
+		eq(t, H{gr.Type: {multi.Type()}}, req.Header)
+		eq(t, multi.Len(), req.ContentLength)
+		eq(t, true, req.GetBody != nil)
+
+		exp := []MultiPart{{H{`Content-Disposition`: {`form-data; name="one"`}}, `two`}}
+		eq(t, exp, readMulti(t, multi.Type(), req.Body))
+		eq(t, exp, readMulti(t, multi.Type(), req.CloneBody()))
+	})
+
+	t.Run(`non-replayable`, func(t *testing.T) {
+		multi := new(gr.Multi).Part(nil, io.MultiReader(strings.NewReader(`one`)))
+		req := new(gr.Req).Post().Multi(multi)
+
+		eq(t, int64(-1), req.ContentLength)
+		eq(t, true, req.GetBody == nil)
+	})
+
+	t.Run(`lazy`, func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, `file.txt`)
+		try(os.WriteFile(path, []byte(`hello world`), os.ModePerm))
+
+		multi := new(gr.Multi).SetBoundary(multiBound).File(`one`, path)
+		before := runtime.NumGoroutine()
+
+		// Requests which are built but never sent must not leak goroutines.
+		for range iter(64) {
+			new(gr.Req).Post().Multi(multi).Multi(multi).Bytes(nil)
+		}
+		is(t, true, runtime.NumGoroutine() < before+64)
+
+		req := new(gr.Req).Post().Multi(multi)
+		try(req.Body.Close())
+
+		exp := []MultiPart{{
+			H{
+				`Content-Disposition`: {`form-data; name="one"; filename="file.txt"`},
+				`Content-Type`:        {`text/plain; charset=utf-8`},
+			},
+			`hello world`,
+		}}
+		eq(t, exp, readMulti(t, multi.Type(), req.CloneBody()))
+	})
+
+	t.Run(`server`, func(t *testing.T) {
+		var parts []MultiPart
+
+		srv := ht.NewServer(http.HandlerFunc(func(_ W, req *Q) {
+			eq(t, int64(-1), req.ContentLength)
+			parts = readMulti(t, req.Header.Get(gr.Type), req.Body)
+		}))
+		defer srv.Close()
+
+		gr.To(srv.URL).Post().Multi(
+			new(gr.Multi).
+				Field(`one`, `two`).
+				Part(nil, io.MultiReader(strings.NewReader(`three`))),
+		).Res().Ok().Done()
+
+		eq(
+			t,
+			[]MultiPart{
+				{H{`Content-Disposition`: {`form-data; name="one"`}}, `two`},
+				{H{}, `three`},
+			},
+			parts,
+		)
+	})
+}
@@ -0,0 +1,214 @@
+package gr_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	ht "net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mitranim/gr"
+)
+
+type Record struct {
+	One string `json:"one,omitempty"`
+	Two int    `json:"two,omitempty"`
+}
+
+func readRecords(t testing.TB, lines *gr.JsonLines) (out []Record) {
+	t.Helper()
+	defer lines.Done()
+
+	for {
+		var val Record
+		if !lines.Next(&val) {
+			return
+		}
+		out = append(out, val)
+	}
+}
+
+func TestRes_JsonLines(t *testing.T) {
+	test := func(exp []Record, src string) {
+		t.Helper()
+		res := &gr.Res{Body: gr.NewStringReadCloser(src)}
+		eq(t, exp, readRecords(t, res.JsonLines()))
+	}
+
+	test(nil, ``)
+	test(nil, "\n\n")
+	test([]Record{{One: `one`}}, `{"one":"one"}`)
+	test([]Record{{One: `one`}, {Two: 2}}, "{\"one\":\"one\"}\n{\"two\":2}\n")
+	test([]Record{{One: `one`}, {Two: 2}}, "{\"one\":\"one\"}\r\n\r\n{\"two\":2}")
+	test([]Record{{One: `one`}, {Two: 2}}, "\x1e{\"one\":\"one\"}\n\x1e{\"two\":2}\n")
+
+	t.Run(`fresh values`, func(t *testing.T) {
+		lines := (&gr.Res{Body: gr.NewStringReadCloser("{\"one\":\"one\"}\n{\"two\":2}\n")}).JsonLines()
+		defer lines.Done()
+
+		var val Record
+		eq(t, true, lines.Next(&val))
+		eq(t, Record{One: `one`}, val)
+		eq(t, true, lines.Next(&val))
+		eq(t, Record{Two: 2}, val)
+		eq(t, false, lines.Next(&val))
+	})
+
+	t.Run(`closing`, func(t *testing.T) {
+		body := NewReaderCloseFlag(`{"one":"one"}`)
+		lines := (&gr.Res{Body: body}).JsonLines()
+
+		eq(t, true, lines.Next(new(Record)))
+		eq(t, false, body.DidClose)
+		eq(t, false, lines.Next(new(Record)))
+		eq(t, true, body.DidClose)
+	})
+
+	t.Run(`nil body`, func(t *testing.T) {
+		eq(t, false, new(gr.Res).JsonLines().Next(new(Record)))
+	})
+
+	t.Run(`decoding error`, func(t *testing.T) {
+		body := NewReaderCloseFlag("{\"one\":\"one\"}\n{\"two\":\"three\"}")
+		lines := (&gr.Res{Body: body}).JsonLines()
+
+		ok, err := lines.NextCatch(new(Record))
+		eq(t, true, ok)
+		eq(t, nil, err)
+
+		ok, err = lines.NextCatch(new(Record))
+		eq(t, false, ok)
+		errs(t, `[gr] failed to JSON-decode response record`, err)
+		eq(t, true, body.DidClose)
+	})
+
+	t.Run(`invalid output`, func(t *testing.T) {
+		lines := (&gr.Res{Body: gr.NewStringReadCloser(`{}`)}).JsonLines()
+		_, err := lines.NextCatch(Record{})
+		errs(t, `expected non-nil pointer, got gr_test.Record`, err)
+	})
+
+	t.Run(`context`, func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+
+		srv := ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+			fmt.Fprintln(rew, `{"one":"one"}`)
+			rew.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-req.Context().Done():
+			}
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		lines := gr.To(srv.URL).Ctx(ctx).Res().Ok().JsonLines()
+		defer lines.Done()
+
+		var val Record
+		eq(t, true, lines.Next(&val))
+		eq(t, Record{One: `one`}, val)
+
+		time.AfterFunc(time.Millisecond*10, cancel)
+
+		ok, err := lines.NextCatch(&val)
+		eq(t, false, ok)
+		eq(t, nil, err)
+	})
+}
+
+func TestReq_JsonLinesFunc(t *testing.T) {
+	t.Run(`nil`, func(t *testing.T) {
+		eq(t, (&gr.Req{Header: H{gr.Type: {gr.TypeNdjson}}}), new(gr.Req).JsonLinesFunc(nil))
+	})
+
+	fun := func(emit func(interface{}) error) error {
+		for _, val := range []Record{{One: `one`}, {Two: 2}} {
+			err := emit(val)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	req := new(gr.Req).Post().JsonLinesFunc(fun)
+	eq(t, H{gr.Type: {gr.TypeNdjson}}, req.Header)
+	eq(t, int64(-1), req.ContentLength)
+
+	const exp = "{\"one\":\"one\"}\n{\"two\":2}\n"
+	eq(t, exp, readStr(req.CloneBody()))
+	eq(t, exp, readStr(req.Body))
+	eq(t, exp, readStr(req.CloneBody()))
+
+	t.Run(`error`, func(t *testing.T) {
+		req := new(gr.Req).JsonLinesFunc(func(emit func(interface{}) error) error {
+			return emit(func() {})
+		})
+		_, err := io.ReadAll(req.Body)
+		errs(t, `unsupported type: func()`, err)
+	})
+
+	t.Run(`closing`, func(t *testing.T) {
+		stopped := make(chan error, 1)
+
+		req := new(gr.Req).JsonLinesFunc(func(emit func(interface{}) error) error {
+			for {
+				err := emit(Record{})
+				if err != nil {
+					stopped <- err
+					return err
+				}
+			}
+		})
+
+		_, _ = req.Body.Read(make([]byte, 1))
+		try(req.Body.Close())
+		try(req.Body.Close())
+		eq(t, io.ErrClosedPipe, <-stopped)
+	})
+
+	t.Run(`server`, func(t *testing.T) {
+		res := gr.To(testServer.URL).Post().JsonLinesFunc(fun).Res().Ok()
+		eq(t, true, res.ReadString() != ``)
+	})
+}
+
+func TestReq_JsonLinesChan(t *testing.T) {
+	panics(t, `[gr] failed to stream request records: expected receivable channel, got int`, func() {
+		new(gr.Req).JsonLinesChan(10)
+	})
+
+	panics(t, `expected receivable channel, got chan<- int`, func() {
+		new(gr.Req).JsonLinesChan(make(chan<- int))
+	})
+
+	src := make(chan Record, 2)
+	src <- Record{One: `one`}
+	src <- Record{Two: 2}
+	close(src)
+
+	req := new(gr.Req).Post().JsonLinesChan((<-chan Record)(src))
+	eq(t, H{gr.Type: {gr.TypeNdjson}}, req.Header)
+	eq(t, int64(-1), req.ContentLength)
+	eq(t, true, req.GetBody == nil)
+	eq(t, "{\"one\":\"one\"}\n{\"two\":2}\n", readStr(req.Body))
+
+	t.Run(`closing stops receiving`, func(t *testing.T) {
+		src := make(chan Record)
+		req := new(gr.Req).JsonLinesChan(src)
+
+		go func() { src <- Record{One: `one`} }()
+		buf := make([]byte, 14)
+		_, err := io.ReadFull(req.Body, buf)
+		try(err)
+		eq(t, "{\"one\":\"one\"}\n", string(buf))
+
+		try(req.Body.Close())
+		_, err = req.Body.Read(buf)
+		eq(t, io.ErrClosedPipe, err)
+	})
+}
@@ -0,0 +1,290 @@
+package gr_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	ht "net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mitranim/gr"
+)
+
+/*
+Serves a token endpoint at "/token", issuing "token-N" and "refresh-N", and a
+protected resource at any other path, which accepts only issued and unrevoked
+tokens, echoing the request body. If `.deny` is true, rejects all tokens.
+*/
+type oauthServer struct {
+	*ht.Server
+	sync.Mutex
+	expires int
+	delay   time.Duration
+	fail    bool
+	deny    bool
+	issued  map[string]bool
+	grants  []V
+	auths   []string
+	hits    int
+}
+
+func newOauthServer() *oauthServer {
+	out := &oauthServer{expires: 3600, issued: map[string]bool{}}
+	out.Server = ht.NewServer(http.HandlerFunc(out.serve))
+	return out
+}
+
+func (self *oauthServer) serve(rew W, req *Q) {
+	if req.URL.Path == `/token` {
+		self.token(rew, req)
+		return
+	}
+
+	self.Lock()
+	self.hits++
+	ok := !self.deny && self.issued[req.Header.Get(`Authorization`)]
+	self.Unlock()
+
+	if !ok {
+		rew.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_, _ = io.WriteString(rew, `ok: `+readStr(req.Body))
+}
+
+func (self *oauthServer) token(rew W, req *Q) {
+	try(req.ParseForm())
+	time.Sleep(self.delay)
+
+	self.Lock()
+	defer self.Unlock()
+
+	self.grants = append(self.grants, req.PostForm)
+	self.auths = append(self.auths, req.Header.Get(`Authorization`))
+	rew.Header().Set(`Content-Type`, gr.TypeJson)
+
+	if self.fail {
+		rew.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(rew, `{"error":"invalid_client"}`)
+		return
+	}
+
+	num := strconv.Itoa(len(self.grants))
+	self.issued[`Bearer token-`+num] = true
+
+	try(json.NewEncoder(rew).Encode(gr.OAuth2Token{
+		AccessToken:  `token-` + num,
+		TokenType:    `Bearer`,
+		ExpiresIn:    int64(self.expires),
+		RefreshToken: `refresh-` + num,
+	}))
+}
+
+func (self *oauthServer) revoke(token string) {
+	self.Lock()
+	defer self.Unlock()
+	delete(self.issued, `Bearer `+token)
+}
+
+func (self *oauthServer) Grants() []V {
+	self.Lock()
+	defer self.Unlock()
+	return append([]V(nil), self.grants...)
+}
+
+func (self *oauthServer) Auths() []string {
+	self.Lock()
+	defer self.Unlock()
+	return append([]string(nil), self.auths...)
+}
+
+func (self *oauthServer) Hits() int {
+	self.Lock()
+	defer self.Unlock()
+	return self.hits
+}
+
+func (self *oauthServer) Auth() *gr.OAuth2 {
+	return &gr.OAuth2{
+		Url:          self.URL + `/token`,
+		ClientId:     `client`,
+		ClientSecret: `secret`,
+		Scopes:       []string{`read`, `write`},
+	}
+}
+
+func oauthGet(t testing.TB, trans http.RoundTripper, url string) string {
+	t.Helper()
+	return gr.To(url).Cli(&http.Client{Transport: trans}).Res().Ok().ReadString()
+}
+
+func TestOAuth2_client_credentials(t *testing.T) {
+	srv := newOauthServer()
+	defer srv.Close()
+
+	auth := srv.Auth()
+	auth.Params = V{`audience`: {`api`}}
+
+	eq(t, `ok: `, oauthGet(t, auth, srv.URL))
+	eq(t, `ok: `, oauthGet(t, auth, srv.URL))
+	eq(t, `ok: `, oauthGet(t, auth.Mid(nil), srv.URL))
+
+	eq(t, []V{{
+		`grant_type`: {`client_credentials`},
+		`scope`:      {`read write`},
+		`audience`:   {`api`},
+	}}, srv.Grants())
+	eq(t, []string{`Basic Y2xpZW50OnNlY3JldA==`}, srv.Auths())
+
+	tok := auth.Token(context.Background())
+	eq(t, `token-1`, tok.AccessToken)
+	eq(t, `refresh-1`, tok.RefreshToken)
+	is(t, true, tok.Expiry.After(time.Now().Add(time.Minute*59)))
+}
+
+func TestOAuth2_form(t *testing.T) {
+	srv := newOauthServer()
+	defer srv.Close()
+
+	auth := srv.Auth()
+	auth.Form = true
+	auth.Scopes = nil
+
+	eq(t, `ok: `, oauthGet(t, auth, srv.URL))
+
+	eq(t, []V{{
+		`grant_type`:    {`client_credentials`},
+		`client_id`:     {`client`},
+		`client_secret`: {`secret`},
+	}}, srv.Grants())
+	eq(t, []string{``}, srv.Auths())
+}
+
+func TestOAuth2_refresh_token(t *testing.T) {
+	srv := newOauthServer()
+	defer srv.Close()
+
+	// Shorter than the leeway, forcing a refresh for each request.
+	srv.expires = 5
+
+	auth := srv.Auth()
+	auth.RefreshToken = `refresh-0`
+	auth.Scopes = nil
+
+	eq(t, `ok: `, oauthGet(t, auth, srv.URL))
+	eq(t, `ok: `, oauthGet(t, auth, srv.URL))
+
+	eq(t, []V{
+		{`grant_type`: {`refresh_token`}, `refresh_token`: {`refresh-0`}},
+		{`grant_type`: {`refresh_token`}, `refresh_token`: {`refresh-1`}},
+	}, srv.Grants())
+
+	auth.Leeway = time.Second
+	eq(t, `token-2`, auth.Token(context.Background()).AccessToken)
+	eq(t, 2, len(srv.Grants()))
+}
+
+func TestOAuth2_retry_unauthorized(t *testing.T) {
+	srv := newOauthServer()
+	defer srv.Close()
+
+	auth := srv.Auth()
+	cli := &http.Client{Transport: auth}
+
+	eq(t, `ok: one`, gr.To(srv.URL).Cli(cli).Post().String(`one`).Res().Ok().ReadString())
+	eq(t, 1, srv.Hits())
+
+	srv.revoke(`token-1`)
+
+	eq(t, `ok: two`, gr.To(srv.URL).Cli(cli).Post().String(`two`).Res().Ok().ReadString())
+	eq(t, 3, srv.Hits())
+	eq(t, 2, len(srv.Grants()))
+	eq(t, `token-2`, auth.Token(context.Background()).AccessToken)
+
+	t.Run(`only_once`, func(t *testing.T) {
+		srv.Lock()
+		srv.deny = true
+		srv.Unlock()
+
+		res := gr.To(srv.URL).Cli(cli).Post().String(`three`).Res().Done()
+		eq(t, http.StatusUnauthorized, res.StatusCode)
+		eq(t, 5, srv.Hits())
+		eq(t, 3, len(srv.Grants()))
+	})
+
+	t.Run(`not_replayable`, func(t *testing.T) {
+		res := gr.To(srv.URL).Cli(cli).Post().Reader(NewReaderCloseFlag(`four`)).Res().Done()
+		eq(t, http.StatusUnauthorized, res.StatusCode)
+		eq(t, 6, srv.Hits())
+		eq(t, 3, len(srv.Grants()))
+	})
+}
+
+func TestOAuth2_concurrent(t *testing.T) {
+	srv := newOauthServer()
+	defer srv.Close()
+	srv.delay = time.Millisecond * 20
+
+	auth := srv.Auth()
+	var group sync.WaitGroup
+
+	for range iter(16) {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			eq(t, `ok: `, oauthGet(t, auth, srv.URL))
+		}()
+	}
+	group.Wait()
+
+	eq(t, 1, len(srv.Grants()))
+	eq(t, 16, srv.Hits())
+}
+
+func TestOAuth2_error(t *testing.T) {
+	srv := newOauthServer()
+	defer srv.Close()
+	srv.fail = true
+
+	auth := srv.Auth()
+	body := NewReaderCloseFlag(`body`)
+
+	_, err := gr.To(srv.URL).Cli(&http.Client{Transport: auth}).Post().ReadCloser(body).ResCatch()
+	errs(t, `[gr] failed to obtain OAuth2 token: [gr] error (HTTP status 400)`, err)
+	errs(t, `invalid_client`, err)
+	eq(t, true, body.DidClose)
+	eq(t, 0, srv.Hits())
+
+	_, err = auth.TokenCatch(context.Background())
+	errs(t, `[gr] failed to obtain OAuth2 token`, err)
+
+	panics(t, `[gr] failed to obtain OAuth2 token`, func() { auth.Token(context.Background()) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = auth.TokenCatch(ctx)
+	errs(t, `context canceled`, err)
+}
+
+func TestOAuth2_Cred(t *testing.T) {
+	srv := newOauthServer()
+	defer srv.Close()
+
+	cli := new(gr.Cli).Auth(srv.Auth())
+	eq(t, `ok: `, cli.Req().To(srv.URL).Res().Ok().ReadString())
+	eq(t, `ok: `, cli.Req().To(srv.URL).Res().Ok().ReadString())
+	eq(t, 1, len(srv.Grants()))
+}
+
+func TestOAuth2Token_IsValid(t *testing.T) {
+	eq(t, false, gr.OAuth2Token{}.IsValid(0))
+	eq(t, true, gr.OAuth2Token{AccessToken: `one`}.IsValid(time.Hour))
+
+	tok := gr.OAuth2Token{AccessToken: `one`, Expiry: time.Now().Add(time.Minute)}
+	eq(t, true, tok.IsValid(time.Second))
+	eq(t, false, tok.IsValid(time.Minute*2))
+}
@@ -0,0 +1,415 @@
+package gr_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	ht "net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mitranim/gr"
+)
+
+// Serves `count` pages of two items each, linking to the next page.
+func pageServer(count int) *ht.Server {
+	return ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+		page, _ := strconv.Atoi(req.URL.Query().Get(`page`))
+		if page < 1 || page > count {
+			rew.WriteHeader(http.StatusNotFound)
+			_, _ = rew.Write([]byte(`page not found`))
+			return
+		}
+
+		if page < count {
+			rew.Header().Set(`Link`, fmt.Sprintf(`<?page=%v&tag=%v>; rel="next", <?page=%v>; rel="last"`, page+1, req.URL.Query().Get(`tag`), count))
+		}
+		rew.Header().Set(`X-Page`, strconv.Itoa(page))
+		rew.Header().Set(`Content-Type`, gr.TypeJson)
+		_, _ = fmt.Fprintf(rew, `[%v, %v]`, page*10+1, page*10+2)
+	}))
+}
+
+func readPages(t testing.TB, pages *gr.Pages) (out [][]int) {
+	t.Helper()
+	for {
+		var page []int
+		if !pages.Next(&page) {
+			return
+		}
+		out = append(out, page)
+	}
+}
+
+func TestReq_Pages(t *testing.T) {
+	srv := pageServer(3)
+	defer srv.Close()
+
+	tpl := gr.To(srv.URL).Path(`/items`).RawQuery(`page=1&tag=one`).HeadSet(`X-Test`, `test`)
+	pages := tpl.Pages()
+
+	eq(t, [][]int{{11, 12}, {21, 22}, {31, 32}}, readPages(t, pages))
+	eq(t, 3, pages.Count())
+	eq(t, `3`, pages.Res.Header.Get(`X-Page`))
+	eq(t, `page=3&tag=one`, pages.Res.Request.URL.RawQuery)
+	eq(t, `test`, pages.Res.Request.Header.Get(`X-Test`))
+	eq(t, false, pages.Next(new([]int)))
+	eq(t, 3, pages.Count())
+
+	// The template is unchanged.
+	eq(t, `page=1&tag=one`, tpl.URL.RawQuery)
+
+	t.Run(`nil output`, func(t *testing.T) {
+		pages := tpl.Pages()
+		eq(t, true, pages.Next(nil))
+		eq(t, true, pages.Next(nil))
+		eq(t, true, pages.Next(nil))
+		eq(t, false, pages.Next(nil))
+	})
+
+	t.Run(`nil`, func(t *testing.T) {
+		eq(t, false, (*gr.Pages)(nil).Next(nil))
+		eq(t, 0, (*gr.Pages)(nil).Count())
+		eq(t, false, new(gr.Pages).Next(nil))
+	})
+}
+
+func TestPages_Limit(t *testing.T) {
+	srv := pageServer(5)
+	defer srv.Close()
+
+	pages := gr.To(srv.URL).RawQuery(`page=1`).Pages()
+	pages.Limit = 2
+
+	eq(t, [][]int{{11, 12}, {21, 22}}, readPages(t, pages))
+	eq(t, 2, pages.Count())
+}
+
+func TestPages_ctx(t *testing.T) {
+	srv := pageServer(5)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pages := gr.Ctx(ctx).To(srv.URL).RawQuery(`page=1`).Pages()
+
+	var page []int
+	eq(t, true, pages.Next(&page))
+	eq(t, []int{11, 12}, page)
+
+	cancel()
+	eq(t, false, pages.Next(&page))
+	eq(t, false, pages.Next(&page))
+	eq(t, 1, pages.Count())
+}
+
+func TestPages_errors(t *testing.T) {
+	srv := pageServer(2)
+	defer srv.Close()
+
+	t.Run(`non-OK`, func(t *testing.T) {
+		pages := gr.To(srv.URL).RawQuery(`page=3`).Pages()
+
+		ok, err := pages.NextCatch(new([]int))
+		eq(t, false, ok)
+		errs(t, `[gr] error (HTTP status 404)`, err)
+		errs(t, `page not found`, err)
+		eq(t, false, pages.Next(new([]int)))
+	})
+
+	t.Run(`decoding`, func(t *testing.T) {
+		pages := gr.To(srv.URL).RawQuery(`page=1`).Pages()
+
+		ok, err := pages.NextCatch(new(string))
+		eq(t, false, ok)
+		errs(t, `[gr] failed to JSON-decode response body`, err)
+	})
+
+	t.Run(`transport`, func(t *testing.T) {
+		pages := gr.To(`https://example.com`).Cli(&http.Client{Transport: &Trans{Err: errRead}}).Pages()
+
+		ok, err := pages.NextCatch(nil)
+		eq(t, false, ok)
+		errs(t, errRead.Error(), err)
+		eq(t, false, pages.Next(nil))
+	})
+}
+
+// Serves `count` items in a JSON envelope, paginated by cursor or offset.
+func itemServer(count int, conc *int32) *ht.Server {
+	var active int32
+	return ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+		if conc != nil {
+			cur := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				prev := atomic.LoadInt32(conc)
+				if cur <= prev || atomic.CompareAndSwapInt32(conc, prev, cur) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+
+		query := req.URL.Query()
+		limit, _ := strconv.Atoi(query.Get(`limit`))
+		if limit <= 0 {
+			limit = 2
+		}
+
+		offset, _ := strconv.Atoi(query.Get(`offset`))
+		if query.Has(`cursor`) {
+			offset, _ = strconv.Atoi(query.Get(`cursor`))
+		}
+
+		items := []int{}
+		for ind := offset; ind < offset+limit && ind < count; ind++ {
+			items = append(items, ind)
+		}
+
+		var next interface{}
+		if offset+limit < count {
+			next = strconv.Itoa(offset + limit)
+		}
+
+		rew.Header().Set(`Content-Type`, gr.TypeJson)
+		try(json.NewEncoder(rew).Encode(map[string]interface{}{
+			`data`: items,
+			`meta`: map[string]interface{}{`next`: next},
+		}))
+	}))
+}
+
+func TestPageCursor(t *testing.T) {
+	srv := itemServer(5, nil)
+	defer srv.Close()
+
+	pages := gr.To(srv.URL).RawQuery(`tag=one`).Paginate(gr.PageCursor{Field: `meta.next`})
+	pages.Items = `data`
+
+	var out []int
+	pages.Collect(&out)
+	eq(t, []int{0, 1, 2, 3, 4}, out)
+	eq(t, 3, pages.Count())
+	eq(t, `cursor=4&tag=one`, pages.Res.Request.URL.RawQuery)
+
+	t.Run(`param`, func(t *testing.T) {
+		pages := gr.To(srv.URL).RawQuery(`offset=1`).Paginate(gr.PageCursor{Field: `meta.next`, Param: `offset`})
+		pages.Items = `data`
+
+		var out []int
+		pages.Collect(&out)
+		eq(t, []int{1, 2, 3, 4}, out)
+	})
+
+	t.Run(`cursor types`, func(t *testing.T) {
+		test := func(exp, body string) {
+			t.Helper()
+			res := &gr.Res{Body: gr.NewStringReadCloser(body)}
+			next := gr.PageCursor{Field: `next.0`}.Follow(gr.Page{Req: gr.To(`/items`), Res: res, Body: []byte(body)})
+			if exp == `` {
+				eq(t, (*gr.Req)(nil), next)
+			} else {
+				eq(t, exp, next.URL.String())
+			}
+		}
+
+		test(`/items?cursor=abc`, `{"next": ["abc"]}`)
+		test(`/items?cursor=123`, `{"next": [123]}`)
+		test(``, `{"next": [""]}`)
+		test(``, `{"next": [null]}`)
+		test(``, `{"next": [false]}`)
+		test(``, `{"next": []}`)
+		test(``, `{}`)
+		test(``, `[]`)
+		test(``, `"next"`)
+	})
+
+	t.Run(`malformed`, func(t *testing.T) {
+		panics(t, `[gr] failed to find page cursor "meta.next"`, func() {
+			gr.PageCursor{Field: `meta.next`}.Follow(gr.Page{Req: gr.To(`/`), Body: []byte(`{"meta": `)})
+		})
+	})
+}
+
+func TestPageOffset(t *testing.T) {
+	srv := itemServer(7, nil)
+	defer srv.Close()
+
+	pages := gr.To(srv.URL).Paginate(gr.PageOffset{Size: 3})
+	pages.Items = `data`
+
+	var out []int
+	pages.Collect(&out)
+	eq(t, []int{0, 1, 2, 3, 4, 5, 6}, out)
+	eq(t, 3, pages.Count())
+	eq(t, `limit=3&offset=6`, pages.Res.Request.URL.RawQuery)
+
+	t.Run(`exact multiple`, func(t *testing.T) {
+		pages := gr.To(srv.URL).Paginate(gr.PageOffset{Size: 7})
+		pages.Items = `data`
+
+		var out []int
+		pages.Collect(&out)
+		eq(t, []int{0, 1, 2, 3, 4, 5, 6}, out)
+		eq(t, 2, pages.Count())
+	})
+
+	t.Run(`custom params`, func(t *testing.T) {
+		eq(
+			t,
+			`/items?from=12&size=4&tag=one`,
+			gr.PageOffset{Offset: `from`, Limit: `size`, Size: 4, Start: 4}.PageAt(gr.To(`/items?tag=one`), 2).URL.String(),
+		)
+	})
+
+	t.Run(`invalid size`, func(t *testing.T) {
+		pages := gr.To(srv.URL).Paginate(gr.PageOffset{})
+		_, err := pages.NextCatch(nil)
+		errs(t, `[gr] failed to paginate: expected positive page size, got 0`, err)
+	})
+}
+
+func TestPages_Conc(t *testing.T) {
+	var conc int32
+	srv := itemServer(20, &conc)
+	defer srv.Close()
+
+	pages := gr.To(srv.URL).Paginate(gr.PageOffset{Size: 3})
+	pages.Items = `data`
+	pages.Conc = 3
+
+	var out []int
+	pages.Collect(&out)
+
+	exp := make([]int, 20)
+	for ind := range exp {
+		exp[ind] = ind
+	}
+	eq(t, exp, out)
+	eq(t, `limit=3&offset=18`, pages.Res.Request.URL.RawQuery)
+
+	max := atomic.LoadInt32(&conc)
+	if max < 2 || max > 3 {
+		t.Fatalf(`expected between 2 and 3 concurrent requests, got %v`, max)
+	}
+
+	t.Run(`limit`, func(t *testing.T) {
+		pages := gr.To(srv.URL).Paginate(gr.PageOffset{Size: 3})
+		pages.Items = `data`
+		pages.Conc = 4
+		pages.Limit = 2
+
+		var out []int
+		pages.Collect(&out)
+		eq(t, []int{0, 1, 2, 3, 4, 5}, out)
+		eq(t, 2, pages.Count())
+	})
+}
+
+func TestPageFunc(t *testing.T) {
+	srv := pageServer(3)
+	defer srv.Close()
+
+	var indexes []int
+	pages := gr.To(srv.URL).RawQuery(`page=1`).Paginate(gr.PageFunc(func(page gr.Page) *gr.Req {
+		indexes = append(indexes, page.Index)
+		if page.Index >= 1 {
+			return nil
+		}
+		return page.Req.Clone().RawQuery(`page=3`)
+	}))
+
+	eq(t, [][]int{{11, 12}, {31, 32}}, readPages(t, pages))
+	eq(t, []int{0, 1}, indexes)
+
+	eq(t, (*gr.Req)(nil), gr.PageFunc(nil).Follow(gr.Page{}))
+}
+
+func TestPages_NextPage(t *testing.T) {
+	srv := pageServer(2)
+	defer srv.Close()
+
+	pages := gr.To(srv.URL).RawQuery(`page=1`).Pages()
+
+	page, ok := pages.NextPage()
+	eq(t, true, ok)
+	eq(t, 0, page.Index)
+	eq(t, `[11, 12]`, string(page.Body))
+	eq(t, 2, len(page.Items))
+	eq(t, `page=1`, page.Req.URL.RawQuery)
+	is(t, pages.Res, page.Res)
+
+	page, ok = pages.NextPage()
+	eq(t, true, ok)
+	eq(t, 1, page.Index)
+	eq(t, `page=2&tag=`, page.Req.URL.RawQuery)
+
+	page, ok, err := pages.NextPageCatch()
+	eq(t, false, ok)
+	eq(t, nil, err)
+	eq(t, gr.Page{}, page)
+}
+
+func TestPages_Stream(t *testing.T) {
+	srv := itemServer(5, nil)
+	defer srv.Close()
+
+	pages := gr.To(srv.URL).Paginate(gr.PageOffset{Size: 2})
+	pages.Items = `data`
+	items := pages.Stream()
+
+	var out []int
+	for {
+		var val int
+		if !items.Next(&val) {
+			break
+		}
+		out = append(out, val)
+		eq(t, (len(out)+1)/2, pages.Count())
+	}
+	eq(t, []int{0, 1, 2, 3, 4}, out)
+	eq(t, false, items.Next(new(int)))
+	eq(t, false, (*gr.PageItems)(nil).Next(nil))
+
+	t.Run(`decoding`, func(t *testing.T) {
+		pages := gr.To(srv.URL).Paginate(gr.PageOffset{Size: 2})
+		pages.Items = `data`
+
+		_, err := pages.Stream().NextCatch(new(string))
+		errs(t, `[gr] failed to JSON-decode page item`, err)
+	})
+}
+
+func TestPages_Items(t *testing.T) {
+	srv := itemServer(3, nil)
+	defer srv.Close()
+
+	test := func(path string, exp []int, msg string) {
+		t.Helper()
+		pages := gr.To(srv.URL).Paginate(gr.PageCursor{Field: `meta.next`})
+		pages.Items = path
+
+		var out []int
+		err := pages.CollectCatch(&out)
+		eq(t, exp, out)
+		if msg == `` {
+			eq(t, nil, err)
+		} else {
+			errs(t, msg, err)
+		}
+	}
+
+	test(`data`, []int{0, 1, 2}, ``)
+	test(`missing`, nil, ``)
+	test(`meta.next`, nil, `[gr] failed to decode page items at "meta.next"`)
+	test(``, nil, `[gr] failed to decode page items at ""`)
+
+	panics(t, `expected non-nil pointer to slice, got []int`, func() {
+		gr.To(srv.URL).Pages().Collect([]int{})
+	})
+}
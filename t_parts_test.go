@@ -0,0 +1,249 @@
+package gr_test
+
+import (
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mitranim/gr"
+)
+
+func multiRes(typ, body string) (*gr.Res, *ReaderCloseFlag) {
+	flag := NewReaderCloseFlag(strings.ReplaceAll(body, "\n", "\r\n"))
+	return &gr.Res{Header: H{gr.Type: {typ}}, Body: flag}, flag
+}
+
+const partsFormBody = `--bound
+Content-Disposition: form-data; name="one"
+Content-Type: application/json
+
+{"two":"three"}
+--bound
+Content-Disposition: form-data; name="four"
+Content-Type: application/xml
+
+<string>five</string>
+--bound
+Content-Disposition: form-data; name="six"
+
+seven=eight
+--bound--
+`
+
+func TestRes_IsMultipart(t *testing.T) {
+	test := func(exp bool, typ string) {
+		t.Helper()
+		eq(t, exp, (&gr.Res{Header: H{gr.Type: {typ}}}).IsMultipart())
+	}
+
+	test(false, ``)
+	test(false, gr.TypeJson)
+	test(true, gr.TypeMulti)
+	test(true, gr.TypeMultiUtf8)
+	test(true, gr.TypeMultiMixed+`; boundary=one`)
+	test(true, gr.TypeMultiRange+`; boundary=one`)
+}
+
+func TestRes_Parts(t *testing.T) {
+	t.Run(`form-data`, func(t *testing.T) {
+		res, flag := multiRes(gr.TypeMulti+`; boundary=bound`, partsFormBody)
+		parts := res.Parts()
+		defer parts.Done()
+
+		part := parts.Next()
+		eq(t, `one`, part.FormName())
+		eq(t, gr.TypeJson, part.Head().Get(gr.Type))
+		eq(t, true, part.Res().IsJson())
+
+		var json map[string]string
+		part.Json(&json)
+		eq(t, map[string]string{`two`: `three`}, json)
+
+		part = parts.Next()
+		eq(t, `four`, part.FormName())
+
+		var str string
+		part.Xml(&str)
+		eq(t, `five`, str)
+
+		part = parts.Next()
+		eq(t, `six`, part.FormName())
+		eq(t, url.Values{`seven`: {`eight`}}, part.Form())
+
+		eq(t, false, flag.DidClose)
+		eq(t, (*gr.Part)(nil), parts.Next())
+		eq(t, true, flag.DidClose)
+		eq(t, (*gr.Part)(nil), parts.Next())
+	})
+
+	t.Run(`skipping unread parts`, func(t *testing.T) {
+		res, _ := multiRes(gr.TypeMulti+`; boundary=bound`, partsFormBody)
+		parts := res.Parts()
+		defer parts.Done()
+
+		eq(t, `one`, parts.Next().FormName())
+		eq(t, `four`, parts.Next().FormName())
+		eq(t, `seven=eight`, parts.Next().ReadString())
+	})
+
+	t.Run(`byteranges`, func(t *testing.T) {
+		res, _ := multiRes(gr.TypeMultiRange+`; boundary=bound`, `--bound
+Content-Type: text/plain
+Content-Range: bytes 0-4/20
+
+hello
+--bound
+Content-Type: text/plain
+Content-Range: bytes 15-19/20
+
+world
+--bound--
+`)
+		parts := res.Parts()
+		defer parts.Done()
+
+		part := parts.Next()
+		eq(t, gr.ContentRange{0, 4, 20}, part.Range())
+		eq(t, `hello`, part.ReadString())
+
+		part = parts.Next()
+		eq(t, gr.ContentRange{15, 19, 20}, part.Range())
+		eq(t, []byte(`world`), part.ReadBytes())
+
+		eq(t, (*gr.Part)(nil), parts.Next())
+	})
+
+	t.Run(`mixed batch`, func(t *testing.T) {
+		res, _ := multiRes(gr.TypeMultiMixed+`; boundary=bound`, `--bound
+Content-Type: application/http
+Content-ID: response-1
+
+HTTP/1.1 200 OK
+Content-Type: application/json
+Content-Length: 15
+
+{"one":"two"}
+--bound
+Content-Type: application/http
+Content-ID: response-2
+
+HTTP/1.1 404 Not Found
+Content-Length: 0
+
+
+--bound--
+`)
+		parts := res.Parts()
+		defer parts.Done()
+
+		part := parts.Next()
+		eq(t, `response-1`, part.Head().Get(`Content-Id`))
+
+		inner := part.HttpRes()
+		eq(t, 200, inner.StatusCode)
+
+		var json map[string]string
+		inner.Json(&json)
+		eq(t, map[string]string{`one`: `two`}, json)
+
+		inner = parts.Next().HttpRes()
+		eq(t, 404, inner.StatusCode)
+		eq(t, ``, inner.ReadString())
+
+		eq(t, (*gr.Part)(nil), parts.Next())
+	})
+
+	t.Run(`custom XML decoder`, func(t *testing.T) {
+		res, _ := multiRes(gr.TypeMulti+`; boundary=bound`, `--bound
+
+<string>one</string>
+--bound--
+`)
+		parts := res.Parts()
+		defer parts.Done()
+
+		var str string
+		var called bool
+		parts.Next().XmlWith(&str, func(*xml.Decoder) { called = true })
+		eq(t, `one`, str)
+		eq(t, true, called)
+	})
+}
+
+func TestRes_PartsCatch(t *testing.T) {
+	t.Run(`not multipart`, func(t *testing.T) {
+		res, flag := multiRes(gr.TypeJson, `{}`)
+		_, err := res.PartsCatch()
+		errs(t, `[gr] failed to read multipart response: unexpected media type "application/json"`, err)
+		eq(t, true, flag.DidClose)
+	})
+
+	t.Run(`missing boundary`, func(t *testing.T) {
+		res, flag := multiRes(gr.TypeMulti, ``)
+		_, err := res.PartsCatch()
+		errs(t, `missing boundary in media type "multipart/form-data"`, err)
+		eq(t, true, flag.DidClose)
+	})
+
+	t.Run(`nil body`, func(t *testing.T) {
+		res := &gr.Res{Header: H{gr.Type: {gr.TypeMulti + `; boundary=bound`}}}
+		parts, err := res.PartsCatch()
+		eq(t, nil, err)
+		eq(t, (*gr.Part)(nil), parts.Next())
+	})
+}
+
+func TestParts_NextCatch(t *testing.T) {
+	res, flag := multiRes(gr.TypeMulti+`; boundary=bound`, `--other
+`)
+	part, err := res.Parts().NextCatch()
+	eq(t, (*gr.Part)(nil), part)
+	errs(t, `[gr] failed to read multipart response`, err)
+	eq(t, true, flag.DidClose)
+}
+
+func TestPart_HttpResCatch(t *testing.T) {
+	res, _ := multiRes(gr.TypeMultiMixed+`; boundary=bound`, `--bound
+
+hello world
+--bound--
+`)
+	parts := res.Parts()
+	defer parts.Done()
+
+	_, err := parts.Next().HttpResCatch()
+	errs(t, `[gr] failed to parse embedded HTTP response`, err)
+}
+
+func TestParseContentRange(t *testing.T) {
+	test := func(exp gr.ContentRange, src string) {
+		t.Helper()
+		eq(t, exp, gr.ParseContentRange(src))
+		eq(t, exp, gr.ParseContentRange(exp.String()))
+	}
+
+	test(gr.ContentRange{0, 0, 1}, `bytes 0-0/1`)
+	test(gr.ContentRange{0, 499, 1234}, `bytes 0-499/1234`)
+	test(gr.ContentRange{500, 999, -1}, `bytes 500-999/*`)
+	test(gr.ContentRange{500, 999, -1}, ` bytes  500-999/* `)
+
+	eq(t, int64(500), gr.ContentRange{500, 999, -1}.Len())
+
+	fail := func(src string) {
+		t.Helper()
+		panics(t, `[gr] failed to parse content range`, func() {
+			gr.ParseContentRange(src)
+		})
+	}
+
+	fail(``)
+	fail(`bytes`)
+	fail(`bytes */1234`)
+	fail(`items 0-1/2`)
+	fail(`bytes 0-1`)
+	fail(`bytes 1-0/2`)
+	fail(`bytes -1-0/2`)
+	fail(`bytes 0-1/1`)
+	fail(`bytes 0-1/two`)
+}
@@ -0,0 +1,124 @@
+package gr_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mitranim/gr"
+)
+
+const testProblem = `{
+	"type": "https://example.com/probs/out-of-credit",
+	"title": "You do not have enough credit.",
+	"status": 403,
+	"detail": "Your current balance is 30, but that costs 50.",
+	"instance": "/account/12345/msgs/abc",
+	"balance": 30,
+	"accounts": ["/account/12345", "/account/67890"]
+}`
+
+func testProblemVal() gr.Problem {
+	return gr.Problem{
+		Type:     `https://example.com/probs/out-of-credit`,
+		Title:    `You do not have enough credit.`,
+		Status:   403,
+		Detail:   `Your current balance is 30, but that costs 50.`,
+		Instance: `/account/12345/msgs/abc`,
+		Ext: map[string]interface{}{
+			`balance`:  float64(30),
+			`accounts`: []interface{}{`/account/12345`, `/account/67890`},
+		},
+	}
+}
+
+func TestProblem_UnmarshalJSON(t *testing.T) {
+	test := func(exp gr.Problem, src string) {
+		t.Helper()
+		var out gr.Problem
+		try(json.Unmarshal([]byte(src), &out))
+		eq(t, exp, out)
+	}
+
+	test(gr.Problem{Type: gr.ProblemTypeBlank}, `{}`)
+	test(testProblemVal(), testProblem)
+	test(gr.Problem{Type: gr.ProblemTypeBlank, Title: `one`}, `{"title": "one", "status": "invalid"}`)
+
+	errs(t, `cannot unmarshal array`, json.Unmarshal([]byte(`[]`), new(gr.Problem)))
+}
+
+func TestProblem_MarshalJSON(t *testing.T) {
+	chunk, err := json.Marshal(testProblemVal())
+	try(err)
+	eq(
+		t,
+		`{"accounts":["/account/12345","/account/67890"],"balance":30,"detail":"Your current balance is 30, but that costs 50.","instance":"/account/12345/msgs/abc","status":403,"title":"You do not have enough credit.","type":"https://example.com/probs/out-of-credit"}`,
+		string(chunk),
+	)
+
+	chunk, err = json.Marshal(gr.Problem{})
+	try(err)
+	eq(t, `{}`, string(chunk))
+}
+
+func TestProblem_Error(t *testing.T) {
+	eq(t, `[gr] problem`, gr.Problem{}.Error())
+	eq(t, `[gr] problem: one`, gr.Problem{Type: gr.ProblemTypeBlank, Title: `one`}.Error())
+	eq(
+		t,
+		`[gr] problem "https://example.com/probs/out-of-credit" (HTTP status 403): You do not have enough credit.: Your current balance is 30, but that costs 50.`,
+		testProblemVal().Error(),
+	)
+}
+
+func TestRes_IsProblem(t *testing.T) {
+	eq(t, false, (&gr.Res{Header: H{gr.Type: {gr.TypeJson}}}).IsProblem())
+	eq(t, true, (&gr.Res{Header: H{gr.Type: {gr.TypeProblem}}}).IsProblem())
+	eq(t, true, (&gr.Res{Header: H{gr.Type: {gr.TypeProblem + `; charset=utf-8`}}}).IsProblem())
+}
+
+func TestRes_Err_problem(t *testing.T) {
+	res := func(typ, body string) *gr.Res {
+		return &gr.Res{
+			StatusCode: http.StatusForbidden,
+			Header:     H{gr.Type: {typ}},
+			Body:       gr.NewStringReadCloser(body),
+		}
+	}
+
+	t.Run(`decoded`, func(t *testing.T) {
+		err := res(gr.TypeProblem, testProblem).OkCatch()
+		errs(t, `[gr] error (HTTP status 403): unexpected non-OK response; body: {`, err)
+
+		var out gr.Err
+		eq(t, true, errors.As(err, &out))
+		exp := testProblemVal()
+		eq(t, &exp, out.Problem)
+
+		var prob gr.Problem
+		eq(t, true, errors.As(fmt.Errorf(`wrapped: %w`, err), &prob))
+		eq(t, exp, prob)
+
+		var ptr *gr.Problem
+		eq(t, true, errors.As(err, &ptr))
+		eq(t, out.Problem, ptr)
+	})
+
+	t.Run(`other media type`, func(t *testing.T) {
+		err := res(gr.TypeJson, testProblem).OkCatch()
+		eq(t, (*gr.Problem)(nil), err.(gr.Err).Problem)
+		eq(t, false, errors.As(err, new(gr.Problem)))
+	})
+
+	t.Run(`invalid body`, func(t *testing.T) {
+		err := res(gr.TypeProblem, `invalid`).OkCatch()
+		errs(t, `unexpected non-OK response; body: invalid`, err)
+		eq(t, (*gr.Problem)(nil), err.(gr.Err).Problem)
+	})
+
+	t.Run(`malformed media type`, func(t *testing.T) {
+		errs(t, `unexpected non-OK response`, res(`;;`, testProblem).OkCatch())
+	})
+}
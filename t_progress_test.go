@@ -0,0 +1,178 @@
+package gr_test
+
+import (
+	"io"
+	"net/http"
+	ht "net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/mitranim/gr"
+)
+
+type progressLog []gr.Progress
+
+func (self *progressLog) Add(val gr.Progress) { *self = append(*self, val) }
+
+func (self progressLog) Done() (out []int64) {
+	for _, val := range self {
+		out = append(out, val.Done)
+	}
+	return
+}
+
+func (self progressLog) Last() gr.Progress {
+	if len(self) == 0 {
+		return gr.Progress{}
+	}
+	return self[len(self)-1]
+}
+
+func TestProgress_Ratio(t *testing.T) {
+	eq(t, float64(-1), gr.Progress{Total: -1}.Ratio())
+	eq(t, float64(1), gr.Progress{}.Ratio())
+	eq(t, 0.25, gr.Progress{Done: 1, Total: 4}.Ratio())
+	eq(t, float64(1), gr.Progress{Done: 4, Total: 4}.Ratio())
+}
+
+func TestProgressReadCloser(t *testing.T) {
+	test := func(total int64, expDone []int64) {
+		t.Helper()
+
+		var log progressLog
+		body := NewReaderCloseFlag(`hello world`)
+		read := gr.NewProgressReadCloser(&readCloser{iotest.OneByteReader(body), body}, total, log.Add)
+
+		var buf [4]byte
+		for {
+			_, err := read.Read(buf[:])
+			if err != nil {
+				eq(t, io.EOF, err)
+				break
+			}
+		}
+
+		eq(t, expDone, log.Done())
+		eq(t, true, log.Last().End)
+		eq(t, total, log.Last().Total)
+		for _, val := range log[:len(log)-1] {
+			eq(t, false, val.End)
+		}
+
+		eq(t, false, body.DidClose)
+		try(read.Close())
+		eq(t, true, body.DidClose)
+	}
+
+	test(11, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11})
+	test(-1, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 11})
+
+	t.Run(`rate`, func(t *testing.T) {
+		read := gr.NewProgressReadCloser(gr.NewStringReadCloser(`hello`), 5, nil)
+		eq(t, gr.Progress{Total: 5}, read.Progress())
+
+		_, err := io.ReadAll(read)
+		try(err)
+
+		val := read.Progress()
+		eq(t, int64(5), val.Done)
+		eq(t, true, val.End)
+		eq(t, true, val.Elapsed > 0)
+		eq(t, true, val.Rate > 0)
+	})
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func TestReq_Progress(t *testing.T) {
+	var log progressLog
+	res := gr.To(testServer.URL).Post().String(`hello world`).Progress(log.Add).Res().Ok()
+
+	eq(t, `
+request method: POST
+request URL: /
+request body: hello world
+`, res.ReadString())
+
+	eq(t, int64(11), log.Last().Done)
+	eq(t, int64(11), log.Last().Total)
+	eq(t, true, log.Last().End)
+
+	t.Run(`unknown length`, func(t *testing.T) {
+		var log progressLog
+		gr.To(testServer.URL).Post().Reader(strings.NewReader(`hello world`)).Progress(log.Add).Res().Ok().Done()
+
+		eq(t, int64(11), log.Last().Done)
+		eq(t, int64(-1), log.Last().Total)
+		eq(t, true, log.Last().End)
+	})
+
+	t.Run(`nop`, func(t *testing.T) {
+		var log progressLog
+		req := gr.To(testServer.URL).Progress(log.Add)
+		eq(t, nil, req.Body)
+
+		req = gr.To(testServer.URL).String(`one`)
+		body := req.Body
+		is(t, body, req.Progress(nil).Body)
+	})
+}
+
+func TestReq_Progress_GetBody(t *testing.T) {
+	srv := ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+		if req.URL.Path == `/redirect` {
+			_, _ = io.Copy(io.Discard, req.Body)
+			http.Redirect(rew, req, `/target`, http.StatusTemporaryRedirect)
+			return
+		}
+		_, _ = io.Copy(rew, req.Body)
+	}))
+	defer srv.Close()
+
+	var log progressLog
+	req := gr.To(srv.URL).Path(`/redirect`).Post().String(`hello`).Progress(log.Add)
+	eq(t, `hello`, req.Res().Ok().ReadString())
+
+	var ends []int64
+	for _, val := range log {
+		if val.End {
+			ends = append(ends, val.Done)
+		}
+	}
+	eq(t, []int64{5, 5}, ends)
+
+	t.Run(`clone`, func(t *testing.T) {
+		var log progressLog
+		req := gr.To(srv.URL).Post().String(`hello`).Progress(log.Add)
+
+		eq(t, `hello`, readStr(req.Clone().Body))
+		eq(t, int64(5), log.Last().Done)
+		eq(t, `hello`, readStr(req.Body))
+		eq(t, 2, len(log))
+	})
+}
+
+func TestRes_Progress(t *testing.T) {
+	var log progressLog
+	res := gr.To(testServer.URL).Path(`/json`).Res().Ok().Progress(log.Add)
+
+	eq(t, `{"reqMethod":"GET","reqUrl":"/json","reqBody":""}`+"\n", res.ReadString())
+	eq(t, int64(50), log.Last().Done)
+	eq(t, int64(50), log.Last().Total)
+	eq(t, true, log.Last().End)
+
+	t.Run(`closing`, func(t *testing.T) {
+		body := NewReaderCloseFlag(`body`)
+		res := (&gr.Res{Body: body, ContentLength: -1}).Progress(func(gr.Progress) {})
+		res.Done()
+		eq(t, true, body.DidClose)
+	})
+
+	t.Run(`nop`, func(t *testing.T) {
+		eq(t, nil, new(gr.Res).Progress(func(gr.Progress) {}).Body)
+	})
+}
@@ -0,0 +1,258 @@
+package gr_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitranim/gr"
+)
+
+/*
+Responds with the given statuses in order, recording the body of each request.
+An empty status is treated as a transport error.
+*/
+type TransSeq struct {
+	Status []int
+	Head   []H
+	Bodies []string
+}
+
+func (self *TransSeq) RoundTrip(req *http.Request) (*http.Response, error) {
+	ind := len(self.Bodies)
+	self.Bodies = append(self.Bodies, readStr(req.Body))
+
+	if ind >= len(self.Status) || self.Status[ind] == 0 {
+		return nil, errTransSeq
+	}
+
+	var head H
+	if ind < len(self.Head) {
+		head = self.Head[ind]
+	}
+
+	return &http.Response{
+		StatusCode: self.Status[ind],
+		Header:     head,
+		Body:       gr.NewStringReadCloser(fmt.Sprint(`attempt `, ind)),
+	}, nil
+}
+
+var errTransSeq = fmt.Errorf(`unexpected transport error`)
+
+var retryTest = gr.Retry{
+	Count:  3,
+	Status: []int{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+	Min:    time.Microsecond,
+	Max:    time.Millisecond,
+}
+
+func TestRetry_HasStatus(t *testing.T) {
+	eq(t, false, gr.Retry{}.HasStatus(429))
+	eq(t, true, retryTest.HasStatus(429))
+	eq(t, true, retryTest.HasStatus(503))
+	eq(t, false, retryTest.HasStatus(500))
+}
+
+func TestRetry_Backoff(t *testing.T) {
+	test := func(exp time.Duration, opt gr.Retry, ind int) {
+		t.Helper()
+		eq(t, exp, opt.Backoff(ind))
+	}
+
+	test(gr.RetryMin, gr.Retry{}, 0)
+	test(gr.RetryMin*2, gr.Retry{}, 1)
+	test(gr.RetryMax, gr.Retry{}, 1024)
+
+	opt := gr.Retry{Min: time.Second, Max: time.Second * 5}
+	test(time.Second, opt, 0)
+	test(time.Second*2, opt, 1)
+	test(time.Second*4, opt, 2)
+	test(time.Second*5, opt, 3)
+	test(time.Second*5, opt, 64)
+}
+
+func TestRes_RetryAfter(t *testing.T) {
+	test := func(exp time.Duration, head H) {
+		t.Helper()
+		eq(t, exp, (&gr.Res{Header: head}).RetryAfter())
+	}
+
+	eq(t, time.Duration(0), (*gr.Res)(nil).RetryAfter())
+	test(0, nil)
+	test(0, H{`Retry-After`: {``}})
+	test(0, H{`Retry-After`: {`-1`}})
+	test(0, H{`Retry-After`: {`0`}})
+	test(0, H{`Retry-After`: {`hello world`}})
+	test(0, H{`Retry-After`: {`Wed, 21 Oct 2015 07:28:00 GMT`}})
+	test(time.Second*12, H{`Retry-After`: {`12`}})
+	test(time.Second*12, H{`Retry-After`: {` 12 `}})
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	dur := (&gr.Res{Header: H{`Retry-After`: {date}}}).RetryAfter()
+	eq(t, true, dur > time.Minute*59 && dur <= time.Hour)
+}
+
+func TestReq_RetryCliRes(t *testing.T) {
+	t.Run(`no retries`, func(t *testing.T) {
+		trans := &TransSeq{Status: []int{503, 200}}
+		cli := &http.Client{Transport: trans}
+
+		res := new(gr.Req).String(`hello world`).RetryCliRes(cli, gr.Retry{})
+		eq(t, 503, res.StatusCode)
+		eq(t, []string{`hello world`}, trans.Bodies)
+	})
+
+	t.Run(`retries listed statuses and replays body`, func(t *testing.T) {
+		trans := &TransSeq{Status: []int{503, 429, 200}}
+		cli := &http.Client{Transport: trans}
+
+		res := new(gr.Req).Post().String(`hello world`).RetryCliRes(cli, retryTest)
+		eq(t, 200, res.StatusCode)
+		eq(t, `attempt 2`, res.ReadString())
+		eq(t, []string{`hello world`, `hello world`, `hello world`}, trans.Bodies)
+	})
+
+	t.Run(`does not retry other statuses`, func(t *testing.T) {
+		trans := &TransSeq{Status: []int{500, 200}}
+		cli := &http.Client{Transport: trans}
+
+		res := new(gr.Req).RetryCliRes(cli, retryTest)
+		eq(t, 500, res.StatusCode)
+		eq(t, 1, len(trans.Bodies))
+	})
+
+	t.Run(`retries transport errors`, func(t *testing.T) {
+		trans := &TransSeq{Status: []int{0, 0, 200}}
+		cli := &http.Client{Transport: trans}
+
+		res := new(gr.Req).RetryCliRes(cli, retryTest)
+		eq(t, 200, res.StatusCode)
+		eq(t, 3, len(trans.Bodies))
+	})
+
+	t.Run(`stops after count`, func(t *testing.T) {
+		trans := &TransSeq{Status: []int{503, 503, 503, 503, 200}}
+		cli := &http.Client{Transport: trans}
+
+		res := new(gr.Req).RetryCliRes(cli, retryTest)
+		eq(t, 503, res.StatusCode)
+		eq(t, `attempt 3`, res.ReadString())
+		eq(t, 4, len(trans.Bodies))
+	})
+
+	t.Run(`panics on last transport error`, func(t *testing.T) {
+		trans := &TransSeq{}
+		cli := &http.Client{Transport: trans}
+
+		_, err := new(gr.Req).RetryCliResCatch(cli, retryTest)
+		errs(t, `[gr] failed to perform HTTP request`, err)
+		errs(t, errTransSeq.Error(), err)
+		eq(t, 4, len(trans.Bodies))
+	})
+
+	t.Run(`refuses non-replayable body`, func(t *testing.T) {
+		trans := &TransSeq{Status: []int{200}}
+		cli := &http.Client{Transport: trans}
+
+		_, err := new(gr.Req).
+			Post().
+			Reader(strings.NewReader(`hello world`)).
+			RetryCliResCatch(cli, retryTest)
+
+		errs(t, `body can't be replayed without "GetBody"`, err)
+		eq(t, 0, len(trans.Bodies))
+	})
+
+	t.Run(`Retry-After beyond deadline`, func(t *testing.T) {
+		trans := &TransSeq{
+			Status: []int{429, 200},
+			Head:   []H{{`Retry-After`: {`60`}}},
+		}
+		cli := &http.Client{Transport: trans}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		opt := retryTest
+		opt.Max = time.Minute * 2
+
+		res := gr.Ctx(ctx).RetryCliRes(cli, opt)
+		eq(t, 429, res.StatusCode)
+		eq(t, `attempt 0`, res.ReadString())
+		eq(t, 1, len(trans.Bodies))
+	})
+
+	t.Run(`Retry-After capped by max`, func(t *testing.T) {
+		trans := &TransSeq{
+			Status: []int{503, 200},
+			Head:   []H{{`Retry-After`: {`86400`}}},
+		}
+		cli := &http.Client{Transport: trans}
+
+		start := time.Now()
+		res := new(gr.Req).RetryCliRes(cli, retryTest)
+		eq(t, 200, res.StatusCode)
+		eq(t, 2, len(trans.Bodies))
+		is(t, true, time.Since(start) < time.Second)
+	})
+
+	t.Run(`canceled context`, func(t *testing.T) {
+		trans := &TransSeq{Status: []int{503, 200}}
+		cli := &http.Client{Transport: trans}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		res := gr.Ctx(ctx).RetryCliRes(cli, retryTest)
+		eq(t, 503, res.StatusCode)
+		eq(t, 1, len(trans.Bodies))
+	})
+
+	t.Run(`context canceled during delay`, func(t *testing.T) {
+		trans := &TransSeq{Status: []int{503, 200}}
+		cli := &http.Client{Transport: trans}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(time.Millisecond*10, cancel)
+
+		_, err := gr.Ctx(ctx).RetryCliResCatch(cli, gr.Retry{
+			Count:  1,
+			Status: []int{503},
+			Min:    time.Hour,
+			Max:    time.Hour,
+		})
+		errs(t, `context canceled`, err)
+		eq(t, 1, len(trans.Bodies))
+	})
+}
+
+func TestReq_RetryRes(t *testing.T) {
+	trans := &TransSeq{Status: []int{503, 200}}
+	cli := &http.Client{Transport: trans}
+
+	res := new(gr.Req).Cli(cli).RetryRes(retryTest)
+	eq(t, 200, res.StatusCode)
+	eq(t, 2, len(trans.Bodies))
+}
+
+func TestReq_RetryResCatch(t *testing.T) {
+	trans := &TransSeq{Status: []int{503, 200}}
+	cli := &http.Client{Transport: trans}
+
+	res, err := new(gr.Req).Cli(cli).RetryResCatch(retryTest)
+	eq(t, nil, err)
+	eq(t, 200, res.StatusCode)
+	eq(t, `attempt 1`, res.ReadString())
+
+	trans = &TransSeq{}
+	cli = &http.Client{Transport: trans}
+
+	res, err = new(gr.Req).Cli(cli).RetryResCatch(retryTest)
+	errs(t, errTransSeq.Error(), err)
+	eq(t, (*gr.Res)(nil), res)
+	eq(t, 4, len(trans.Bodies))
+}
@@ -0,0 +1,217 @@
+package gr_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	ht "net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/mitranim/gr"
+)
+
+func readEvents(src io.Reader) (out []gr.Event) {
+	events := (&gr.Res{Body: io.NopCloser(src)}).Events()
+	defer events.Done()
+
+	for event := events.Next(); event != nil; event = events.Next() {
+		out = append(out, *event)
+	}
+	return
+}
+
+func TestRes_IsEventStream(t *testing.T) {
+	eq(t, false, (&gr.Res{Header: H{gr.Type: {gr.TypeJson}}}).IsEventStream())
+	eq(t, true, (&gr.Res{Header: H{gr.Type: {gr.TypeEventStream}}}).IsEventStream())
+	eq(t, true, (&gr.Res{Header: H{gr.Type: {gr.TypeEventStream + `; charset=utf-8`}}}).IsEventStream())
+}
+
+func TestRes_Events(t *testing.T) {
+	test := func(exp []gr.Event, src string) {
+		t.Helper()
+		eq(t, exp, readEvents(strings.NewReader(src)))
+
+		// Every byte lands at a read boundary.
+		eq(t, exp, readEvents(iotest.OneByteReader(strings.NewReader(src))))
+	}
+
+	test(nil, ``)
+	test(nil, "\n\n\n")
+	test(nil, ": comment\n\n")
+	test(nil, "event: one\n\n")
+	test(nil, "data: incomplete")
+	test(nil, "data: incomplete\n")
+
+	test([]gr.Event{{Data: `one`}}, "data: one\n\n")
+	test([]gr.Event{{Data: `one`}}, "data:one\n\n")
+	test([]gr.Event{{Data: ` one`}}, "data:  one\n\n")
+	test([]gr.Event{{Data: ``}}, "data\n\n")
+	test([]gr.Event{{Data: "\n"}}, "data\ndata\n\n")
+	test([]gr.Event{{Data: "one\ntwo"}}, "data: one\ndata: two\n\n")
+	test([]gr.Event{{Data: `one`}}, "\xef\xbb\xbfdata: one\n\n")
+	test([]gr.Event{{Data: `one`}, {Data: `two`}}, "data: one\r\n\r\ndata: two\r\rdata: three")
+	test([]gr.Event{{Data: `one`, Event: `two`}}, "event: two\n: comment\ndata: one\nunknown: three\n\n")
+
+	test(
+		[]gr.Event{
+			{Id: `1`, Data: `one`},
+			{Id: `1`, Data: `two`, Event: `update`},
+			{Id: ``, Data: `three`, Retry: time.Millisecond * 1500},
+			{Id: ``, Data: `four`},
+		},
+		"id: 1\ndata: one\n\nevent: update\ndata: two\n\nid\nretry: 1500\ndata: three\n\nretry: nope\ndata: four\n\n",
+	)
+
+	t.Run(`state`, func(t *testing.T) {
+		events := (&gr.Res{Body: gr.NewStringReadCloser("id: 1\nretry: 10\ndata: one\n\n")}).Events()
+		eq(t, &gr.Event{Id: `1`, Data: `one`, Retry: time.Millisecond * 10}, events.Next())
+		eq(t, `1`, events.LastId)
+		eq(t, time.Millisecond*10, events.Retry)
+		eq(t, (*gr.Event)(nil), events.Next())
+	})
+
+	t.Run(`closing`, func(t *testing.T) {
+		body := NewReaderCloseFlag("data: one\n\n")
+		events := (&gr.Res{Body: body}).Events()
+
+		eq(t, &gr.Event{Data: `one`}, events.Next())
+		eq(t, false, body.DidClose)
+		eq(t, (*gr.Event)(nil), events.Next())
+		eq(t, true, body.DidClose)
+	})
+
+	t.Run(`nil body`, func(t *testing.T) {
+		eq(t, (*gr.Event)(nil), new(gr.Res).Events().Next())
+	})
+
+	t.Run(`read error`, func(t *testing.T) {
+		_, err := (&gr.Res{Body: FailReadCloser{}}).Events().NextCatch()
+		errs(t, `[gr] failed to read event stream: unexpected read`, err)
+	})
+
+	t.Run(`bare CR at read boundary`, func(t *testing.T) {
+		read, write := io.Pipe()
+		events := (&gr.Res{Body: read}).Events()
+		defer events.Done()
+
+		// Fails the test instead of hanging if the event isn't dispatched.
+		timer := time.AfterFunc(time.Second, func() {
+			_ = write.CloseWithError(fmt.Errorf(`timed out`))
+		})
+		defer timer.Stop()
+
+		go func() {
+			_, _ = io.WriteString(write, "data: one\r")
+			_, _ = io.WriteString(write, "\ndata: two\r\r")
+		}()
+
+		// The LF after the first CR belongs to CRLF and doesn't end the event.
+		eq(t, &gr.Event{Data: "one\ntwo"}, events.Next())
+
+		go func() {
+			_, _ = io.WriteString(write, "\ndata: three\r\r")
+			_ = write.Close()
+		}()
+
+		eq(t, &gr.Event{Data: `three`}, events.Next())
+		eq(t, (*gr.Event)(nil), events.Next())
+	})
+}
+
+func TestEvent_Json(t *testing.T) {
+	var out map[string]int
+	gr.Event{Data: `{"one":1}`}.Json(&out)
+	eq(t, map[string]int{`one`: 1}, out)
+
+	eq(t, nil, gr.Event{Data: `invalid`}.JsonCatch(nil))
+
+	errs(
+		t,
+		`[gr] failed to JSON-decode event data`,
+		gr.Event{Data: `invalid`}.JsonCatch(&out),
+	)
+}
+
+func TestEventSource(t *testing.T) {
+	var lastIds []string
+
+	srv := ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+		eq(t, gr.TypeEventStream, req.Header.Get(`Accept`))
+		lastIds = append(lastIds, req.Header.Get(`Last-Event-ID`))
+
+		switch len(lastIds) {
+		case 1:
+			rew.Header().Set(gr.Type, gr.TypeEventStream)
+			fmt.Fprint(rew, "retry: 1\nid: 1\ndata: one\n\nid: 2\ndata: two\n\n")
+		case 2:
+			rew.WriteHeader(http.StatusBadGateway)
+		case 3:
+			rew.Header().Set(gr.Type, gr.TypeEventStream)
+			fmt.Fprint(rew, "data: three\n\n")
+		default:
+			rew.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	src := &gr.EventSource{Req: gr.To(srv.URL).Get()}
+	defer src.Done()
+
+	var out []gr.Event
+	for {
+		event, err := src.NextCatch()
+		if err != nil {
+			errs(t, `HTTP status 502`, err)
+			continue
+		}
+		if event == nil {
+			break
+		}
+		out = append(out, *event)
+	}
+
+	eq(
+		t,
+		[]gr.Event{
+			{Id: `1`, Data: `one`, Retry: time.Millisecond},
+			{Id: `2`, Data: `two`},
+			{Id: `2`, Data: `three`},
+		},
+		out,
+	)
+
+	eq(t, []string{``, `2`, `2`, `2`}, lastIds)
+	eq(t, `2`, src.LastId)
+	eq(t, time.Millisecond, src.Retry)
+}
+
+func TestEventSource_ctx(t *testing.T) {
+	srv := ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+		rew.Header().Set(gr.Type, gr.TypeEventStream)
+		fmt.Fprint(rew, "data: one\n\n")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	src := &gr.EventSource{Req: gr.To(srv.URL).Ctx(ctx), Retry: time.Hour}
+	defer src.Done()
+
+	eq(t, &gr.Event{Data: `one`}, src.Next())
+
+	time.AfterFunc(time.Millisecond*10, cancel)
+	eq(t, (*gr.Event)(nil), src.Next())
+}
+
+func TestEventSource_type(t *testing.T) {
+	srv := ht.NewServer(http.HandlerFunc(func(rew W, req *Q) {
+		rew.Header().Set(gr.Type, gr.TypeJson)
+	}))
+	defer srv.Close()
+
+	_, err := (&gr.EventSource{Req: gr.To(srv.URL)}).NextCatch()
+	errs(t, `[gr] failed to read event stream: unexpected media type "application/json"`, err)
+}
@@ -0,0 +1,179 @@
+package gr_test
+
+import (
+	"testing"
+
+	"github.com/mitranim/gr"
+)
+
+// Variables from RFC 6570, section 3.2.1.
+var uriVars = map[string]interface{}{
+	`count`:      []string{`one`, `two`, `three`},
+	`dom`:        []string{`example`, `com`},
+	`dub`:        `me/too`,
+	`hello`:      `Hello World!`,
+	`half`:       `50%`,
+	`var`:        `value`,
+	`who`:        `fred`,
+	`base`:       `http://example.com/home/`,
+	`path`:       `/foo/bar`,
+	`list`:       []string{`red`, `green`, `blue`},
+	`keys`:       map[string]string{`semi`: `;`, `dot`: `.`, `comma`: `,`},
+	`v`:          6,
+	`x`:          1024,
+	`y`:          768,
+	`empty`:      ``,
+	`empty_keys`: map[string]string{},
+	`undef`:      nil,
+}
+
+func TestExpandUri(t *testing.T) {
+	test := func(exp, tpl string) {
+		t.Helper()
+		eq(t, exp, gr.ExpandUri(tpl, uriVars))
+	}
+
+	// Level 1.
+	test(`value`, `{var}`)
+	test(`Hello%20World%21`, `{hello}`)
+	test(`/path/value/`, `/path/{var}/`)
+
+	// Level 2.
+	test(`value`, `{+var}`)
+	test(`Hello%20World!`, `{+hello}`)
+	test(`http://example.com/home/index`, `{+base}index`)
+	test(`/foo/bar/here`, `{+path}/here`)
+	test(`here?ref=/foo/bar`, `here?ref={+path}`)
+	test(`#value`, `{#var}`)
+	test(`#Hello%20World!`, `{#hello}`)
+	test(`50%25`, `{half}`)
+	test(`50%25`, `{+half}`)
+
+	// Level 3.
+	test(`map?1024,768`, `map?{x,y}`)
+	test(`/foo/bar,1024/here`, `{+path,x}/here`)
+	test(`#/foo/bar,1024/here`, `{#path,x}/here`)
+	test(`X.value`, `X{.var}`)
+	test(`X.1024.768`, `X{.x,y}`)
+	test(`/value`, `{/var}`)
+	test(`/value/1024/here`, `{/var,x}/here`)
+	test(`;x=1024;y=768`, `{;x,y}`)
+	test(`;x=1024;y=768;empty`, `{;x,y,empty}`)
+	test(`?x=1024&y=768`, `{?x,y}`)
+	test(`?x=1024&y=768&empty=`, `{?x,y,empty}`)
+	test(`?fixed=yes&x=1024`, `?fixed=yes{&x}`)
+	test(`&x=1024&y=768&empty=`, `{&x,y,empty}`)
+
+	// Level 4.
+	test(`val`, `{var:3}`)
+	test(`value`, `{var:30}`)
+	test(`red,green,blue`, `{list}`)
+	test(`red,green,blue`, `{list*}`)
+	test(`comma,%2C,dot,.,semi,%3B`, `{keys}`)
+	test(`comma=%2C,dot=.,semi=%3B`, `{keys*}`)
+	test(`/foo/b/here`, `{+path:6}/here`)
+	test(`red,green,blue`, `{+list}`)
+	test(`comma,,,dot,.,semi,;`, `{+keys}`)
+	test(`comma=,,dot=.,semi=;`, `{+keys*}`)
+	test(`#red,green,blue`, `{#list*}`)
+	test(`#comma=,,dot=.,semi=;`, `{#keys*}`)
+	test(`X.red,green,blue`, `X{.list}`)
+	test(`X.red.green.blue`, `X{.list*}`)
+	test(`/red,green,blue`, `{/list}`)
+	test(`/red/green/blue`, `{/list*}`)
+	test(`/red/green/blue/%2Ffoo`, `{/list*,path:4}`)
+	test(`;list=red,green,blue`, `{;list}`)
+	test(`;list=red;list=green;list=blue`, `{;list*}`)
+	test(`;keys=comma,%2C,dot,.,semi,%3B`, `{;keys}`)
+	test(`;comma=%2C;dot=.;semi=%3B`, `{;keys*}`)
+	test(`?list=red,green,blue`, `{?list}`)
+	test(`?list=red&list=green&list=blue`, `{?list*}`)
+	test(`?keys=comma,%2C,dot,.,semi,%3B`, `{?keys}`)
+	test(`?comma=%2C&dot=.&semi=%3B`, `{?keys*}`)
+	test(`&list=red&list=green&list=blue`, `{&list*}`)
+	test(`&comma=%2C&dot=.&semi=%3B`, `{&keys*}`)
+
+	// Undefined variables in optional expressions.
+	test(`?x=1024`, `{?x,undef,empty_keys}`)
+	test(`X`, `X{.undef}`)
+	test(``, `{#undef}`)
+	test(`/users/fred/repos`, `/users/{who}/repos{?undef}`)
+
+	// Literals.
+	test(`/one%20two/%C3%A9`, `/one two/é`)
+	test(`/%2F`, `/%2F`)
+}
+
+func TestExpandUri_struct(t *testing.T) {
+	type Embed struct {
+		Page int `uri:"page"`
+	}
+
+	type Vars struct {
+		Embed
+		Id      string   `uri:"id"`
+		PerPage *int     `uri:"per_page"`
+		Tags    []string `uri:"tag"`
+		Skip    string   `uri:"-"`
+		Name    string
+	}
+
+	eq(
+		t,
+		`/users/10/repos?page=2&tag=one&tag=two`,
+		gr.ExpandUri(`/users/{id}/repos{?page,per_page,tag*}`, Vars{Id: `10`, Embed: Embed{Page: 2}, Tags: []string{`one`, `two`}}),
+	)
+
+	eq(t, `/Name`, gr.ExpandUri(`/{Name}`, &Vars{Name: `Name`}))
+}
+
+func TestExpandUri_errors(t *testing.T) {
+	test := func(exp, tpl string, vars interface{}) {
+		t.Helper()
+		_, err := gr.ExpandUriCatch(tpl, vars)
+		errs(t, `[gr] failed to expand URI template `, err)
+		errs(t, exp, err)
+	}
+
+	test(`missing required variable "id"`, `/users/{id}`, nil)
+	test(`missing required variable "id"`, `/users/{id}`, map[string]string{})
+	test(`unexpected empty value for required variable "id"`, `/users/{id}`, map[string]string{`id`: ``})
+	test(`unexpected empty value for required variable "id"`, `/users{/id}`, map[string]interface{}{`id`: ``})
+	test(`missing required variable "base"`, `{+base}/path`, map[string]interface{}{`base`: nil})
+	test(`missing required variable "ids"`, `/users/{ids}`, map[string]interface{}{`ids`: []int{}})
+	test(`unclosed expression at position 6`, `/users{id`, nil)
+	test(`unclosed expression`, `/users{id{`, nil)
+	test(`unexpected "}" at position 6`, `/users}`, nil)
+	test(`empty expression`, `/users{}`, nil)
+	test(`unsupported operator "="`, `{=id}`, nil)
+	test(`invalid variable name "a b"`, `{a b}`, nil)
+	test(`invalid prefix modifier in "id:0"`, `{id:0}`, nil)
+	test(`invalid prefix modifier in "id:10000"`, `{id:10000}`, nil)
+	test(`unexpected prefix modifier for composite variable "list"`, `{list:3}`, uriVars)
+	test(`expected map with string keys or struct, got int`, `{id}`, 10)
+	test(`unsupported type`, `{id}`, map[string]interface{}{`id`: struct{}{}})
+}
+
+func TestReq_Expand(t *testing.T) {
+	vars := map[string]interface{}{`id`: 10, `page`: 2}
+
+	eq(
+		t,
+		`https://example.com/users/10/repos?page=2`,
+		gr.To(`https://example.com/v1/`).Expand(`/users/{id}/repos{?page,per_page}`, vars).URL.String(),
+	)
+
+	eq(
+		t,
+		`https://example.com/v1/users/10`,
+		gr.To(`https://example.com/v1/`).Expand(`users/{id}`, vars).URL.String(),
+	)
+
+	eq(
+		t,
+		`https://other.com/users/10`,
+		gr.To(`https://example.com/v1/`).Expand(`https://other.com/users/{id}`, vars).URL.String(),
+	)
+
+	eq(t, `/users/10`, new(gr.Req).Expand(`/users/{id}`, vars).URL.String())
+}
@@ -0,0 +1,398 @@
+package gr_test
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mitranim/gr"
+)
+
+type StrPtr struct{ val string }
+
+func (self *StrPtr) String() string { return `ptr:` + self.val }
+
+type StrVal string
+
+func (self StrVal) String() string { return `val:` + string(self) }
+
+type QueryInner struct {
+	Five string `query:"five"`
+}
+
+type QueryEmbed struct {
+	Six int `query:"six,omitempty"`
+}
+
+type QueryParams struct {
+	QueryEmbed
+	One      string            `query:"one"`
+	Two      *int              `query:"two"`
+	Three    []int             `query:"three"`
+	Four     QueryInner        `query:"four"`
+	Seven    time.Time         `query:"seven,omitempty" layout:"2006-01-02"`
+	Eight    time.Time         `query:"eight,omitempty"`
+	Nine     StrVal            `query:"nine,omitempty"`
+	Ten      StrPtr            `query:"ten"`
+	Eleven   map[string]string `query:"eleven"`
+	Twelve   []byte            `query:"twelve,omitempty"`
+	Untagged bool
+	Skip     string `query:"-"`
+	private  string
+}
+
+func TestEncodeQuery(t *testing.T) {
+	eq(t, url.Values{}, gr.EncodeQuery(nil))
+	eq(t, url.Values{}, gr.EncodeQuery((*QueryParams)(nil)))
+
+	panics(t, `[gr] failed to encode query: expected struct, got int`, func() {
+		gr.EncodeQuery(10)
+	})
+
+	panics(t, `[gr] failed to encode query field "one"`, func() {
+		gr.EncodeQuery(struct {
+			One func() `query:"one"`
+		}{func() {}})
+	})
+
+	two := 2
+	at := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	eq(
+		t,
+		url.Values{
+			`six`:        {`6`},
+			`one`:        {`one`},
+			`two`:        {`2`},
+			`three`:      {`3`, `4`},
+			`four[five]`: {`five`},
+			`seven`:      {`2021-02-03`},
+			`eight`:      {`2021-02-03T04:05:06Z`},
+			`nine`:       {`val:nine`},
+			`ten`:        {`ptr:ten`},
+			`eleven[a]`:  {`b`},
+			`twelve`:     {`bytes`},
+			`Untagged`:   {`true`},
+		},
+		gr.EncodeQuery(&QueryParams{
+			QueryEmbed: QueryEmbed{Six: 6},
+			One:        `one`,
+			Two:        &two,
+			Three:      []int{3, 4},
+			Four:       QueryInner{`five`},
+			Seven:      at,
+			Eight:      at,
+			Nine:       `nine`,
+			Ten:        StrPtr{`ten`},
+			Eleven:     map[string]string{`a`: `b`},
+			Twelve:     []byte(`bytes`),
+			Untagged:   true,
+			Skip:       `skip`,
+			private:    `private`,
+		}),
+	)
+
+	eq(
+		t,
+		url.Values{
+			`one`:        {``},
+			`four[five]`: {``},
+			`ten`:        {`ptr:`},
+			`Untagged`:   {`false`},
+		},
+		gr.EncodeQuery(QueryParams{}),
+	)
+}
+
+func TestReq_QueryStruct(t *testing.T) {
+	req := gr.To(`https://example.com/path`).QueryStruct(struct {
+		One []string `query:"one"`
+		Two *string  `query:"two"`
+	}{One: []string{`a b`, `c&d`}})
+
+	eq(t, `https://example.com/path?one=a+b&one=c%26d`, req.URL.String())
+}
+
+type FormInner struct {
+	Three int    `form:"three"`
+	Four  string `form:"four"`
+}
+
+type FormEmbed struct {
+	Five bool `form:"five"`
+}
+
+type FormParams struct {
+	*FormEmbed
+	One    string            `form:"one"`
+	Two    *int              `form:"two"`
+	Inner  FormInner         `form:"inner"`
+	Ptr    *FormInner        `form:"ptr"`
+	Six    []int             `form:"six"`
+	Seven  time.Time         `form:"seven" layout:"2006-01-02"`
+	Eight  time.Duration     `form:"eight"`
+	Nine   map[string]string `form:"nine"`
+	Ten    []byte            `form:"ten"`
+	Eleven [2]string         `form:"eleven"`
+	Twelve *float64          `form:"twelve"`
+}
+
+func TestEncodeForm(t *testing.T) {
+	eq(
+		t,
+		url.Values{`a[b]`: {`c`}, `d`: {`10s`}},
+		gr.EncodeForm(struct {
+			A map[string]string `form:"a"`
+			D time.Duration     `form:"d"`
+			E string            `query:"e" form:"-"`
+		}{A: map[string]string{`b`: `c`}, D: time.Second * 10}),
+	)
+}
+
+func TestReq_FormStruct(t *testing.T) {
+	req := new(gr.Req).FormStruct(FormInner{Three: 3, Four: `four`})
+	eq(t, gr.TypeForm, req.Header.Get(gr.Type))
+	eq(t, `four=four&three=3`, readStr(req.Body))
+}
+
+func TestDecodeForm(t *testing.T) {
+	panics(t, `[gr] failed to decode form: expected non-nil pointer to struct, got gr_test.FormParams`, func() {
+		gr.DecodeForm(nil, FormParams{})
+	})
+
+	panics(t, `expected non-nil pointer to struct, got *int`, func() {
+		gr.DecodeForm(nil, new(int))
+	})
+
+	t.Run(`empty`, func(t *testing.T) {
+		var out FormParams
+		gr.DecodeForm(nil, &out)
+		eq(t, FormParams{}, out)
+	})
+
+	t.Run(`full`, func(t *testing.T) {
+		var out FormParams
+		gr.DecodeForm(url.Values{
+			`one`:          {`one`, `ignored`},
+			`two`:          {`2`},
+			`inner[three]`: {`3`},
+			`inner[four]`:  {`four`},
+			`ptr[three]`:   {`33`},
+			`five`:         {`true`},
+			`six`:          {`6`, `66`},
+			`seven`:        {`2021-02-03`},
+			`eight`:        {`1m30s`},
+			`nine[a]`:      {`b`},
+			`nine[c]`:      {`d`},
+			`ten`:          {`ten`},
+			`eleven`:       {`a`, `b`, `c`},
+		}, &out)
+
+		two := 2
+		eq(
+			t,
+			FormParams{
+				FormEmbed: &FormEmbed{Five: true},
+				One:       `one`,
+				Two:       &two,
+				Inner:     FormInner{Three: 3, Four: `four`},
+				Ptr:       &FormInner{Three: 33},
+				Six:       []int{6, 66},
+				Seven:     time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC),
+				Eight:     time.Minute + time.Second*30,
+				Nine:      map[string]string{`a`: `b`, `c`: `d`},
+				Ten:       []byte(`ten`),
+				Eleven:    [2]string{`a`, `b`},
+			},
+			out,
+		)
+	})
+
+	t.Run(`roundtrip`, func(t *testing.T) {
+		twelve := 1.5
+		src := FormParams{
+			FormEmbed: &FormEmbed{Five: true},
+			One:       `one`,
+			Inner:     FormInner{Three: 3},
+			Six:       []int{6},
+			Seven:     time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC),
+			Eight:     time.Second,
+			Nine:      map[string]string{`a`: `b`},
+			Ten:       []byte(`ten`),
+			Eleven:    [2]string{`a`, `b`},
+			Twelve:    &twelve,
+		}
+
+		var out FormParams
+		gr.DecodeForm(gr.EncodeForm(src), &out)
+		eq(t, src, out)
+	})
+
+	t.Run(`field errors`, func(t *testing.T) {
+		var out FormParams
+		err := gr.DecodeFormCatch(url.Values{
+			`one`:          {`one`},
+			`two`:          {`two`},
+			`inner[three]`: {`three`},
+			`six`:          {`6`, `six`},
+		}, &out)
+
+		errs(t, `[gr] failed to decode field "two": strconv.ParseInt: parsing "two": invalid syntax; field "inner[three]": `, err)
+		errs(t, `field "six": strconv.ParseInt: parsing "six": invalid syntax`, err)
+
+		var fieldErrs gr.FieldErrs
+		eq(t, true, errors.As(err, &fieldErrs))
+		eq(t, 3, len(fieldErrs))
+		eq(t, `two`, fieldErrs[0].Key)
+		eq(t, true, errors.Is(err, strconv.ErrSyntax))
+
+		eq(t, `one`, out.One)
+	})
+
+	t.Run(`unsupported absent`, func(t *testing.T) {
+		type Params struct {
+			One   string
+			Extra interface{}
+			Meta  map[string]interface{}
+			Fun   func()
+		}
+
+		var out Params
+		gr.DecodeForm(url.Values{`One`: {`one`}}, &out)
+		eq(t, Params{One: `one`}, out)
+
+		err := gr.DecodeFormCatch(url.Values{`Extra`: {`two`}, `Meta[three]`: {`four`}}, &out)
+		errs(t, `field "Extra": unsupported type interface {}`, err)
+		errs(t, `field "Meta": unsupported map type map[string]interface {}`, err)
+	})
+}
+
+func TestFieldErrs(t *testing.T) {
+	err := gr.FieldErrs{
+		{Key: `one`, Cause: errRead},
+		{Key: `two`, Cause: &strconv.NumError{Func: `ParseInt`, Num: `two`, Err: strconv.ErrSyntax}},
+	}
+
+	// Called directly, these don't depend on multi-error support in "errors",
+	// which was added in Go 1.20.
+	eq(t, true, err.Is(errRead))
+	eq(t, true, err.Is(strconv.ErrSyntax))
+	eq(t, false, err.Is(strconv.ErrRange))
+
+	var numErr *strconv.NumError
+	eq(t, true, err.As(&numErr))
+	eq(t, `two`, numErr.Num)
+
+	eq(t, true, errors.Is(err, errRead))
+	eq(t, true, errors.Is(fmt.Errorf(`wrapped: %w`, err), strconv.ErrSyntax))
+	eq(t, false, errors.Is(err, strconv.ErrRange))
+}
+
+func TestRes_FormStruct(t *testing.T) {
+	var out FormInner
+	(&gr.Res{Body: gr.NewStringReadCloser(`three=3&four=four`)}).FormStruct(&out)
+	eq(t, FormInner{Three: 3, Four: `four`}, out)
+
+	errs(
+		t,
+		`[gr] failed to decode field "three"`,
+		(&gr.Res{Body: gr.NewStringReadCloser(`three=four`)}).FormStructCatch(&out),
+	)
+}
+
+type HeadEmbed struct {
+	RequestId string `header:"x-request-id"`
+}
+
+type HeadParams struct {
+	*HeadEmbed
+	Limit     int           `header:"X-RateLimit-Limit"`
+	Remaining *int          `header:"X-RateLimit-Remaining"`
+	Reset     time.Duration `header:"X-RateLimit-Reset"`
+	Window    time.Duration `header:"X-RateLimit-Window"`
+	Date      time.Time     `header:"Date"`
+	Expires   *time.Time    `header:"Expires" layout:"2006-01-02"`
+	Vary      []string      `header:"Vary"`
+	Codes     []int         `header:"X-Codes"`
+	Ok        bool
+	Missing   string `header:"X-Missing"`
+	Skip      string `header:"-"`
+}
+
+func TestDecodeHead(t *testing.T) {
+	panics(t, `[gr] failed to decode header: expected non-nil pointer to struct, got gr_test.HeadParams`, func() {
+		gr.DecodeHead(nil, HeadParams{})
+	})
+
+	t.Run(`empty`, func(t *testing.T) {
+		var out HeadParams
+		gr.DecodeHead(nil, &out)
+		eq(t, HeadParams{}, out)
+	})
+
+	t.Run(`full`, func(t *testing.T) {
+		out := HeadParams{Missing: `unchanged`}
+		gr.DecodeHead(H{
+			`X-Request-Id`:          {` one `},
+			`X-RateLimit-Limit`:     {`100`},
+			`X-Ratelimit-Remaining`: {`99`},
+			`X-Ratelimit-Reset`:     {`1.5`},
+			`X-Ratelimit-Window`:    {`1m`},
+			`Date`:                  {`Wed, 03 Feb 2021 04:05:06 GMT`},
+			`Expires`:               {`2021-02-04`},
+			`Vary`:                  {`Accept, Accept-Encoding`, `Origin`},
+			`X-Codes`:               {`1,2`, ` 3 `},
+			`Ok`:                    {`true`},
+			`Skip`:                  {`skip`},
+		}, &out)
+
+		remaining := 99
+		expires := time.Date(2021, 2, 4, 0, 0, 0, 0, time.UTC)
+
+		eq(
+			t,
+			HeadParams{
+				HeadEmbed: &HeadEmbed{RequestId: `one`},
+				Limit:     100,
+				Remaining: &remaining,
+				Reset:     time.Millisecond * 1500,
+				Window:    time.Minute,
+				Date:      time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC),
+				Expires:   &expires,
+				Vary:      []string{`Accept`, `Accept-Encoding`, `Origin`},
+				Codes:     []int{1, 2, 3},
+				Ok:        true,
+				Missing:   `unchanged`,
+			},
+			out,
+		)
+	})
+
+	t.Run(`field errors`, func(t *testing.T) {
+		var out HeadParams
+		err := gr.DecodeHeadCatch(H{
+			`X-RateLimit-Limit`:  {`many`},
+			`X-RateLimit-Reset`:  {`soon`},
+			`X-RateLimit-Window`: {`1m`},
+			`Date`:               {`yesterday`},
+		}, &out)
+
+		errs(t, `[gr] failed to decode field "X-RateLimit-Limit": strconv.ParseInt: parsing "many": invalid syntax; field "X-RateLimit-Reset": time: invalid duration "soon"; field "Date": parsing time "yesterday"`, err)
+		eq(t, time.Minute, out.Window)
+	})
+}
+
+func TestRes_HeadStruct(t *testing.T) {
+	var out HeadParams
+	(&gr.Res{Header: H{`X-RateLimit-Limit`: {`10`}}}).HeadStruct(&out)
+	eq(t, 10, out.Limit)
+
+	errs(
+		t,
+		`[gr] failed to decode field "X-RateLimit-Limit"`,
+		(&gr.Res{Header: H{`X-RateLimit-Limit`: {`ten`}}}).HeadStructCatch(&out),
+	)
+}